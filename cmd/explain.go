@@ -0,0 +1,100 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const explainFileName = "explain.go"
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [projectDir]",
+	Short: "Explain the access of a user to records",
+	Long: `Explain why the access of a user to records of a model is granted or denied.
+The report lists the groups of the user and the method permissions, model and
+field access rights and record rules that have been evaluated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectDir := "."
+		if len(args) > 0 {
+			projectDir = args[0]
+		}
+		generateAndRunFile(projectDir, explainFileName, explainTemplate)
+	},
+}
+
+// ExplainAccess prints the explanation of the access of the user, to the
+// records and for the permission given by the Explain.* configuration keys.
+// It is meant to be called from a project start file which imports all the
+// project's module.
+func ExplainAccess(config map[string]interface{}) {
+	setupConfig(config)
+	connectToDB()
+	models.BootStrap()
+	perm, ok := security.ParsePermission(viper.GetString("Explain.Perm"))
+	if !ok {
+		log.Panic("Invalid permission", "perm", viper.GetString("Explain.Perm"))
+	}
+	var ids []int64
+	for _, idStr := range strings.Split(viper.GetString("Explain.IDs"), ",") {
+		idStr = strings.TrimSpace(idStr)
+		if idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Panic("Invalid record ID", "id", idStr, "error", err)
+		}
+		ids = append(ids, id)
+	}
+	fmt.Print(security.Explain(int64(viper.GetInt("Explain.UID")), viper.GetString("Explain.Model"), ids, perm))
+}
+
+func initExplain() {
+	explainCmd.Flags().Int64("uid", security.SuperUserID, "ID of the user whose access is explained")
+	viper.BindPFlag("Explain.UID", explainCmd.Flags().Lookup("uid"))
+	explainCmd.Flags().String("model", "", "Name of the model")
+	viper.BindPFlag("Explain.Model", explainCmd.Flags().Lookup("model"))
+	explainCmd.Flags().String("ids", "", "Comma separated IDs of the records")
+	viper.BindPFlag("Explain.IDs", explainCmd.Flags().Lookup("ids"))
+	explainCmd.Flags().String("perm", "read", "Comma separated permissions among 'read', 'write', 'create', 'unlink' or 'all'")
+	viper.BindPFlag("Explain.Perm", explainCmd.Flags().Lookup("perm"))
+	YEPCmd.AddCommand(explainCmd)
+}
+
+var explainTemplate = template.Must(template.New("").Parse(`
+// This file is autogenerated by yep-server
+// DO NOT MODIFY THIS FILE - ANY CHANGES WILL BE OVERWRITTEN
+
+package main
+
+import (
+	"github.com/npiganeau/yep/cmd"
+{{ range .Imports }}	_ "{{ . }}"
+{{ end }}
+)
+
+func main() {
+	cmd.ExplainAccess({{ .Config }})
+}
+`))
@@ -0,0 +1,91 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"text/template"
+
+	"github.com/npiganeau/yep/yep/controllers"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const openAPIFileName = "openapi.go"
+
+var openAPICmd = &cobra.Command{
+	Use:   "openapi [projectDir]",
+	Short: "Write the OpenAPI document of the REST API",
+	Long: `Write the OpenAPI 3 document of the REST API of the project in 'projectDir'.
+The document describes the fields and the exposed methods of all the models
+of the project's modules, so that clients can be generated from it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectDir := "."
+		if len(args) > 0 {
+			projectDir = args[0]
+		}
+		generateAndRunFile(projectDir, openAPIFileName, openAPITemplate)
+	},
+}
+
+// WriteOpenAPI writes the OpenAPI document of the REST API to the file given
+// by the OpenAPI.Output configuration key, or to the standard output if it is
+// "-". It is meant to be called from a project start file which imports all
+// the project's module.
+func WriteOpenAPI(config map[string]interface{}) {
+	setupConfig(config)
+	connectToDB()
+	models.BootStrap()
+	data, err := json.MarshalIndent(controllers.OpenAPIDocument(), "", "  ")
+	if err != nil {
+		log.Panic("Unable to marshal OpenAPI document", "error", err)
+	}
+	data = append(data, '\n')
+	output := viper.GetString("OpenAPI.Output")
+	if output == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(output, data, 0644); err != nil {
+		log.Panic("Unable to write OpenAPI document", "file", output, "error", err)
+	}
+	log.Info("OpenAPI document written", "file", output)
+}
+
+func initOpenAPI() {
+	openAPICmd.Flags().StringP("output", "O", "openapi.json", "File to write the document to, or '-' for the standard output")
+	viper.BindPFlag("OpenAPI.Output", openAPICmd.Flags().Lookup("output"))
+	YEPCmd.AddCommand(openAPICmd)
+}
+
+var openAPITemplate = template.Must(template.New("").Parse(`
+// This file is autogenerated by yep-server
+// DO NOT MODIFY THIS FILE - ANY CHANGES WILL BE OVERWRITTEN
+
+package main
+
+import (
+	"github.com/npiganeau/yep/cmd"
+{{ range .Imports }}	_ "{{ . }}"
+{{ end }}
+)
+
+func main() {
+	cmd.WriteOpenAPI({{ .Config }})
+}
+`))
@@ -80,7 +80,10 @@ func generateAndRunFile(projectDir, fileName string, tmpl *template.Template) {
 func StartServer(config map[string]interface{}) {
 	setupConfig(config)
 	connectToDB()
+	server.ConfigureSessions()
+	server.ConfigureTrustedProxies()
 	models.BootStrap()
+	models.StartBus()
 	server.LoadInternalResources()
 	views.BootStrap()
 	actions.BootStrap()
@@ -89,7 +92,7 @@ func StartServer(config map[string]interface{}) {
 	server.PostInit()
 	srv := server.GetServer()
 	log.Info("YEP is up and running")
-	srv.Run()
+	srv.ListenAndServe()
 }
 
 // setupConfig takes the given config map and stores it into the viper configuration
@@ -124,6 +127,12 @@ func connectToDB() {
 }
 
 func initServer() {
+	serverCmd.Flags().StringP("address", "a", ":8080", "Address on which the server listens, as 'host:port'")
+	viper.BindPFlag("Server.Address", serverCmd.Flags().Lookup("address"))
+	serverCmd.Flags().String("tls-cert", "", "Certificate file to serve HTTPS. Requires --tls-key.")
+	viper.BindPFlag("Server.CertFile", serverCmd.Flags().Lookup("tls-cert"))
+	serverCmd.Flags().String("tls-key", "", "Private key file of the TLS certificate")
+	viper.BindPFlag("Server.KeyFile", serverCmd.Flags().Lookup("tls-key"))
 	YEPCmd.AddCommand(serverCmd)
 }
 
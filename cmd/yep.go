@@ -57,4 +57,6 @@ func init() {
 	initGenerate()
 	initServer()
 	initUpdateDB()
+	initExplain()
+	initOpenAPI()
 }
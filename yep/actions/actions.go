@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/models/types"
 	"github.com/npiganeau/yep/yep/tools/etree"
 	"github.com/npiganeau/yep/yep/tools/xmlutils"
@@ -161,6 +162,16 @@ type BaseAction struct {
 	//Flags interface{}`json:"flags"`
 }
 
+// DomainCondition returns the Condition of the Domain of this action on its
+// model for the user with the given uid, or nil if the action has no domain.
+func (a *BaseAction) DomainCondition(uid int64) (*models.Condition, error) {
+	model, ok := models.Registry.Get(a.Model)
+	if !ok {
+		return nil, fmt.Errorf("unknown model %s in action %s", a.Model, a.ID)
+	}
+	return models.ParseDomain(model, uid, a.Domain)
+}
+
 // LoadFromEtree reads the action given etree.Element, creates or updates the action
 // and adds it to the action registry if it not already.
 func LoadFromEtree(element *etree.Element) {
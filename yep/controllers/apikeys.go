@@ -0,0 +1,52 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// authenticateAPIKey is the function used by BearerAuth to check API keys.
+// It is a variable so that it can be replaced in tests.
+var authenticateAPIKey = models.AuthenticateAPIKey
+
+// BearerAuth returns a middleware that authenticates requests bearing an API
+// key in an "Authorization: Bearer <key>" header. The key must be allowed for
+// the given scope, or for any scope if scope is empty.
+//
+// If the key is valid, the id of its user is set as "uid" in the context so
+// that it is returned by the context's UID method, and the request is limited
+// by RateLimitByUser if it is in the chain. Requests with an invalid
+// key are aborted with a 401 status. Requests without Authorization header
+// are passed on untouched, so that they can be authenticated by their session.
+//
+// Add it to a Group with AddMiddleWare:
+//
+//	controllers.Registry.GetGroup("/web").AddMiddleWare(controllers.BearerAuth("rpc"))
+func BearerAuth(scope string) server.HandlerFunc {
+	return func(ctx *server.Context) {
+		header := ctx.Request.Header.Get("Authorization")
+		if header == "" {
+			return
+		}
+		const prefix = "bearer "
+		if len(header) <= len(prefix) || strings.ToLower(header[:len(prefix)]) != prefix {
+			ctx.Header("WWW-Authenticate", `Bearer realm="yep"`)
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		uid, err := authenticateAPIKey(strings.TrimSpace(header[len(prefix):]), scope)
+		if err != nil {
+			ctx.Header("WWW-Authenticate", `Bearer realm="yep", error="invalid_token"`)
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		ctx.Set("uid", uid)
+		limitAuthenticatedUser(ctx, uid)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBearerAuth(t *testing.T) {
+	Convey("Testing bearer token authentication", t, func() {
+		authenticateAPIKey = func(key, scope string) (int64, error) {
+			if key == "good.key" && scope == "rpc" {
+				return 42, nil
+			}
+			return 0, security.InvalidCredentialsError(key)
+		}
+		registry := newGroup("/")
+		grp := registry.AddGroup("/rpc")
+		grp.AddMiddleWare(BearerAuth("rpc"))
+		grp.AddController(http.MethodGet, "/uid", func(ctx *server.Context) {
+			ctx.String(http.StatusOK, fmt.Sprintf("%d", ctx.UID()))
+		})
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		request := func(authorization string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, "/rpc/uid", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		Convey("A valid key should set the uid", func() {
+			r := request("Bearer good.key")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldEqual, "42")
+		})
+		Convey("Invalid keys or headers should be rejected", func() {
+			r := request("Bearer bad.key")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			So(r.Header().Get("WWW-Authenticate"), ShouldContainSubstring, "invalid_token")
+			r = request("Basic Zm9vOmJhcg==")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		Convey("Requests without Authorization header should pass through", func() {
+			r := request("")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldEqual, "0")
+		})
+	})
+}
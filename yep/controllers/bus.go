@@ -0,0 +1,179 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// BusPollTimeout is the time after which long-polling requests
+// to the bus respond without notification.
+var BusPollTimeout = 50 * time.Second
+
+// busUpgrader upgrades the bus requests to WebSocket connections.
+// Only requests from the same origin are accepted.
+var busUpgrader = websocket.Upgrader{}
+
+// A busSubscription is a set of channels a client
+// subscribes to, with the id of the last message it has received.
+type busSubscription struct {
+	Channels []string `json:"channels"`
+	Last     int64    `json:"last"`
+}
+
+// busResponse is the response to a client of the bus. Last is
+// the id of the last message sent to the client so far.
+type busResponse struct {
+	Last          int64                    `json:"last"`
+	Notifications []models.BusNotification `json:"notifications"`
+}
+
+// check returns an error if the user with the given uid is not allowed to
+// subscribe to all the channels of this subscription. If Last is 0, it is
+// set to the id of the last message published on the bus.
+func (bs *busSubscription) check(uid int64) error {
+	for _, channel := range bs.Channels {
+		if !models.CanSubscribe(uid, channel) {
+			return fmt.Errorf("not allowed to subscribe to channel %s", channel)
+		}
+	}
+	if bs.Last <= 0 {
+		bs.Last = models.LastBusNotificationID()
+	}
+	return nil
+}
+
+// wait waits for the messages of this subscription and returns the response
+// to send to the client. Last is updated to the last received message.
+func (bs *busSubscription) wait(ctx context.Context) busResponse {
+	res := busResponse{Notifications: []models.BusNotification{}}
+	notifs := models.WaitBusNotifications(ctx, bs.Channels, bs.Last, BusPollTimeout)
+	if len(notifs) > 0 {
+		res.Notifications = notifs
+		bs.Last = notifs[len(notifs)-1].ID
+	}
+	res.Last = bs.Last
+	return res
+}
+
+// BusPoll returns the messages published on the channels of the "channels"
+// query parameter, a comma separated list, after the message whose id is
+// the "last" query parameter. If there are none, it waits for new messages
+// for at most BusPollTimeout.
+//
+// Clients must send the "last" id of the response in their next request. If
+// "last" is not given, only the messages published from now on are returned.
+func BusPoll(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	var sub busSubscription
+	if channels := ctx.Query("channels"); channels != "" {
+		sub.Channels = strings.Split(channels, ",")
+	}
+	if last := ctx.Query("last"); last != "" {
+		var err error
+		if sub.Last, err = strconv.ParseInt(last, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid last id %s", last)})
+			return
+		}
+	}
+	if err := sub.check(uid); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, sub.wait(ctx.Request.Context()))
+}
+
+// BusWebSocket upgrades the request to a WebSocket connection on which
+// messages are pushed to the client as they are published.
+//
+// The client subscribes to channels by sending a JSON object with the
+// "channels" to subscribe to and the "last" message id it has received.
+// Each new subscription replaces the previous one. The server sends JSON
+// objects with the "notifications" and the "last" message id, or with an
+// "error" if the subscription is not allowed.
+func BusWebSocket(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	conn, err := busUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// The upgrader has already responded to the client
+		log.Info("Unable to upgrade bus connection", "uid", uid, "error", err)
+		return
+	}
+	defer conn.Close()
+	wsCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subs := make(chan busSubscription)
+	go func() {
+		// Read the subscriptions of the client until the connection is closed
+		defer cancel()
+		for {
+			var sub busSubscription
+			if err := conn.ReadJSON(&sub); err != nil {
+				return
+			}
+			select {
+			case subs <- sub:
+			case <-wsCtx.Done():
+				return
+			}
+		}
+	}()
+	var sub busSubscription
+	for {
+		waitCtx, waitCancel := context.WithCancel(wsCtx)
+		responses := make(chan busResponse, 1)
+		go func(s busSubscription) {
+			responses <- s.wait(waitCtx)
+		}(sub)
+		select {
+		case newSub := <-subs:
+			waitCancel()
+			<-responses
+			if err := newSub.check(uid); err != nil {
+				conn.WriteJSON(gin.H{"error": err.Error()})
+				continue
+			}
+			sub = newSub
+		case res := <-responses:
+			waitCancel()
+			if len(res.Notifications) == 0 {
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			} else {
+				sub.Last = res.Last
+				err = conn.WriteJSON(res)
+			}
+			if err != nil {
+				return
+			}
+		case <-wsCtx.Done():
+			waitCancel()
+			return
+		}
+	}
+}
+
+// declareBusControllers adds the bus controllers to the given group. API keys
+// with the "bus" scope are accepted as bearer tokens.
+func declareBusControllers(grp *Group) {
+	busGrp := grp.AddGroup("/bus")
+	busGrp.AddMiddleWare(BearerAuth("bus"))
+	busGrp.AddController(http.MethodGet, "/poll", BusPoll)
+	busGrp.AddController(http.MethodGet, "/websocket", BusWebSocket)
+}
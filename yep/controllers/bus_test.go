@@ -0,0 +1,55 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBus(t *testing.T) {
+	Convey("Testing bus requests validation", t, func() {
+		authenticateAPIKey = func(key, scope string) (int64, error) {
+			if key == "good.key" && scope == "bus" {
+				return 7, nil
+			}
+			return 0, security.InvalidCredentialsError(key)
+		}
+		Reset(func() {
+			authenticateAPIKey = models.AuthenticateAPIKey
+		})
+		registry := newGroup("/")
+		declareBusControllers(registry)
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		poll := func(query string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, "/bus/poll?"+query, nil)
+			req.Header.Set("Authorization", "Bearer good.key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		Convey("Unauthenticated requests should be rejected", func() {
+			r := performRequest(srv, http.MethodGet, "/bus/poll?channels=user:7")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			r = performRequest(srv, http.MethodGet, "/bus/websocket")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		Convey("Subscriptions to other users channels should be forbidden", func() {
+			So(poll("channels=user:8").Code, ShouldEqual, http.StatusForbidden)
+			So(poll("channels=user:7,user:8").Code, ShouldEqual, http.StatusForbidden)
+		})
+		Convey("Subscriptions to unknown channels should be forbidden", func() {
+			So(poll("channels=unknown:7").Code, ShouldEqual, http.StatusForbidden)
+		})
+		Convey("Invalid last ids should be rejected", func() {
+			So(poll("channels=user:7&last=abc").Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
@@ -0,0 +1,565 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// gqlEnvKey is the key of the Environment in the context of GraphQL resolvers
+type gqlEnvKey struct{}
+
+// gqlSchema is the GraphQL schema of the models, built on first use
+var gqlSchema struct {
+	sync.Once
+	schema graphql.Schema
+	err    error
+}
+
+// gqlFilter is the input type of the filters of the GraphQL queries
+var gqlFilter = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "Filter",
+	Description: "A condition on a field path. Op is one of eq, ne, gt, ge, lt, le, like, nlike, " +
+		"ilike, nilike, in, nin and child_of. The in and nin operators take values instead of value.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"path":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"op":     &graphql.InputObjectFieldConfig{Type: graphql.String, DefaultValue: "eq"},
+		"value":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"values": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+	},
+})
+
+// A gqlRecord is a record returned by a GraphQL resolver. It belongs to the
+// batch of all the records returned by the same resolver, so that the related
+// records of all the records of the batch can be loaded at once.
+type gqlRecord struct {
+	rec   models.RecordCollection
+	batch *gqlBatch
+}
+
+// A gqlBatch is a set of records returned by the same resolver.
+// related holds the related records of the batch, mapped by field name.
+type gqlBatch struct {
+	rs      models.RecordCollection
+	records []*gqlRecord
+	related map[string]*gqlRelation
+}
+
+// A gqlRelation holds the related records of the records of a batch
+// through a relation field, mapped by the ids of the records of the batch.
+type gqlRelation struct {
+	records map[int64][]*gqlRecord
+}
+
+// newGQLBatch returns a new gqlBatch with the records of rs,
+// which are all loaded from the database with a single query.
+func newGQLBatch(rs models.RecordCollection) *gqlBatch {
+	batch := &gqlBatch{
+		rs:      rs,
+		related: make(map[string]*gqlRelation),
+	}
+	for _, rec := range rs.Records() {
+		batch.records = append(batch.records, &gqlRecord{rec: rec, batch: batch})
+	}
+	return batch
+}
+
+// relation returns the records related to the records of this batch
+// through the given field. They are loaded for all the records of the
+// batch on the first call and searched, so that record rules apply.
+func (b *gqlBatch) relation(field *models.Field) *gqlRelation {
+	if rel, ok := b.related[field.Name()]; ok {
+		return rel
+	}
+	rel := &gqlRelation{records: make(map[int64][]*gqlRecord)}
+	b.related[field.Name()] = rel
+	relatedIds := b.rs.RelatedIds(field.Name())
+	var allIds []int64
+	for _, ids := range relatedIds {
+		allIds = append(allIds, ids...)
+	}
+	if len(allIds) == 0 {
+		return rel
+	}
+	relModel := models.Registry.MustGet(field.RelatedModelName())
+	relRS := b.rs.Env().Pool(relModel.Name()).Call("Search", relModel.Field("id").In(allIds)).(models.RecordSet).Collection()
+	byID := make(map[int64]*gqlRecord)
+	for _, rec := range newGQLBatch(relRS).records {
+		byID[rec.rec.Ids()[0]] = rec
+	}
+	for id, ids := range relatedIds {
+		for _, relID := range ids {
+			if rec, ok := byID[relID]; ok {
+				rel.records[id] = append(rel.records[id], rec)
+			}
+		}
+	}
+	return rel
+}
+
+// gqlEnv returns the Environment of the given GraphQL resolver params
+func gqlEnv(p graphql.ResolveParams) models.Environment {
+	return p.Context.Value(gqlEnvKey{}).(models.Environment)
+}
+
+// gqlName returns the name of the GraphQL query fields of the given
+// model, that is its name with a lower case first letter.
+func gqlName(model *models.Model) string {
+	name := model.Name()
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// gqlScalarType returns the GraphQL type of the
+// values of the given non relation field type.
+func gqlScalarType(typ fieldtype.Type) *graphql.Scalar {
+	switch typ {
+	case fieldtype.Boolean:
+		return graphql.Boolean
+	case fieldtype.Integer:
+		return graphql.Int
+	case fieldtype.Float:
+		return graphql.Float
+	}
+	return graphql.String
+}
+
+// gqlModels returns the models that are available through
+// GraphQL, that is all models but mixins and M2M link models.
+func gqlModels() []*models.Model {
+	var res []*models.Model
+	for _, model := range models.Registry.All() {
+		if model.IsMixin() || model.IsM2MLink() {
+			continue
+		}
+		res = append(res, model)
+	}
+	return res
+}
+
+// GraphQLSchema returns the GraphQL schema of the models. It has an object
+// type for each model, a query field to search records of each model and
+// mutation fields to create, update and delete them.
+//
+// The schema is built on the first call, which must be done
+// after the models have been bootstrapped.
+func GraphQLSchema() (graphql.Schema, error) {
+	gqlSchema.Do(func() {
+		gqlSchema.schema, gqlSchema.err = newGraphQLSchema()
+	})
+	return gqlSchema.schema, gqlSchema.err
+}
+
+// newGraphQLSchema builds the GraphQL schema of the models
+func newGraphQLSchema() (graphql.Schema, error) {
+	objects := make(map[string]*graphql.Object)
+	queryFields := make(graphql.Fields)
+	mutationFields := make(graphql.Fields)
+	for _, model := range gqlModels() {
+		objects[model.Name()] = newGQLObject(model, objects)
+	}
+	for _, model := range gqlModels() {
+		addGQLQueryFields(queryFields, model, objects[model.Name()])
+		addGQLMutationFields(mutationFields, model, objects[model.Name()])
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queryFields}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutationFields}),
+	})
+}
+
+// newGQLObject returns the GraphQL object type of the given model. Relation
+// fields are resolved as the object types of objects, which are looked up
+// lazily since models may reference each other.
+func newGQLObject(model *models.Model, objects map[string]*graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: model.Name(),
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.ID),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*gqlRecord).rec.Ids()[0], nil
+					},
+				},
+			}
+			for _, field := range model.Fields().All() {
+				if field.JSON() == "id" {
+					continue
+				}
+				if !field.Type().IsRelationType() {
+					fields[field.JSON()] = gqlScalarField(field)
+					continue
+				}
+				relObject, ok := objects[field.RelatedModelName()]
+				if !ok {
+					continue
+				}
+				fields[field.JSON()] = gqlRelationField(field, relObject)
+			}
+			return fields
+		}),
+	})
+}
+
+// gqlScalarField returns the GraphQL field of the given non relation field
+func gqlScalarField(field *models.Field) *graphql.Field {
+	return &graphql.Field{
+		Type:        gqlScalarType(field.Type()),
+		Description: field.Help(),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			switch value := p.Source.(*gqlRecord).rec.Get(field.Name()).(type) {
+			case types.Date:
+				if value.IsNull() {
+					return nil, nil
+				}
+				return time.Time(value).Format("2006-01-02"), nil
+			case types.DateTime:
+				if value.IsNull() {
+					return nil, nil
+				}
+				return time.Time(value).Format("2006-01-02 15:04:05"), nil
+			default:
+				return value, nil
+			}
+		},
+	}
+}
+
+// gqlRelationField returns the GraphQL field of the given relation field. The
+// related records are loaded for all the records of the batch of the source
+// record at once.
+func gqlRelationField(field *models.Field, relObject *graphql.Object) *graphql.Field {
+	if field.Type().Is2OneRelationType() {
+		return &graphql.Field{
+			Type:        relObject,
+			Description: field.Help(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				src := p.Source.(*gqlRecord)
+				records := src.batch.relation(field).records[src.rec.Ids()[0]]
+				if len(records) == 0 {
+					return nil, nil
+				}
+				return records[0], nil
+			},
+		}
+	}
+	return &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(relObject))),
+		Description: field.Help(),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			src := p.Source.(*gqlRecord)
+			records := src.batch.relation(field).records[src.rec.Ids()[0]]
+			if records == nil {
+				records = []*gqlRecord{}
+			}
+			return records, nil
+		},
+	}
+}
+
+// addGQLQueryFields adds to fields the query fields of the given model:
+// <model> to search records and <model>Count to count them.
+func addGQLQueryFields(fields graphql.Fields, model *models.Model, object *graphql.Object) {
+	filterArg := &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.NewNonNull(gqlFilter)),
+		Description: "Conditions that the records must all match",
+	}
+	fields[gqlName(model)] = &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(object))),
+		Description: fmt.Sprintf("Search the %s records matching the given filters", model.Name()),
+		Args: graphql.FieldConfigArgument{
+			"filter": filterArg,
+			"order": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "Field paths to sort the records by. Paths prefixed by '-' are sorted in descending order.",
+			},
+			"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Maximum number of records to return"},
+			"offset": &graphql.ArgumentConfig{Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			rs, err := gqlSearch(gqlEnv(p), model, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			if order, ok := p.Args["order"].([]interface{}); ok && len(order) > 0 {
+				exprs := make([]string, len(order))
+				for i, expr := range order {
+					exprs[i] = expr.(string)
+				}
+				orderExprs, err := restOrder(model, gqlEnv(p).Uid(), strings.Join(exprs, ","))
+				if err != nil {
+					return nil, err
+				}
+				orderArgs := make([]interface{}, len(orderExprs))
+				for i, expr := range orderExprs {
+					orderArgs[i] = expr
+				}
+				rs = rs.Call("OrderBy", orderArgs...).(models.RecordSet).Collection()
+			}
+			if offset, ok := p.Args["offset"].(int); ok && offset > 0 {
+				rs = rs.Call("Offset", offset).(models.RecordSet).Collection()
+			}
+			if limit, ok := p.Args["limit"].(int); ok && limit > 0 {
+				rs = rs.Call("Limit", limit).(models.RecordSet).Collection()
+			}
+			return newGQLBatch(rs).records, nil
+		},
+	}
+	fields[gqlName(model)+"Count"] = &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: fmt.Sprintf("Count the %s records matching the given filters", model.Name()),
+		Args:        graphql.FieldConfigArgument{"filter": filterArg},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			rs, err := gqlSearch(gqlEnv(p), model, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			return rs.SearchCount(), nil
+		},
+	}
+}
+
+// gqlSearch returns the records of the given model
+// matching the "filter" argument of the given args.
+func gqlSearch(env models.Environment, model *models.Model, args map[string]interface{}) (models.RecordCollection, error) {
+	rs := env.Pool(model.Name()).Call("FetchAll").(models.RecordSet).Collection()
+	filters, _ := args["filter"].([]interface{})
+	var cond *models.Condition
+	for _, f := range filters {
+		filter := f.(map[string]interface{})
+		path := filter["path"].(string)
+		opName, _ := filter["op"].(string)
+		op, ok := restOperators[opName]
+		if !ok {
+			return rs, fmt.Errorf("unknown operator %s", opName)
+		}
+		if err := checkFieldPath(model, env.Uid(), path); err != nil {
+			return rs, err
+		}
+		var arg interface{} = filter["value"]
+		if op.IsMulti() {
+			values, _ := filter["values"].([]interface{})
+			strValues := make([]string, len(values))
+			for i, v := range values {
+				strValues[i] = v.(string)
+			}
+			arg = strValues
+		}
+		if cond == nil {
+			cond = model.Field(path).AddOperator(op, arg)
+			continue
+		}
+		cond = cond.And().Field(path).AddOperator(op, arg)
+	}
+	if cond != nil {
+		rs = rs.Call("Search", cond).(models.RecordSet).Collection()
+	}
+	return rs, nil
+}
+
+// gqlInput returns the GraphQL input type of the values of the records of the
+// given model. Relation fields take ids. Read only and One2Many fields are
+// not included.
+func gqlInput(model *models.Model) *graphql.InputObject {
+	fields := make(graphql.InputObjectConfigFieldMap)
+	for _, field := range model.Fields().All() {
+		if field.IsReadOnly() {
+			continue
+		}
+		var typ graphql.Input
+		switch {
+		case field.Type().Is2OneRelationType() && !field.Type().IsReverseRelationType():
+			typ = graphql.ID
+		case field.Type() == fieldtype.Many2Many:
+			typ = graphql.NewList(graphql.NewNonNull(graphql.ID))
+		case field.Type().IsRelationType():
+			continue
+		default:
+			typ = gqlScalarType(field.Type())
+		}
+		fields[field.JSON()] = &graphql.InputObjectFieldConfig{Type: typ, Description: field.Help()}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   model.Name() + "Input",
+		Fields: fields,
+	})
+}
+
+// gqlValues returns the given values of a GraphQL input
+// object as a FieldMap, with ids converted to int64.
+func gqlValues(model *models.Model, values map[string]interface{}) (models.FieldMap, error) {
+	res := make(models.FieldMap)
+	for name, value := range values {
+		field := model.Fields().MustGet(name)
+		switch {
+		case field.Type().Is2OneRelationType():
+			if value == nil {
+				res[name] = nil
+				continue
+			}
+			id, err := strconv.ParseInt(value.(string), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid id %s for field %s", value, name)
+			}
+			res[name] = id
+		case field.Type() == fieldtype.Many2Many:
+			var ids []int64
+			values, _ := value.([]interface{})
+			for _, v := range values {
+				id, err := strconv.ParseInt(v.(string), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid id %s for field %s", v, name)
+				}
+				ids = append(ids, id)
+			}
+			res[name] = ids
+		default:
+			res[name] = value
+		}
+	}
+	return res, nil
+}
+
+// gqlID returns the "id" argument of the given args as an int64
+func gqlID(args map[string]interface{}) (int64, error) {
+	id, err := strconv.ParseInt(fmt.Sprintf("%v", args["id"]), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id %v", args["id"])
+	}
+	return id, nil
+}
+
+// addGQLMutationFields adds to fields the mutation fields of the given model:
+// create<Model>, update<Model> and delete<Model>.
+func addGQLMutationFields(fields graphql.Fields, model *models.Model, object *graphql.Object) {
+	input := gqlInput(model)
+	fields["create"+model.Name()] = &graphql.Field{
+		Type:        object,
+		Description: fmt.Sprintf("Create a %s record", model.Name()),
+		Args: graphql.FieldConfigArgument{
+			"values": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			values, err := gqlValues(model, p.Args["values"].(map[string]interface{}))
+			if err != nil {
+				return nil, err
+			}
+			rs := gqlEnv(p).Pool(model.Name()).Call("Create", values).(models.RecordSet).Collection()
+			return newGQLBatch(rs).records[0], nil
+		},
+	}
+	fields["update"+model.Name()] = &graphql.Field{
+		Type:        object,
+		Description: fmt.Sprintf("Update the %s record with the given id", model.Name()),
+		Args: graphql.FieldConfigArgument{
+			"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			"values": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := gqlID(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			values, err := gqlValues(model, p.Args["values"].(map[string]interface{}))
+			if err != nil {
+				return nil, err
+			}
+			rs, err := searchRecord(gqlEnv(p), model, id)
+			if err != nil {
+				return nil, err
+			}
+			rs.Call("Write", values)
+			return newGQLBatch(rs).records[0], nil
+		},
+	}
+	fields["delete"+model.Name()] = &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Boolean),
+		Description: fmt.Sprintf("Delete the %s record with the given id", model.Name()),
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := gqlID(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			rs, err := searchRecord(gqlEnv(p), model, id)
+			if err != nil {
+				return nil, err
+			}
+			rs.Call("Unlink")
+			return true, nil
+		},
+	}
+}
+
+// A gqlRequest is the body of a GraphQL request
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// GraphQL executes the GraphQL request of the request body as the user of
+// the request. The whole request is executed in a single Environment, that
+// is in a single transaction, which is rolled back if any error occurs.
+// In this case, no data is returned.
+func GraphQL(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	var req gqlRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON object: %s", err)})
+		return
+	}
+	schema, err := GraphQLSchema()
+	if err != nil {
+		log.Panic("Unable to build GraphQL schema", "error", err)
+	}
+	var res *graphql.Result
+	err = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		res = graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        context.WithValue(ctx.Request.Context(), gqlEnvKey{}, env),
+		})
+		if res.HasErrors() {
+			res.Data = nil
+			log.Panic("GraphQL request failed, rolling back", "errors", res.Errors)
+		}
+	})
+	if res == nil {
+		// The request failed outside of the resolvers
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": strings.SplitN(err.Error(), "\n", 2)[0]})
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// declareGraphQLControllers adds the GraphQL endpoint to the "/api" group of
+// the given group, which must have been created before. API keys with the
+// "graphql" scope are accepted as bearer tokens.
+func declareGraphQLControllers(grp *Group) {
+	gqlGrp := grp.GetGroup("/api").AddGroup("/graphql")
+	gqlGrp.AddMiddleWare(BearerAuth("graphql"))
+	gqlGrp.AddController(http.MethodPost, "", GraphQL)
+}
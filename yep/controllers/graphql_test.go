@@ -0,0 +1,40 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraphQL(t *testing.T) {
+	Convey("Testing the GraphQL schema", t, func() {
+		schema, err := GraphQLSchema()
+		So(err, ShouldBeNil)
+		So(schema.Type("Users"), ShouldNotBeNil)
+		So(schema.Type("CommonMixin"), ShouldBeNil)
+		So(schema.Type("UsersInput"), ShouldNotBeNil)
+		queries := schema.QueryType().Fields()
+		So(queries, ShouldContainKey, "users")
+		So(queries, ShouldContainKey, "usersCount")
+		So(queries["users"].Args, ShouldNotBeEmpty)
+		mutations := schema.MutationType().Fields()
+		So(mutations, ShouldContainKey, "createUsers")
+		So(mutations, ShouldContainKey, "updateUsers")
+		So(mutations, ShouldContainKey, "deleteUsers")
+	})
+	Convey("Testing GraphQL requests validation", t, func() {
+		registry := newGroup("/")
+		declareRESTControllers(registry)
+		declareGraphQLControllers(registry)
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		Convey("Unauthenticated requests should be rejected", func() {
+			r := performRequest(srv, http.MethodPost, "/api/graphql")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
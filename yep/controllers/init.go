@@ -10,13 +10,24 @@ import (
 
 var log *logging.Logger
 
-// BootStrap creates the actual controllers from the controllers registry.
+// BootStrap adds the rate limiting middlewares defined in the configuration,
+// sets the clients allowed to read the metrics and creates the actual
+// controllers from the controllers registry.
 // This function must be called before starting the http server.
 func BootStrap() {
+	configureLimits(Registry)
+	configureMetrics()
 	Registry.createRoutes(server.GetServer().Group("/"))
 }
 
 func init() {
 	log = logging.GetLogger("controllers")
 	Registry = newGroup("/")
+	declareAuthControllers(Registry)
+	declareMetricsControllers(Registry)
+	declareRESTControllers(Registry)
+	declareOpenAPIControllers(Registry)
+	declareGraphQLControllers(Registry)
+	declareXMLRPCControllers(Registry)
+	declareBusControllers(Registry)
 }
@@ -0,0 +1,178 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/ratelimit"
+	"github.com/spf13/viper"
+)
+
+// Keys of the values set in the context of requests by the middlewares of this file
+const (
+	userLimiterKey = "user_rate_limiter"
+	authFailedKey  = "auth_failed"
+)
+
+// RateLimitByIP returns a middleware that limits the rate of requests
+// per client IP address with the given limiter. Requests over the limit
+// are refused with a 429 Too Many Requests status.
+//
+// Add it to a Group with AddMiddleWare to limit the requests of this group:
+//
+//	grp.AddMiddleWare(controllers.RateLimitByIP(ratelimit.NewMemoryLimiter(5, 20)))
+func RateLimitByIP(limiter ratelimit.Limiter) server.HandlerFunc {
+	return func(ctx *server.Context) {
+		if ok, wait := limiter.Take("ip:" + ctx.ClientIP()); !ok {
+			tooManyRequests(ctx, wait)
+		}
+	}
+}
+
+// RateLimitByUser returns a middleware that limits the rate of requests per
+// authenticated user with the given limiter. Requests over the limit are
+// refused with a 429 Too Many Requests status, and unauthenticated requests
+// are not limited.
+//
+// Requests that are not authenticated yet when this middleware runs, such as
+// requests with an API key checked by BearerAuth further down the chain, are
+// limited once their user has been authenticated.
+func RateLimitByUser(limiter ratelimit.Limiter) server.HandlerFunc {
+	return func(ctx *server.Context) {
+		if uid := ctx.UID(); uid != 0 {
+			takeUserToken(ctx, limiter, uid)
+			return
+		}
+		ctx.Set(userLimiterKey, limiter)
+	}
+}
+
+// limitAuthenticatedUser limits the rate of requests of the user with the
+// given uid, who has just been authenticated for the request of the given
+// context, with the limiter set by RateLimitByUser if any. It returns false
+// if the request has been refused.
+func limitAuthenticatedUser(ctx *server.Context, uid int64) bool {
+	limiter, ok := ctx.Get(userLimiterKey)
+	if !ok {
+		return true
+	}
+	return takeUserToken(ctx, limiter.(ratelimit.Limiter), uid)
+}
+
+// takeUserToken takes a token from the bucket of the user with the given
+// uid in the given limiter and returns true. If the bucket is empty, it
+// refuses the request of the given context and returns false.
+func takeUserToken(ctx *server.Context, limiter ratelimit.Limiter, uid int64) bool {
+	ok, wait := limiter.Take(fmt.Sprintf("uid:%d", uid))
+	if !ok {
+		tooManyRequests(ctx, wait)
+	}
+	return ok
+}
+
+// LoginThrottle returns a middleware that limits the rate of failed
+// authentication attempts per client IP address with the given limiter.
+// Each response with a 401 Unauthorized status, or for which authFailed has
+// been called, takes a token from the bucket of the client, and requests of
+// clients with an empty bucket are refused with a 429 Too Many Requests
+// status without being authenticated.
+//
+// This protects logins against brute-force attacks from a single address.
+// Users are also locked out after models.MaxLoginFailures failed attempts.
+func LoginThrottle(limiter ratelimit.Limiter) server.HandlerFunc {
+	return func(ctx *server.Context) {
+		key := "ip:" + ctx.ClientIP()
+		if ok, wait := limiter.Available(key); !ok {
+			tooManyRequests(ctx, wait)
+			return
+		}
+		ctx.Next()
+		if _, failed := ctx.Get(authFailedKey); failed || ctx.Writer.Status() == http.StatusUnauthorized {
+			limiter.Take(key)
+		}
+	}
+}
+
+// authFailed records that the authentication of the request of the given
+// context has failed, so that it is counted by LoginThrottle. It is meant
+// for protocols such as XML-RPC that do not answer failed authentications
+// with a 401 Unauthorized status.
+func authFailed(ctx *server.Context) {
+	ctx.Set(authFailedKey, true)
+}
+
+// MaxBodySize returns a middleware that limits the size of request bodies
+// to the given number of bytes. Requests with a larger Content-Length are
+// refused with a 413 Request Entity Too Large status, and reading more than
+// size bytes of the body of other requests fails.
+func MaxBodySize(size int64) server.HandlerFunc {
+	return func(ctx *server.Context) {
+		if ctx.Request.ContentLength > size {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body larger than %d bytes", size)})
+			ctx.Abort()
+			return
+		}
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, size)
+		}
+	}
+}
+
+// tooManyRequests refuses the request of the given context with a 429
+// Too Many Requests status, telling the client to retry after wait.
+func tooManyRequests(ctx *server.Context, wait time.Duration) {
+	ctx.Header("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(wait.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+	ctx.Abort()
+}
+
+// configuredLimiter returns the limiter defined by the RateLimit.<name>.Rate
+// and RateLimit.<name>.Burst configuration keys, or nil if the rate is 0.
+// The limiter is shared by all the server instances through the database if
+// RateLimit.Shared is set.
+func configuredLimiter(name string) ratelimit.Limiter {
+	rate := viper.GetFloat64(fmt.Sprintf("RateLimit.%s.Rate", name))
+	burst := viper.GetInt(fmt.Sprintf("RateLimit.%s.Burst", name))
+	if rate <= 0 {
+		return nil
+	}
+	if viper.GetBool("RateLimit.Shared") {
+		return models.NewDBLimiter(name, rate, burst)
+	}
+	return ratelimit.NewMemoryLimiter(rate, burst)
+}
+
+// configureLimits adds the rate limiting and request size middlewares
+// defined in the configuration to the given root group and to its
+// authentication and XML-RPC groups.
+func configureLimits(grp *Group) {
+	viper.SetDefault("Server.MaxBodySize", 10<<20)
+	viper.SetDefault("RateLimit.PerIP.Rate", 50)
+	viper.SetDefault("RateLimit.PerIP.Burst", 200)
+	viper.SetDefault("RateLimit.PerUser.Rate", 20)
+	viper.SetDefault("RateLimit.PerUser.Burst", 100)
+	viper.SetDefault("RateLimit.LoginFailures.Rate", 1.0/60)
+	viper.SetDefault("RateLimit.LoginFailures.Burst", 10)
+	// Middlewares are prepended, so they run in the reverse order
+	if limiter := configuredLimiter("PerUser"); limiter != nil {
+		grp.AddMiddleWare(RateLimitByUser(limiter))
+	}
+	if size := int64(viper.GetInt("Server.MaxBodySize")); size > 0 {
+		grp.AddMiddleWare(MaxBodySize(size))
+	}
+	if limiter := configuredLimiter("PerIP"); limiter != nil {
+		grp.AddMiddleWare(RateLimitByIP(limiter))
+	}
+	if limiter := configuredLimiter("LoginFailures"); limiter != nil {
+		grp.GetGroup("/auth").AddMiddleWare(LoginThrottle(limiter))
+		grp.GetGroup("/xmlrpc/2").AddMiddleWare(LoginThrottle(limiter))
+	}
+}
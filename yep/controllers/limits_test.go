@@ -0,0 +1,114 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/ratelimit"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimits(t *testing.T) {
+	Convey("Testing rate limiting and request size middlewares", t, func() {
+		registry := newGroup("/")
+		grp := registry.AddGroup("/test")
+		grp.AddController(http.MethodPost, "/echo", func(ctx *server.Context) {
+			body, err := ioutil.ReadAll(ctx.Request.Body)
+			if err != nil {
+				ctx.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			ctx.String(http.StatusOK, string(body))
+		})
+		grp.AddController(http.MethodPost, "/login", func(ctx *server.Context) {
+			if ctx.PostForm("password") != "secret" {
+				ctx.Status(http.StatusUnauthorized)
+				return
+			}
+			ctx.Status(http.StatusOK)
+		})
+		request := func(path, body string, header ...string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if len(header) == 2 {
+				req.Header.Set(header[0], header[1])
+			}
+			w := httptest.NewRecorder()
+			srv := newServer()
+			registry.createRoutes(srv.Group("/"))
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		Convey("Requests should be limited per IP", func() {
+			grp.AddMiddleWare(RateLimitByIP(ratelimit.NewMemoryLimiter(0.5, 2)))
+			So(request("/test/echo", "a").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a").Code, ShouldEqual, http.StatusOK)
+			r := request("/test/echo", "a")
+			So(r.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(r.Header().Get("Retry-After"), ShouldEqual, "2")
+		})
+		Convey("Forwarded addresses should only be trusted from trusted proxies", func() {
+			grp.AddMiddleWare(RateLimitByIP(ratelimit.NewMemoryLimiter(0.5, 1)))
+			Reset(func() {
+				server.SetTrustedProxies(nil)
+			})
+			So(request("/test/echo", "a", "X-Forwarded-For", "198.51.100.1").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a", "X-Forwarded-For", "198.51.100.2").Code, ShouldEqual, http.StatusTooManyRequests)
+			So(server.SetTrustedProxies([]string{"192.0.2.0/24"}), ShouldBeNil)
+			So(request("/test/echo", "a", "X-Forwarded-For", "198.51.100.3, 192.0.2.5").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a", "X-Forwarded-For", "198.51.100.3").Code, ShouldEqual, http.StatusTooManyRequests)
+			So(request("/test/echo", "a", "X-Real-IP", "198.51.100.4").Code, ShouldEqual, http.StatusOK)
+			So(server.SetTrustedProxies([]string{"invalid"}), ShouldNotBeNil)
+		})
+		Convey("Requests should be limited per authenticated user", func() {
+			authenticateAPIKey = func(key, scope string) (int64, error) {
+				switch key {
+				case "key1.secret", "key1.other":
+					return 1, nil
+				case "key2.secret":
+					return 2, nil
+				}
+				return 0, security.InvalidCredentialsError(key)
+			}
+			Reset(func() {
+				authenticateAPIKey = models.AuthenticateAPIKey
+			})
+			grp.AddMiddleWare(BearerAuth(""))
+			grp.AddMiddleWare(RateLimitByUser(ratelimit.NewMemoryLimiter(0.5, 1)))
+			So(request("/test/echo", "a", "Authorization", "Bearer key1.secret").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a", "Authorization", "Bearer key1.other").Code, ShouldEqual, http.StatusTooManyRequests)
+			So(request("/test/echo", "a", "Authorization", "Bearer key1.wrong").Code, ShouldEqual, http.StatusUnauthorized)
+			So(request("/test/echo", "a", "Authorization", "Bearer key1.wrong").Code, ShouldEqual, http.StatusUnauthorized)
+			So(request("/test/echo", "a", "Authorization", "Bearer key2.secret").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/echo", "a").Code, ShouldEqual, http.StatusOK)
+		})
+		Convey("Request bodies should be limited in size", func() {
+			grp.AddMiddleWare(MaxBodySize(4))
+			r := request("/test/echo", "abcd")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldEqual, "abcd")
+			So(request("/test/echo", "abcde").Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+		Convey("Failed logins should be throttled per IP", func() {
+			grp.AddMiddleWare(LoginThrottle(ratelimit.NewMemoryLimiter(0.01, 2)))
+			So(request("/test/login", "password=secret").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/login", "password=secret").Code, ShouldEqual, http.StatusOK)
+			So(request("/test/login", "password=wrong").Code, ShouldEqual, http.StatusUnauthorized)
+			So(request("/test/login", "password=wrong").Code, ShouldEqual, http.StatusUnauthorized)
+			r := request("/test/login", "password=secret")
+			So(r.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(r.Header().Get("Retry-After"), ShouldEqual, "100")
+		})
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// Authentication functions used by the login controllers.
+// They are variables so that they can be replaced in tests.
+var (
+	authenticate         = security.AuthenticationRegistry.Authenticate
+	secondFactorRequired = models.SecondFactorRequired
+	verifySecondFactor   = models.VerifySecondFactor
+)
+
+// LogIn logs the user with the given uid and login in a new session of the
+// given context. If the user has enabled two-factor authentication, the
+// session is marked as waiting for the second factor, and the user is not
+// considered authenticated until SecondFactor has been called successfully.
+func LogIn(ctx *server.Context, uid int64, login string) {
+	sess := ctx.Session()
+	sess.Clear()
+	ctx.RenewSession()
+	sess.Set("uid", uid)
+	sess.Set("login", login)
+	if secondFactorRequired(uid) {
+		sess.Set("second_factor_pending", true)
+	}
+	sess.Save()
+}
+
+// Login authenticates the user with the "login" and "password" form values
+// and logs it in the session. The response tells whether the second factor
+// must be given before the user can access the application.
+func Login(ctx *server.Context) {
+	login := ctx.PostForm("login")
+	uid, err := authenticate(login, ctx.PostForm("password"), nil)
+	if err != nil {
+		log.Info("Login failed", "login", login, "error", err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid login or password"})
+		return
+	}
+	LogIn(ctx, uid, login)
+	ctx.JSON(http.StatusOK, gin.H{"uid": uid, "second_factor_required": ctx.SecondFactorPending()})
+}
+
+// SecondFactor checks the "code" form value against the TOTP secret or the
+// recovery codes of the user of the session, and completes its login if it
+// is valid.
+func SecondFactor(ctx *server.Context) {
+	if !ctx.SecondFactorPending() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no second factor is expected"})
+		return
+	}
+	sess := ctx.Session()
+	uid, _ := sess.Get("uid").(int64)
+	if !verifySecondFactor(uid, ctx.PostForm("code")) {
+		log.Info("Second factor verification failed", "uid", uid)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	sess.Delete("second_factor_pending")
+	sess.Save()
+	ctx.JSON(http.StatusOK, gin.H{"uid": uid})
+}
+
+// Logout logs the user out and deletes its session.
+func Logout(ctx *server.Context) {
+	sess := ctx.Session()
+	sess.Clear()
+	sess.Options(sessions.Options{Path: "/", MaxAge: -1})
+	sess.Save()
+	ctx.Status(http.StatusOK)
+}
+
+// RequireSecondFactor is a middleware that refuses the requests of sessions
+// whose user has logged in but has not given its second factor yet.
+// Requests to the /auth routes are allowed, so that the user can give its
+// second factor or log out.
+func RequireSecondFactor(ctx *server.Context) {
+	if ctx.SecondFactorPending() && !strings.HasPrefix(ctx.Request.URL.Path, "/auth/") {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "second factor authentication required"})
+		ctx.Abort()
+	}
+}
+
+// declareAuthControllers adds the authentication controllers to the given
+// group, and the RequireSecondFactor middleware to the group itself.
+func declareAuthControllers(grp *Group) {
+	grp.AddMiddleWare(RequireSecondFactor)
+	authGrp := grp.AddGroup("/auth")
+	authGrp.AddController(http.MethodPost, "/login", Login)
+	authGrp.AddController(http.MethodPost, "/totp", SecondFactor)
+	authGrp.AddController(http.MethodPost, "/logout", Logout)
+	declareOIDCControllers(authGrp)
+}
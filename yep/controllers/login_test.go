@@ -0,0 +1,124 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoginControllers(t *testing.T) {
+	Convey("Testing login controllers with two-factor authentication", t, func() {
+		authenticate = func(login, secret string, context *types.Context) (int64, error) {
+			switch {
+			case login == "totpuser" && secret == "secret":
+				return 7, nil
+			case login == "plainuser" && secret == "secret":
+				return 8, nil
+			}
+			return 0, security.InvalidCredentialsError(login)
+		}
+		secondFactorRequired = func(uid int64) bool {
+			return uid == 7
+		}
+		verifySecondFactor = func(uid int64, code string) bool {
+			return uid == 7 && code == "123456"
+		}
+		Reset(func() {
+			authenticate = security.AuthenticationRegistry.Authenticate
+			secondFactorRequired = models.SecondFactorRequired
+			verifySecondFactor = models.VerifySecondFactor
+		})
+		registry := newGroup("/")
+		declareAuthControllers(registry)
+		rpcGrp := registry.AddGroup("/rpc")
+		rpcGrp.AddController(http.MethodPost, "/uid", func(ctx *server.Context) {
+			ctx.RPC(http.StatusOK, ctx.UID())
+		})
+		registry.AddController(http.MethodGet, "/login", func(ctx *server.Context) {
+			ctx.String(http.StatusOK, "login")
+		})
+		srv := newServer()
+		srv.Use(sessions.Sessions("yep-session", sessions.NewCookieStore([]byte("test-secret"))))
+		registry.createRoutes(srv.Group("/"))
+
+		var cookie string
+		post := func(path, contentType, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if cookie != "" {
+				req.Header.Set("Cookie", cookie)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if setCookie := w.Header().Get("Set-Cookie"); setCookie != "" {
+				cookie = strings.Split(setCookie, ";")[0]
+			}
+			return w
+		}
+		get := func(path string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Cookie", cookie)
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		login := func(login, password string) *httptest.ResponseRecorder {
+			return post("/auth/login", "application/x-www-form-urlencoded",
+				url.Values{"login": {login}, "password": {password}}.Encode())
+		}
+		callUID := func() *httptest.ResponseRecorder {
+			return post("/rpc/uid", "application/json", `{"jsonrpc":"2.0","id":1,"method":"call","params":{}}`)
+		}
+		Convey("Wrong credentials should be refused", func() {
+			r := login("totpuser", "wrong")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		Convey("Users without second factor should be logged in directly", func() {
+			r := login("plainuser", "secret")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldContainSubstring, `"second_factor_required":false`)
+			r = callUID()
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldContainSubstring, `"result":8`)
+		})
+		Convey("Users with second factor should give their code", func() {
+			r := login("totpuser", "secret")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldContainSubstring, `"second_factor_required":true`)
+			r = callUID()
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			So(r.Body.String(), ShouldContainSubstring, "second factor authentication required")
+			r = get("/login")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			r = post("/auth/totp", "application/x-www-form-urlencoded", "code=000000")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			r = callUID()
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+			r = post("/auth/totp", "application/x-www-form-urlencoded", "code=123456")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			r = callUID()
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Body.String(), ShouldContainSubstring, `"result":7`)
+			r = get("/login")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			Convey("Logging out should clear the session", func() {
+				r = post("/auth/logout", "application/x-www-form-urlencoded", "")
+				So(r.Code, ShouldEqual, http.StatusOK)
+				r = callUID()
+				So(r.Body.String(), ShouldContainSubstring, `"result":0`)
+			})
+		})
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+// metricsHandler serves the metrics of the default prometheus registry
+var metricsHandler = promhttp.Handler()
+
+// metricsAccess holds the clients allowed to read the metrics.
+// It is set by configureMetrics.
+var metricsAccess struct {
+	// nets are the networks of the clients allowed without token
+	nets []*net.IPNet
+	// token is the bearer token that allows any client if not empty
+	token string
+}
+
+// Metrics exposes the metrics of the application in the Prometheus
+// text format. Metrics include HTTP requests, method calls, database
+// connections and transaction retries, as well as Go runtime metrics.
+//
+// Requests are refused with a 403 Forbidden status unless they come from
+// the Metrics.AllowedIPs networks or bear the Metrics.Token bearer token.
+func Metrics(c *server.Context) {
+	if !metricsAllowed(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
+
+// metricsAllowed returns true if the client of the request
+// of the given context is allowed to read the metrics.
+func metricsAllowed(c *server.Context) bool {
+	if metricsAccess.token != "" {
+		expected := []byte("Bearer " + metricsAccess.token)
+		if subtle.ConstantTimeCompare([]byte(c.Request.Header.Get("Authorization")), expected) == 1 {
+			return true
+		}
+	}
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range metricsAccess.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// configureMetrics sets the clients allowed to read the metrics from the
+// Metrics.AllowedIPs (local clients by default) and Metrics.Token
+// configuration keys.
+func configureMetrics() {
+	viper.SetDefault("Metrics.AllowedIPs", []string{"127.0.0.1", "::1"})
+	nets, err := server.ParseIPNets(viper.GetStringSlice("Metrics.AllowedIPs"))
+	if err != nil {
+		log.Panic("Invalid allowed IPs for metrics", "error", err)
+	}
+	metricsAccess.nets = nets
+	metricsAccess.token = viper.GetString("Metrics.Token")
+}
+
+// declareMetricsControllers adds the metrics controller to the given group
+func declareMetricsControllers(grp *Group) {
+	grp.AddController(http.MethodGet, "/metrics", Metrics)
+}
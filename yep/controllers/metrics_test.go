@@ -0,0 +1,58 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Testing metrics endpoint", t, func() {
+		registry := newGroup("/")
+		declareMetricsControllers(registry)
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		configureMetrics()
+		request := func(remoteAddr string, header ...string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = remoteAddr
+			if len(header) == 2 {
+				req.Header.Set(header[0], header[1])
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		Convey("Local clients should read the metrics", func() {
+			r := request("127.0.0.1:1234")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			So(r.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+			So(r.Body.String(), ShouldContainSubstring, "yep_transaction_retries_total 0")
+			So(r.Body.String(), ShouldContainSubstring, "yep_db_open_connections")
+		})
+		Convey("Other clients should be refused", func() {
+			So(request("192.0.2.1:1234").Code, ShouldEqual, http.StatusForbidden)
+			So(request("192.0.2.1:1234", "X-Forwarded-For", "127.0.0.1").Code, ShouldEqual, http.StatusForbidden)
+		})
+		Convey("Allowed networks and token should be configurable", func() {
+			viper.Set("Metrics.AllowedIPs", []string{"192.0.2.0/24"})
+			viper.Set("Metrics.Token", "metricstoken")
+			Reset(func() {
+				viper.Set("Metrics.AllowedIPs", []string{"127.0.0.1", "::1"})
+				viper.Set("Metrics.Token", "")
+				configureMetrics()
+			})
+			configureMetrics()
+			So(request("192.0.2.1:1234").Code, ShouldEqual, http.StatusOK)
+			So(request("127.0.0.1:1234").Code, ShouldEqual, http.StatusForbidden)
+			So(request("198.51.100.1:1234", "Authorization", "Bearer metricstoken").Code, ShouldEqual, http.StatusOK)
+			So(request("198.51.100.1:1234", "Authorization", "Bearer wrong").Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
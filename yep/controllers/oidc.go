@@ -0,0 +1,168 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/oidc"
+	"github.com/spf13/viper"
+)
+
+// oidcProvider is the OpenID Connect provider used for login.
+// It is created from the configuration on first use.
+var oidcProvider struct {
+	sync.Mutex
+	*oidc.Provider
+}
+
+// getOIDCProvider returns the OpenID Connect provider defined in
+// the configuration, or nil if OIDC login is not configured.
+func getOIDCProvider() (*oidc.Provider, error) {
+	if viper.GetString("OIDC.Issuer") == "" {
+		return nil, nil
+	}
+	oidcProvider.Lock()
+	defer oidcProvider.Unlock()
+	if oidcProvider.Provider != nil {
+		return oidcProvider.Provider, nil
+	}
+	provider, err := oidc.NewProvider(oidc.Config{
+		Issuer:       viper.GetString("OIDC.Issuer"),
+		ClientID:     viper.GetString("OIDC.ClientID"),
+		ClientSecret: viper.GetString("OIDC.ClientSecret"),
+		RedirectURL:  viper.GetString("OIDC.RedirectURL"),
+		Scopes:       viper.GetStringSlice("OIDC.Scopes"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider.Provider = provider
+	return provider, nil
+}
+
+// OIDCLogin redirects the user to the login page of the OpenID Connect provider.
+func OIDCLogin(ctx *server.Context) {
+	provider, err := getOIDCProvider()
+	if err != nil {
+		log.Warn("Unable to reach OIDC provider", "error", err)
+		ctx.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	if provider == nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	state, nonce := oidc.RandomString(), oidc.RandomString()
+	sess := ctx.Session()
+	sess.Set("oidc_state", state)
+	sess.Set("oidc_nonce", nonce)
+	sess.Save()
+	ctx.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce))
+}
+
+// OIDCCallback is called by the OpenID Connect provider after the user has
+// logged in. It validates the ID token, creates or updates the local user
+// from its claims and logs the user in.
+func OIDCCallback(ctx *server.Context) {
+	provider, err := getOIDCProvider()
+	if err != nil {
+		log.Warn("Unable to reach OIDC provider", "error", err)
+		ctx.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	if provider == nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	sess := ctx.Session()
+	state, _ := sess.Get("oidc_state").(string)
+	nonce, _ := sess.Get("oidc_nonce").(string)
+	sess.Delete("oidc_state")
+	sess.Delete("oidc_nonce")
+	sess.Save()
+	if state == "" || ctx.Query("state") != state {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if errCode := ctx.Query("error"); errCode != "" {
+		log.Info("OIDC login refused by provider", "error", errCode, "description", ctx.Query("error_description"))
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	rawToken, err := provider.Exchange(ctx.Query("code"))
+	if err != nil {
+		log.Warn("Unable to exchange OIDC authorization code", "error", err)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	claims, err := provider.VerifyIDToken(rawToken, nonce)
+	if err != nil {
+		log.Warn("Invalid OIDC ID token", "error", err)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	login, uid, err := oidcSyncUser(claims)
+	if err != nil {
+		log.Info("OIDC login failed", "login", login, "error", err)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	LogIn(ctx, uid, login)
+	ctx.Redirect(http.StatusFound, "/")
+}
+
+// oidcSyncUser creates or updates the local user matching the issuer and
+// subject of the given claims and returns its login and id.
+func oidcSyncUser(claims oidc.Claims) (string, int64, error) {
+	login := claims.String(viper.GetString("OIDC.LoginClaim"))
+	if login == "" {
+		login = claims.String("sub")
+	}
+	name := claims.String(viper.GetString("OIDC.NameClaim"))
+	if name == "" {
+		name = login
+	}
+	groupIDs, managed := oidcGroups(claims.Strings(viper.GetString("OIDC.GroupsClaim")),
+		viper.GetStringMapString("OIDC.GroupMapping"))
+	uid, err := models.SyncOIDCUser(claims.String("iss"), claims.String("sub"), login, name, groupIDs, managed,
+		!viper.GetBool("OIDC.NoUserCreation"))
+	return login, uid, err
+}
+
+// oidcGroups returns the IDs of the security groups mapped to the given
+// provider groups, and the IDs of all the security groups of the mapping.
+// Group names are case insensitive.
+func oidcGroups(groups []string, mapping map[string]string) ([]string, []string) {
+	lcMapping := make(map[string]string)
+	for grp, grpID := range mapping {
+		lcMapping[strings.ToLower(grp)] = grpID
+	}
+	var groupIDs, managed []string
+	for _, grp := range groups {
+		if grpID, ok := lcMapping[strings.ToLower(grp)]; ok {
+			groupIDs = append(groupIDs, grpID)
+		}
+	}
+	for _, grpID := range mapping {
+		managed = append(managed, grpID)
+	}
+	return groupIDs, managed
+}
+
+// declareOIDCControllers adds the OpenID Connect login controllers
+// to the given group.
+func declareOIDCControllers(grp *Group) {
+	viper.SetDefault("OIDC.Scopes", []string{"profile", "email"})
+	viper.SetDefault("OIDC.LoginClaim", "preferred_username")
+	viper.SetDefault("OIDC.NameClaim", "name")
+	viper.SetDefault("OIDC.GroupsClaim", "groups")
+	oidcGrp := grp.AddGroup("/oidc")
+	oidcGrp.AddController(http.MethodGet, "/login", OIDCLogin)
+	oidcGrp.AddController(http.MethodGet, "/callback", OIDCCallback)
+}
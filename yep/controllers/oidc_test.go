@@ -0,0 +1,76 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/npiganeau/yep/yep/tools/oidc"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestOIDCControllers(t *testing.T) {
+	Convey("Testing OpenID Connect login controllers", t, func() {
+		mock := oidc.NewMockProvider("yep", "secret")
+		defer mock.Close()
+		oidcProvider.Provider = nil
+		registry := newGroup("/")
+		declareAuthControllers(registry)
+		srv := newServer()
+		srv.Use(sessions.Sessions("yep-session", sessions.NewCookieStore([]byte("test-secret"))))
+		registry.createRoutes(srv.Group("/"))
+		Convey("Controllers should not be found if OIDC is not configured", func() {
+			viper.Set("OIDC.Issuer", "")
+			r := performRequest(srv, http.MethodGet, "/auth/oidc/login")
+			So(r.Code, ShouldEqual, http.StatusNotFound)
+		})
+		Convey("Login should redirect to the provider", func() {
+			viper.Set("OIDC.Issuer", mock.URL)
+			viper.Set("OIDC.ClientID", "yep")
+			viper.Set("OIDC.ClientSecret", "secret")
+			viper.Set("OIDC.RedirectURL", "http://localhost/auth/oidc/callback")
+			r := performRequest(srv, http.MethodGet, "/auth/oidc/login")
+			So(r.Code, ShouldEqual, http.StatusFound)
+			location, err := url.Parse(r.Header().Get("Location"))
+			So(err, ShouldBeNil)
+			So(location.Path, ShouldEqual, "/authorize")
+			So(location.Query().Get("client_id"), ShouldEqual, "yep")
+			So(location.Query().Get("redirect_uri"), ShouldEqual, "http://localhost/auth/oidc/callback")
+			So(location.Query().Get("state"), ShouldNotBeBlank)
+			So(location.Query().Get("nonce"), ShouldNotBeBlank)
+			So(r.Header().Get("Set-Cookie"), ShouldStartWith, "yep-session=")
+			Convey("Callback with a wrong state should fail", func() {
+				req, _ := http.NewRequest(http.MethodGet, "/auth/oidc/callback?code=abc&state=wrong", nil)
+				req.Header.Set("Cookie", strings.Split(r.Header().Get("Set-Cookie"), ";")[0])
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			})
+			Convey("Callback without session should fail", func() {
+				r := performRequest(srv, http.MethodGet, "/auth/oidc/callback?code=abc&state="+location.Query().Get("state"))
+				So(r.Code, ShouldEqual, http.StatusBadRequest)
+			})
+			Convey("Callback with an invalid code should fail", func() {
+				req, _ := http.NewRequest(http.MethodGet, "/auth/oidc/callback?code=abc&state="+location.Query().Get("state"), nil)
+				req.Header.Set("Cookie", strings.Split(r.Header().Get("Set-Cookie"), ";")[0])
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+		Convey("Provider groups should be mapped to security groups", func() {
+			groupIDs, managed := oidcGroups([]string{"Sales", "Other"},
+				map[string]string{"sales": "sale_user", "admins": "admin"})
+			So(groupIDs, ShouldResemble, []string{"sale_user"})
+			So(managed, ShouldHaveLength, 2)
+			So(managed, ShouldContain, "admin")
+		})
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/openapi"
+)
+
+const (
+	// OpenAPITitle is the title of the OpenAPI document of the web APIs
+	OpenAPITitle = "YEP API"
+	// OpenAPIVersion is the version of the web APIs in the OpenAPI document
+	OpenAPIVersion = "1"
+)
+
+// restAPIPath is the base path of the REST API
+const restAPIPath = "/api/v1"
+
+// OpenAPIDocument returns the OpenAPI document of the REST API, built from
+// the fields and the exposed methods of the models of the registry. Mixin
+// models and Many2Many link models are not included.
+func OpenAPIDocument() *openapi.Document {
+	doc := openapi.NewDocument(OpenAPITitle, OpenAPIVersion)
+	doc.Info.Description = "REST API over the models of the application. Execution permissions, " +
+		"access rights and record rules of the user apply to all the operations."
+	doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "API key with the 'rest' scope",
+	}
+	doc.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}}
+	doc.Components.Schemas["Error"] = &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"error": {Type: "string"}},
+		Required:   []string{"error"},
+	}
+	for _, model := range models.Registry.All() {
+		if model.IsMixin() || model.IsM2MLink() {
+			continue
+		}
+		doc.Components.Schemas[model.Name()] = model.JSONSchema()
+		addModelPaths(doc, model)
+	}
+	return doc
+}
+
+// addModelPaths adds to the given document the paths
+// of the REST API for the given model.
+func addModelPaths(doc *openapi.Document, model *models.Model) {
+	name := model.Name()
+	tags := []string{name}
+	modelPath := fmt.Sprintf("%s/%s", restAPIPath, name)
+	recordPath := fmt.Sprintf("%s/{id}", modelPath)
+	idParam := &openapi.Parameter{
+		Name:     "id",
+		In:       "path",
+		Required: true,
+		Schema:   &openapi.Schema{Type: "integer", Format: "int64"},
+	}
+	fieldsParam := &openapi.Parameter{
+		Name:        "fields",
+		In:          "query",
+		Description: "Comma separated list of the field paths to return. Defaults to all the fields.",
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	recordBody := &openapi.RequestBody{
+		Required: true,
+		Content:  openapi.JSONContent(openapi.Ref(name)),
+	}
+
+	doc.Paths[modelPath] = &openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("List %s records", name),
+			Description: "Records are filtered with filter[<path>]=<value> or filter[<path>][<op>]=<value> query parameters.",
+			OperationID: "list" + name,
+			Parameters: []*openapi.Parameter{
+				fieldsParam,
+				{Name: "domain", In: "query", Schema: &openapi.Schema{Type: "string"},
+					Description: "Odoo domain in JSON or Python literal syntax, combined with the filters."},
+				{Name: "order", In: "query", Schema: &openapi.Schema{Type: "string"},
+					Description: "Comma separated list of field paths. Paths prefixed by '-' are sorted in descending order."},
+				{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer"},
+					Description: fmt.Sprintf("Maximum number of records to return, 0 for all. Defaults to %d.", RESTDefaultLimit)},
+				{Name: "offset", In: "query", Schema: &openapi.Schema{Type: "integer"}},
+			},
+			Responses: restResponses(http.StatusOK, &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"total":   {Type: "integer", Format: "int64"},
+					"offset":  {Type: "integer"},
+					"limit":   {Type: "integer"},
+					"records": {Type: "array", Items: openapi.Ref(name)},
+				},
+			}),
+		},
+		Post: &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("Create a %s record", name),
+			OperationID: "create" + name,
+			Parameters:  []*openapi.Parameter{fieldsParam},
+			RequestBody: recordBody,
+			Responses:   restResponses(http.StatusCreated, openapi.Ref(name)),
+		},
+	}
+	doc.Paths[recordPath] = &openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("Get a %s record", name),
+			OperationID: "get" + name,
+			Parameters:  []*openapi.Parameter{idParam, fieldsParam},
+			Responses:   restResponses(http.StatusOK, openapi.Ref(name)),
+		},
+		Patch: &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("Update a %s record", name),
+			OperationID: "update" + name,
+			Parameters:  []*openapi.Parameter{idParam, fieldsParam},
+			RequestBody: recordBody,
+			Responses:   restResponses(http.StatusOK, openapi.Ref(name)),
+		},
+		Delete: &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("Delete a %s record", name),
+			OperationID: "delete" + name,
+			Parameters:  []*openapi.Parameter{idParam},
+			Responses:   restResponses(http.StatusNoContent, nil),
+		},
+	}
+	for _, method := range model.Methods().Exposed() {
+		op := &openapi.Operation{
+			Tags:        tags,
+			Summary:     fmt.Sprintf("Call %s on a %s record", method.Name(), name),
+			Description: method.Doc(),
+			OperationID: fmt.Sprintf("call%s%s", name, method.Name()),
+			Parameters:  []*openapi.Parameter{idParam},
+		}
+		if args := method.ArgsSchema(); args != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(args)}
+		}
+		result := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+		if res := method.ResultSchema(); res != nil {
+			result.Properties["result"] = res
+		}
+		op.Responses = restResponses(http.StatusOK, result)
+		doc.Paths[fmt.Sprintf("%s/%s", recordPath, method.Name())] = &openapi.PathItem{Post: op}
+	}
+}
+
+// restResponses returns the responses of an operation of the REST API which
+// responds with the given status and body schema on success. schema may
+// be nil if the response has no body.
+func restResponses(status int, schema *openapi.Schema) map[string]*openapi.Response {
+	res := make(map[string]*openapi.Response)
+	success := &openapi.Response{Description: http.StatusText(status)}
+	if schema != nil {
+		success.Content = openapi.JSONContent(schema)
+	}
+	res[fmt.Sprintf("%d", status)] = success
+	for _, errStatus := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		res[fmt.Sprintf("%d", errStatus)] = &openapi.Response{
+			Description: http.StatusText(errStatus),
+			Content:     openapi.JSONContent(openapi.Ref("Error")),
+		}
+	}
+	return res
+}
+
+// OpenAPI returns the OpenAPI document of the REST API
+func OpenAPI(ctx *server.Context) {
+	ctx.JSON(http.StatusOK, OpenAPIDocument())
+}
+
+// declareOpenAPIControllers adds the OpenAPI document controller to the
+// "/api" group of the given group, which must have been created before.
+func declareOpenAPIControllers(grp *Group) {
+	grp.GetGroup("/api").AddController(http.MethodGet, "/openapi.json", OpenAPI)
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools/openapi"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpenAPI(t *testing.T) {
+	Convey("Testing the OpenAPI document", t, func() {
+		doc := OpenAPIDocument()
+		So(doc.OpenAPI, ShouldEqual, openapi.Version)
+		So(doc.Components.Schemas, ShouldContainKey, "Users")
+		So(doc.Components.Schemas, ShouldNotContainKey, "CommonMixin")
+		So(doc.Components.Schemas["Users"].Required, ShouldContain, "login")
+		So(doc.Paths, ShouldContainKey, "/api/v1/Users")
+		So(doc.Paths, ShouldContainKey, "/api/v1/Users/{id}")
+		So(doc.Paths, ShouldNotContainKey, "/api/v1/CommonMixin")
+		Convey("Exposed methods should be documented", func() {
+			So(doc.Paths, ShouldNotContainKey, "/api/v1/Users/{id}/ResetPassword")
+			So(doc.Paths, ShouldContainKey, "/api/v1/Users/{id}/ChangePassword")
+			op := doc.Paths["/api/v1/Users/{id}/ChangePassword"].Post
+			So(op.OperationID, ShouldEqual, "callUsersChangePassword")
+			So(op.Description, ShouldStartWith, "ChangePassword sets the password")
+			args := op.RequestBody.Content[openapi.MIMEJSON].Schema
+			So(*args.MinItems, ShouldEqual, 2)
+			So(args.Items.Type, ShouldEqual, "string")
+		})
+		Convey("The document should be served as JSON", func() {
+			registry := newGroup("/")
+			declareRESTControllers(registry)
+			declareOpenAPIControllers(registry)
+			srv := newServer()
+			registry.createRoutes(srv.Group("/"))
+			r := performRequest(srv, http.MethodGet, "/api/openapi.json")
+			So(r.Code, ShouldEqual, http.StatusOK)
+			var served map[string]interface{}
+			So(json.Unmarshal(r.Body.Bytes(), &served), ShouldBeNil)
+			So(served["openapi"], ShouldEqual, openapi.Version)
+			So(served["paths"], ShouldContainKey, "/api/v1/Users")
+		})
+	})
+}
@@ -0,0 +1,741 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/operator"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/server"
+)
+
+// RESTDefaultLimit is the number of records returned by the list
+// endpoint of the REST API when no limit is given.
+const RESTDefaultLimit = 80
+
+// restOperators maps the operators of the filters of
+// the REST API to the operators of Condition.
+var restOperators = map[string]operator.Operator{
+	"eq":       operator.Equals,
+	"ne":       operator.NotEquals,
+	"gt":       operator.Greater,
+	"ge":       operator.GreaterOrEqual,
+	"lt":       operator.Lower,
+	"le":       operator.LowerOrEqual,
+	"like":     operator.Like,
+	"nlike":    operator.NotLike,
+	"ilike":    operator.ILike,
+	"nilike":   operator.NotILike,
+	"in":       operator.In,
+	"nin":      operator.NotIn,
+	"child_of": operator.ChildOf,
+}
+
+// restFilterParam matches the filter query parameters of the REST API,
+// such as "filter[Name]" or "filter[Profile.Age][gt]".
+var restFilterParam = regexp.MustCompile(`^filter\[([^\]]+)\](?:\[([^\]]+)\])?$`)
+
+// A restError is an error of a REST request that
+// must be returned to the client with the given status.
+type restError struct {
+	status int
+	msg    string
+}
+
+// Error returns the message of this restError
+func (e restError) Error() string {
+	return e.msg
+}
+
+// newRESTError returns a restError with the given status and formatted message
+func newRESTError(status int, format string, args ...interface{}) restError {
+	return restError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// A restField is a field to return for each record by the REST API.
+// Fields holds the sub fields to return for relation fields and
+// is nil if only the ids of the related records must be returned.
+type restField struct {
+	info   *models.FieldInfo
+	fields restFields
+}
+
+// restFields are the fields to return for each record by the REST API,
+// mapped by their JSON name.
+type restFields map[string]*restField
+
+// names returns the sorted JSON names of these restFields
+func (rf restFields) names() []string {
+	res := make([]string, 0, len(rf))
+	for name := range rf {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// restModel returns the model of the ":model" parameter of the request.
+// It responds with a 404 status if the model does not exist or cannot
+// be accessed through the REST API.
+func restModel(ctx *server.Context) (*models.Model, bool) {
+	model, ok := models.Registry.Get(ctx.Param("model"))
+	if !ok || model.IsMixin() || model.IsM2MLink() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown model %s", ctx.Param("model"))})
+		return nil, false
+	}
+	return model, true
+}
+
+// restID returns the id of the ":id" parameter of the request.
+// It responds with a 400 status if it is not a valid id.
+func restID(ctx *server.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid id %s", ctx.Param("id"))})
+		return 0, false
+	}
+	return id, true
+}
+
+// restUID returns the uid of the user of the request.
+// It responds with a 401 status if the request is not authenticated.
+func restUID(ctx *server.Context) (int64, bool) {
+	uid := ctx.UID()
+	if uid == 0 {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+	return uid, true
+}
+
+// jsonFieldName returns the JSON name of the field with the given
+// name or JSON name in the given model, or false if there is none.
+func jsonFieldName(model *models.Model, name string) (res string, ok bool) {
+	if strings.Contains(name, models.ExprSep) {
+		return "", false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	return model.JSONizeFieldName(name), true
+}
+
+// fieldsInfo returns the definition of the fields of the given model
+func fieldsInfo(env models.Environment, modelName string) map[string]*models.FieldInfo {
+	return env.Pool(modelName).Call("FieldsGet", models.FieldsGetArgs{}).(map[string]*models.FieldInfo)
+}
+
+// parseRESTFields returns the restFields of the given model for the given
+// comma separated list of field paths, such as "Name,Profile.Age". If
+// param is empty, all the fields of the model are returned with the ids
+// of their related records.
+func parseRESTFields(env models.Environment, model *models.Model, param string) (restFields, error) {
+	var paths []string
+	if param != "" {
+		paths = strings.Split(param, ",")
+	}
+	return restFieldsFromPaths(env, model, paths)
+}
+
+// restFieldsFromPaths returns the restFields of the given model for the given field paths
+func restFieldsFromPaths(env models.Environment, model *models.Model, paths []string) (restFields, error) {
+	infos := fieldsInfo(env, model.Name())
+	res := make(restFields)
+	if len(paths) == 0 {
+		for name, info := range infos {
+			res[name] = &restField{info: info}
+		}
+		return res, nil
+	}
+	subPaths := make(map[string][]string)
+	for _, path := range paths {
+		exprs := strings.SplitN(strings.TrimSpace(path), models.ExprSep, 2)
+		name, ok := jsonFieldName(model, exprs[0])
+		if !ok {
+			return nil, newRESTError(http.StatusBadRequest, "unknown field %s in model %s", exprs[0], model.Name())
+		}
+		if _, exists := res[name]; !exists {
+			res[name] = &restField{info: infos[name]}
+		}
+		if len(exprs) == 1 {
+			continue
+		}
+		if res[name].info.Relation == "" {
+			return nil, newRESTError(http.StatusBadRequest, "field %s of model %s is not a relation field", exprs[0], model.Name())
+		}
+		subPaths[name] = append(subPaths[name], exprs[1])
+	}
+	for name, sub := range subPaths {
+		relModel := models.Registry.MustGet(res[name].info.Relation)
+		fields, err := restFieldsFromPaths(env, relModel, sub)
+		if err != nil {
+			return nil, err
+		}
+		res[name].fields = fields
+	}
+	return res, nil
+}
+
+// restRecords returns the given fields of the records of rs
+// as a slice of maps ready to be serialized to JSON.
+func restRecords(rs models.RecordCollection, fields restFields) []map[string]interface{} {
+	data := rs.Call("Read", fields.names()).([]models.FieldMap)
+	res := make([]map[string]interface{}, len(data))
+	for i, fMap := range data {
+		rec := map[string]interface{}{"id": fMap["id"]}
+		for name, field := range fields {
+			rec[name] = restValue(rs.Env(), field, fMap[name])
+		}
+		res[i] = rec
+	}
+	return res
+}
+
+// restValue returns the given value of the given field ready to be
+// serialized to JSON. Relation fields are returned as ids, or as nested
+// records if sub fields have been requested.
+func restValue(env models.Environment, field *restField, value interface{}) interface{} {
+	if !field.info.Type.IsRelationType() {
+		return value
+	}
+	var ids []int64
+	switch v := value.(type) {
+	case models.RecordCollection:
+		ids = v.Ids()
+	case int64:
+		if v != 0 {
+			ids = []int64{v}
+		}
+	case []int64:
+		ids = v
+	}
+	var records []map[string]interface{}
+	if field.fields != nil && len(ids) > 0 {
+		relModel := models.Registry.MustGet(field.info.Relation)
+		rs := env.Pool(relModel.Name()).Call("Search", relModel.Field("id").In(ids)).(models.RecordSet).Collection()
+		records = restRecords(rs, field.fields)
+	}
+	if field.info.Type.Is2OneRelationType() {
+		switch {
+		case len(ids) == 0:
+			return nil
+		case field.fields != nil && len(records) > 0:
+			return records[0]
+		default:
+			return ids[0]
+		}
+	}
+	if field.fields != nil {
+		if records == nil {
+			records = []map[string]interface{}{}
+		}
+		return records
+	}
+	if ids == nil {
+		ids = []int64{}
+	}
+	return ids
+}
+
+// restCondition returns the Condition on the given model built from the
+// filter parameters of the given query, or nil if there is no filter.
+//
+// Filters are given as "filter[<path>]=<value>" for equality or as
+// "filter[<path>][<op>]=<value>", where op is one of the keys of
+// restOperators. Values of the "in" and "nin" operators are comma
+// separated lists. All filters must match.
+func restCondition(model *models.Model, uid int64, query url.Values) (*models.Condition, error) {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var cond *models.Condition
+	for _, key := range keys {
+		match := restFilterParam.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		path, opName := match[1], match[2]
+		if opName == "" {
+			opName = "eq"
+		}
+		op, ok := restOperators[opName]
+		if !ok {
+			return nil, newRESTError(http.StatusBadRequest, "unknown operator %s", opName)
+		}
+		if err := checkFieldPath(model, uid, path); err != nil {
+			return nil, err
+		}
+		for _, value := range query[key] {
+			var arg interface{} = value
+			if op.IsMulti() {
+				arg = strings.Split(value, ",")
+			}
+			if cond == nil {
+				cond = model.Field(path).AddOperator(op, arg)
+				continue
+			}
+			cond = cond.And().Field(path).AddOperator(op, arg)
+		}
+	}
+	return cond, nil
+}
+
+// checkFieldPath returns an error if the given dot separated path is not a
+// valid field path from the given model, or if the user with the given uid
+// is not allowed to read one of its fields.
+func checkFieldPath(model *models.Model, uid int64, path string) (rErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rErr = newRESTError(http.StatusBadRequest, "invalid field path %s in model %s", path, model.Name())
+		}
+	}()
+	model.JSONizeFieldName(path)
+	if !model.CanAccessFieldPath(uid, path, security.Read) {
+		return newRESTError(http.StatusForbidden, "not allowed to read field %s in model %s", path, model.Name())
+	}
+	return nil
+}
+
+// restOrder returns the ORDER BY expressions of the given comma separated
+// list of field paths. Paths prefixed by '-' are sorted in descending order.
+func restOrder(model *models.Model, uid int64, param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	var res []string
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		direction := "ASC"
+		if strings.HasPrefix(path, "-") {
+			path = path[1:]
+			direction = "DESC"
+		}
+		if err := checkFieldPath(model, uid, path); err != nil {
+			return nil, err
+		}
+		res = append(res, fmt.Sprintf("%s %s", path, direction))
+	}
+	return res, nil
+}
+
+// restIntParam returns the value of the given query parameter as a
+// positive or zero integer, or defaultValue if it is not set.
+func restIntParam(ctx *server.Context, name string, defaultValue int) (int, error) {
+	param := ctx.Query(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+	res, err := strconv.Atoi(param)
+	if err != nil || res < 0 {
+		return 0, newRESTError(http.StatusBadRequest, "invalid %s %s", name, param)
+	}
+	return res, nil
+}
+
+// restRecordValues reads the JSON object of the request body and returns
+// it as a FieldMap. JSON numbers are converted to int64 when possible and
+// arrays of numbers to slices of int64, so that they can be used as ids.
+func restRecordValues(ctx *server.Context, model *models.Model) (models.FieldMap, error) {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(ctx.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, newRESTError(http.StatusBadRequest, "invalid JSON object: %s", err)
+	}
+	res := make(models.FieldMap)
+	for key, value := range data {
+		name, ok := jsonFieldName(model, key)
+		if !ok {
+			return nil, newRESTError(http.StatusBadRequest, "unknown field %s in model %s", key, model.Name())
+		}
+		if name == "id" {
+			continue
+		}
+		res[name] = restJSONValue(value)
+	}
+	return res, nil
+}
+
+// restJSONValue converts the given decoded JSON value for the ORM
+func restJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		ids := make([]int64, len(v))
+		for i, elem := range v {
+			id, ok := restJSONValue(elem).(int64)
+			if !ok {
+				return v
+			}
+			ids[i] = id
+		}
+		return ids
+	}
+	return value
+}
+
+// restRespondError responds to the request with the given error. Errors that
+// are not restErrors are explained with security.Explain to tell access errors,
+// which are returned with a 403 status, from other errors, which are returned
+// with the given status.
+func restRespondError(ctx *server.Context, err error, model *models.Model, uid int64, ids []int64, perm security.Permission, status int) {
+	if rErr, ok := err.(restError); ok {
+		ctx.JSON(rErr.status, gin.H{"error": rErr.msg})
+		return
+	}
+	if exp := security.Explain(uid, model.Name(), ids, perm); !exp.Granted && exp.DeniedBy != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("access denied by %s", exp.DeniedBy)})
+		return
+	}
+	// Keep only the panic message and not the stack trace
+	msg := strings.SplitN(err.Error(), "\n", 2)[0]
+	ctx.JSON(status, gin.H{"error": msg})
+}
+
+// searchRecord returns the record of the given model with the given id,
+// or a restError if it does not exist or cannot be read by the user.
+func searchRecord(env models.Environment, model *models.Model, id int64) (models.RecordCollection, error) {
+	rs := env.Pool(model.Name()).Call("Search", model.Field("id").Equals(id)).(models.RecordSet).Collection()
+	if rs.Len() == 0 {
+		return rs, newRESTError(http.StatusNotFound, "record %d of model %s not found", id, model.Name())
+	}
+	return rs, nil
+}
+
+// RESTList returns the records of the ":model" parameter that match
+// the filters of the request.
+//
+// The following query parameters are available:
+//   - fields: comma separated list of fields paths to return,
+//     such as "Name,Profile.Age". Defaults to all fields.
+//   - filter[<path>] or filter[<path>][<op>]: see restCondition.
+//   - domain: an Odoo domain, see models.ParseDomain. It is
+//     combined with the filters with AND.
+//   - order: comma separated list of field paths, prefixed
+//     by '-' for descending order.
+//   - limit and offset: for pagination. Set limit to 0 to get
+//     all records. Defaults to RESTDefaultLimit.
+func RESTList(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	var res gin.H
+	var rErr error
+	err := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		res, rErr = restList(ctx, env, model)
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, nil, security.Read, http.StatusInternalServerError)
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// restList returns the response of RESTList
+func restList(ctx *server.Context, env models.Environment, model *models.Model) (gin.H, error) {
+	limit, err := restIntParam(ctx, "limit", RESTDefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := restIntParam(ctx, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	order, err := restOrder(model, env.Uid(), ctx.Query("order"))
+	if err != nil {
+		return nil, err
+	}
+	cond, err := restCondition(model, env.Uid(), ctx.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	domainCond, err := models.ParseDomain(model, env.Uid(), ctx.Query("domain"))
+	if err != nil {
+		return nil, newRESTError(http.StatusBadRequest, "%s", err)
+	}
+	if domainCond != nil {
+		if cond == nil {
+			cond = domainCond
+		} else {
+			cond = cond.AndCond(domainCond)
+		}
+	}
+	fields, err := parseRESTFields(env, model, ctx.Query("fields"))
+	if err != nil {
+		return nil, err
+	}
+	rs := env.Pool(model.Name()).Call("FetchAll").(models.RecordSet).Collection()
+	if cond != nil {
+		rs = rs.Call("Search", cond).(models.RecordSet).Collection()
+	}
+	total := rs.SearchCount()
+	if len(order) > 0 {
+		orderArgs := make([]interface{}, len(order))
+		for i, expr := range order {
+			orderArgs[i] = expr
+		}
+		rs = rs.Call("OrderBy", orderArgs...).(models.RecordSet).Collection()
+	}
+	rs = rs.Call("Offset", offset).(models.RecordSet).Collection()
+	if limit > 0 {
+		rs = rs.Call("Limit", limit).(models.RecordSet).Collection()
+	}
+	return gin.H{
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"records": restRecords(rs, fields),
+	}, nil
+}
+
+// RESTGet returns the record with the ":id" parameter of the ":model"
+// parameter. The fields to return are given by the "fields" query
+// parameter as in RESTList.
+func RESTGet(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	id, ok := restID(ctx)
+	if !ok {
+		return
+	}
+	var res map[string]interface{}
+	var rErr error
+	err := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		var fields restFields
+		if fields, rErr = parseRESTFields(env, model, ctx.Query("fields")); rErr != nil {
+			return
+		}
+		res, rErr = restGet(env, model, id, fields)
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, []int64{id}, security.Read, http.StatusInternalServerError)
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// restGet returns the given fields of the record with the given id
+func restGet(env models.Environment, model *models.Model, id int64, fields restFields) (map[string]interface{}, error) {
+	rs, err := searchRecord(env, model, id)
+	if err != nil {
+		return nil, err
+	}
+	return restRecords(rs, fields)[0], nil
+}
+
+// RESTCreate creates a record of the ":model" parameter from the JSON
+// object of the request body and returns it with a 201 status. The
+// fields to return are given by the "fields" query parameter as in
+// RESTList.
+func RESTCreate(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	var res map[string]interface{}
+	var rErr error
+	err := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		var values models.FieldMap
+		if values, rErr = restRecordValues(ctx, model); rErr != nil {
+			return
+		}
+		var fields restFields
+		if fields, rErr = parseRESTFields(env, model, ctx.Query("fields")); rErr != nil {
+			return
+		}
+		rs := env.Pool(model.Name()).Call("Create", values).(models.RecordSet).Collection()
+		res = restRecords(rs, fields)[0]
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, nil, security.Create, http.StatusBadRequest)
+		return
+	}
+	ctx.JSON(http.StatusCreated, res)
+}
+
+// RESTUpdate updates the record with the ":id" parameter of the ":model"
+// parameter with the JSON object of the request body and returns it. The
+// fields to return are given by the "fields" query parameter as in RESTList.
+func RESTUpdate(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	id, ok := restID(ctx)
+	if !ok {
+		return
+	}
+	var res map[string]interface{}
+	var rErr error
+	err := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		var values models.FieldMap
+		if values, rErr = restRecordValues(ctx, model); rErr != nil {
+			return
+		}
+		var fields restFields
+		if fields, rErr = parseRESTFields(env, model, ctx.Query("fields")); rErr != nil {
+			return
+		}
+		var rs models.RecordCollection
+		if rs, rErr = searchRecord(env, model, id); rErr != nil {
+			return
+		}
+		rs.Call("Write", values)
+		res = restRecords(rs, fields)[0]
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, []int64{id}, security.Write, http.StatusBadRequest)
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// RESTDelete deletes the record with the ":id" parameter of the
+// ":model" parameter and responds with a 204 status.
+func RESTDelete(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	id, ok := restID(ctx)
+	if !ok {
+		return
+	}
+	var rErr error
+	err := models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		var rs models.RecordCollection
+		if rs, rErr = searchRecord(env, model, id); rErr != nil {
+			return
+		}
+		rs.Call("Unlink")
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, []int64{id}, security.Unlink, http.StatusInternalServerError)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// RESTCall calls the exposed method of the ":method" parameter on the record
+// with the ":id" parameter of the ":model" parameter and returns its result
+// as {"result": <value>}. The arguments of the method are given as a JSON
+// array in the request body, which may be empty if the method takes none.
+func RESTCall(ctx *server.Context) {
+	uid, ok := restUID(ctx)
+	if !ok {
+		return
+	}
+	model, ok := restModel(ctx)
+	if !ok {
+		return
+	}
+	id, ok := restID(ctx)
+	if !ok {
+		return
+	}
+	method, ok := model.Methods().Get(ctx.Param("method"))
+	if !ok || !method.IsExposed() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown method %s in model %s", ctx.Param("method"), model.Name())})
+		return
+	}
+	if !method.CanExecute(uid) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("you are not allowed to execute method %s of model %s", method.Name(), model.Name())})
+		return
+	}
+	data, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var res interface{}
+	var rErr error
+	err = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		var rs models.RecordCollection
+		if rs, rErr = searchRecord(env, model, id); rErr != nil {
+			return
+		}
+		if res, rErr = method.CallJSON(rs, data); rErr != nil {
+			rErr = newRESTError(http.StatusBadRequest, "%s", rErr)
+		}
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		restRespondError(ctx, rErr, model, uid, []int64{id}, security.Read, http.StatusBadRequest)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"result": res})
+}
+
+// declareRESTControllers adds the controllers of the REST API to the given
+// group. API keys with the "rest" scope are accepted as bearer tokens.
+func declareRESTControllers(grp *Group) {
+	restGrp := grp.AddGroup("/api").AddGroup("/v1")
+	restGrp.AddMiddleWare(BearerAuth("rest"))
+	restGrp.AddController(http.MethodGet, "/:model", RESTList)
+	restGrp.AddController(http.MethodPost, "/:model", RESTCreate)
+	restGrp.AddController(http.MethodGet, "/:model/:id", RESTGet)
+	restGrp.AddController(http.MethodPatch, "/:model/:id", RESTUpdate)
+	restGrp.AddController(http.MethodDelete, "/:model/:id", RESTDelete)
+	restGrp.AddController(http.MethodPost, "/:model/:id/:method", RESTCall)
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestREST(t *testing.T) {
+	Convey("Testing REST API requests validation", t, func() {
+		authenticateAPIKey = func(key, scope string) (int64, error) {
+			if key == "good.key" && scope == "rest" {
+				return 42, nil
+			}
+			return 0, security.InvalidCredentialsError(key)
+		}
+		registry := newGroup("/")
+		declareRESTControllers(registry)
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		request := func(method, path string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, nil)
+			req.Header.Set("Authorization", "Bearer good.key")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			return w
+		}
+		Convey("Unauthenticated requests should be rejected", func() {
+			r := performRequest(srv, http.MethodGet, "/api/v1/Users")
+			So(r.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		Convey("Unknown models should not be found", func() {
+			r := request(http.MethodGet, "/api/v1/UnknownModel")
+			So(r.Code, ShouldEqual, http.StatusNotFound)
+			r = request(http.MethodGet, "/api/v1/CommonMixin/1")
+			So(r.Code, ShouldEqual, http.StatusNotFound)
+		})
+		Convey("Methods that are not exposed should not be found", func() {
+			r := request(http.MethodPost, "/api/v1/Users/1/ResetPassword")
+			So(r.Code, ShouldEqual, http.StatusNotFound)
+			r = request(http.MethodPost, "/api/v1/Users/1/UnknownMethod")
+			So(r.Code, ShouldEqual, http.StatusNotFound)
+		})
+		Convey("Invalid ids should be rejected", func() {
+			r := request(http.MethodGet, "/api/v1/Users/abc")
+			So(r.Code, ShouldEqual, http.StatusBadRequest)
+			r = request(http.MethodDelete, "/api/v1/Users/-1")
+			So(r.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+	Convey("Testing REST API helpers", t, func() {
+		Convey("Filter parameters should be parsed", func() {
+			So(restFilterParam.FindStringSubmatch("filter[Name]"), ShouldResemble, []string{"filter[Name]", "Name", ""})
+			So(restFilterParam.FindStringSubmatch("filter[Profile.Age][gt]"), ShouldResemble,
+				[]string{"filter[Profile.Age][gt]", "Profile.Age", "gt"})
+			So(restFilterParam.FindStringSubmatch("order"), ShouldBeNil)
+		})
+		Convey("JSON values should be converted for the ORM", func() {
+			So(restJSONValue(json.Number("12")), ShouldEqual, int64(12))
+			So(restJSONValue(json.Number("1.5")), ShouldEqual, 1.5)
+			So(restJSONValue([]interface{}{json.Number("1"), json.Number("2")}), ShouldResemble, []int64{1, 2})
+			So(restJSONValue([]interface{}{"a"}), ShouldResemble, []interface{}{"a"})
+			So(restJSONValue("text"), ShouldEqual, "text")
+		})
+		Convey("Filters and order should only use readable fields", func() {
+			users := models.Registry.MustGet("Users")
+			So(checkFieldPath(users, security.SuperUserID, "Password"), ShouldBeNil)
+			So(checkFieldPath(users, 7, "Login"), ShouldBeNil)
+			err := checkFieldPath(users, 7, "Password")
+			So(err, ShouldNotBeNil)
+			So(err.(restError).status, ShouldEqual, http.StatusForbidden)
+			So(checkFieldPath(users, 7, "Unknown").(restError).status, ShouldEqual, http.StatusBadRequest)
+			_, err = restOrder(users, 7, "Login,-Password")
+			So(err, ShouldNotBeNil)
+			_, err = restCondition(users, 7, url.Values{"filter[Password][like]": []string{"$2a$%"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
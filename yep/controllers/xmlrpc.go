@@ -0,0 +1,689 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/server"
+	"github.com/npiganeau/yep/yep/tools/xmlrpc"
+)
+
+// XMLRPCServerVersion is the Odoo version reported by the version method of
+// the XML-RPC API, that is the version of the Odoo API that it emulates.
+const XMLRPCServerVersion = "10.0"
+
+// Fault codes of the XML-RPC API, as in Odoo
+const (
+	xmlrpcApplicationError = 1
+	xmlrpcAccessDenied     = 3
+)
+
+// userLogin is the function used to get the login of the
+// users of XML-RPC calls. It can be replaced in tests.
+var userLogin = models.UserLogin
+
+// xmlrpcRespond responds to the request with the given value
+func xmlrpcRespond(ctx *server.Context, value interface{}) {
+	var buf bytes.Buffer
+	if err := xmlrpc.EncodeResponse(&buf, value); err != nil {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "unable to encode response: %s", err)
+		return
+	}
+	ctx.Data(http.StatusOK, "text/xml; charset=utf-8", buf.Bytes())
+}
+
+// xmlrpcFault responds to the request with a fault with the given code
+// and formatted message. As per XML-RPC, faults have a 200 status.
+func xmlrpcFault(ctx *server.Context, code int, format string, args ...interface{}) {
+	var buf bytes.Buffer
+	xmlrpc.EncodeFault(&buf, xmlrpc.Fault{Code: code, String: fmt.Sprintf(format, args...)})
+	ctx.Data(http.StatusOK, "text/xml; charset=utf-8", buf.Bytes())
+}
+
+// xmlrpcAuthenticate returns the uid of the user with the given login
+// and password, which may also be an API key with the "xmlrpc" scope.
+// Users who have enabled two-factor authentication can only be
+// authenticated with an API key.
+//
+// Failures are recorded in ctx so that they are throttled by LoginThrottle.
+func xmlrpcAuthenticate(ctx *server.Context, login, password string) (int64, bool) {
+	if uid, err := authenticateAPIKey(password, "xmlrpc"); err == nil {
+		if l, ok := userLogin(uid); ok && l == login {
+			return uid, true
+		}
+	}
+	uid, err := authenticate(login, password, nil)
+	if err != nil || secondFactorRequired(uid) {
+		log.Info("XML-RPC authentication failed", "login", login, "error", err)
+		authFailed(ctx)
+		return 0, false
+	}
+	return uid, true
+}
+
+// xmlrpcCheckUser returns true if password is the password or an
+// API key with the "xmlrpc" scope of the user with the given uid.
+func xmlrpcCheckUser(ctx *server.Context, uid int64, password string) bool {
+	login, ok := userLogin(uid)
+	if !ok {
+		authFailed(ctx)
+		return false
+	}
+	res, ok := xmlrpcAuthenticate(ctx, login, password)
+	return ok && res == uid
+}
+
+// xmlrpcString returns the i-th param as a string, or an empty string
+func xmlrpcString(params []interface{}, i int) string {
+	if i >= len(params) {
+		return ""
+	}
+	res, _ := params[i].(string)
+	return res
+}
+
+// XMLRPCCommon serves the "common" XML-RPC endpoint of Odoo, with the
+// following methods:
+//   - version() returns the version of the server
+//   - login(db, login, password) returns the uid of the user with the given
+//     credentials, or false if they are invalid
+//   - authenticate(db, login, password, user_agent_env) is the same as login
+//
+// The database parameter is ignored.
+func XMLRPCCommon(ctx *server.Context) {
+	method, params, err := xmlrpc.DecodeCall(ctx.Request.Body)
+	if err != nil {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "invalid XML-RPC call: %s", err)
+		return
+	}
+	switch method {
+	case "version":
+		xmlrpcRespond(ctx, map[string]interface{}{
+			"server_version":      XMLRPCServerVersion,
+			"server_version_info": []interface{}{10, 0, 0, "final", 0, ""},
+			"server_serie":        XMLRPCServerVersion,
+			"protocol_version":    1,
+		})
+	case "login", "authenticate":
+		uid, ok := xmlrpcAuthenticate(ctx, xmlrpcString(params, 1), xmlrpcString(params, 2))
+		if !ok {
+			xmlrpcRespond(ctx, false)
+			return
+		}
+		xmlrpcRespond(ctx, uid)
+	default:
+		xmlrpcFault(ctx, xmlrpcApplicationError, "unknown method %s", method)
+	}
+}
+
+// XMLRPCObject serves the "object" XML-RPC endpoint of Odoo, with the
+// following methods:
+//   - execute_kw(db, uid, password, model, method, args, kwargs)
+//   - execute(db, uid, password, model, method, args...)
+//
+// The calls are executed as the given user, who is authenticated with its
+// password or with an API key with the "xmlrpc" scope. The database parameter
+// is ignored. See xmlrpcExecute for the available methods.
+func XMLRPCObject(ctx *server.Context) {
+	method, params, err := xmlrpc.DecodeCall(ctx.Request.Body)
+	if err != nil {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "invalid XML-RPC call: %s", err)
+		return
+	}
+	if method != "execute_kw" && method != "execute" {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "unknown method %s", method)
+		return
+	}
+	if len(params) < 5 {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "%s expects at least 5 parameters", method)
+		return
+	}
+	uid, _ := params[1].(int64)
+	if !xmlrpcCheckUser(ctx, uid, xmlrpcString(params, 2)) {
+		xmlrpcFault(ctx, xmlrpcAccessDenied, "Access Denied")
+		return
+	}
+	if !limitAuthenticatedUser(ctx, uid) {
+		return
+	}
+	modelName, methodName := xmlrpcString(params, 3), xmlrpcString(params, 4)
+	model, ok := xmlrpcModel(modelName)
+	if !ok {
+		xmlrpcFault(ctx, xmlrpcApplicationError, "unknown model %s", modelName)
+		return
+	}
+	args := xmlrpcArgs{args: params[5:]}
+	if method == "execute_kw" {
+		args.args, _ = xmlrpcParam(params, 5).([]interface{})
+		args.kwargs, _ = xmlrpcParam(params, 6).(map[string]interface{})
+	}
+	var res interface{}
+	var rErr error
+	err = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		res, rErr = xmlrpcExecute(env, model, methodName, args)
+	})
+	if rErr == nil {
+		rErr = err
+	}
+	if rErr != nil {
+		// Keep only the panic message and not the stack trace
+		xmlrpcFault(ctx, xmlrpcApplicationError, "%s", strings.SplitN(rErr.Error(), "\n", 2)[0])
+		return
+	}
+	xmlrpcRespond(ctx, res)
+}
+
+// xmlrpcParam returns the i-th param, or nil if there is none
+func xmlrpcParam(params []interface{}, i int) interface{} {
+	if i >= len(params) {
+		return nil
+	}
+	return params[i]
+}
+
+// xmlrpcModel returns the model with the given name. As in the REST API,
+// models can be referred to by their name or their table name. Odoo model
+// names such as "res.partner" are looked up as table names.
+func xmlrpcModel(name string) (*models.Model, bool) {
+	model, ok := models.Registry.Get(name)
+	if !ok {
+		model, ok = models.Registry.Get(strings.Replace(name, ".", "_", -1))
+	}
+	if !ok || model.IsMixin() || model.IsM2MLink() {
+		return nil, false
+	}
+	return model, true
+}
+
+// xmlrpcArgs are the positional and keyword arguments of an Odoo method call
+type xmlrpcArgs struct {
+	args   []interface{}
+	kwargs map[string]interface{}
+}
+
+// get returns the i-th positional argument, or the keyword argument with
+// the given name if there are not enough positional arguments. It returns
+// nil if neither is given. Odoo clients send None as false, so false is
+// also returned as nil.
+func (a xmlrpcArgs) get(i int, name string) interface{} {
+	var res interface{}
+	if i < len(a.args) {
+		res = a.args[i]
+	} else {
+		res = a.kwargs[name]
+	}
+	if res == false {
+		return nil
+	}
+	return res
+}
+
+// integer returns the integer argument at i or with the given name,
+// or def if it is not given.
+func (a xmlrpcArgs) integer(i int, name string, def int) (int, error) {
+	switch v := a.get(i, name).(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("argument %s must be an integer", name)
+}
+
+// ids returns the ids of the argument at i or with the given name,
+// which may be a single id or a list of ids.
+func (a xmlrpcArgs) ids(i int, name string) ([]int64, error) {
+	switch v := a.get(i, name).(type) {
+	case int64:
+		return []int64{v}, nil
+	case []interface{}:
+		res := make([]int64, len(v))
+		for j, id := range v {
+			var ok bool
+			if res[j], ok = id.(int64); !ok {
+				return nil, fmt.Errorf("invalid id %v", id)
+			}
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("argument %s must be a list of ids", name)
+}
+
+// stringList returns the list of strings of the argument at i
+// or with the given name, or nil if it is not given.
+func (a xmlrpcArgs) stringList(i int, name string) ([]string, error) {
+	value := a.get(i, name)
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("argument %s must be a list of strings", name)
+	}
+	res := make([]string, len(list))
+	for j, elem := range list {
+		if res[j], ok = elem.(string); !ok {
+			return nil, fmt.Errorf("argument %s must be a list of strings", name)
+		}
+	}
+	return res, nil
+}
+
+// xmlrpcExecute calls the given Odoo method on the given model and returns
+// its result ready to be encoded. The following methods are available, with
+// the same arguments as in Odoo:
+//   - search(domain, offset=0, limit=None, order=None, count=False)
+//   - search_count(domain)
+//   - read(ids, fields=None)
+//   - search_read(domain=None, fields=None, offset=0, limit=None, order=None)
+//   - create(vals)
+//   - write(ids, vals)
+//   - unlink(ids)
+//   - fields_get(allfields=None)
+//   - name_get(ids)
+//
+// Exposed methods of the model can also be called with their name or their
+// name in snake case, with the ids of the records as first argument.
+func xmlrpcExecute(env models.Environment, model *models.Model, method string, args xmlrpcArgs) (interface{}, error) {
+	pool := env.Pool(model.Name())
+	switch method {
+	case "search", "search_count", "search_read":
+		offsetPos := 1
+		if method == "search_read" {
+			// search_read has fields as second argument
+			offsetPos = 2
+		}
+		rs, err := xmlrpcSearch(env, model, args, offsetPos)
+		if err != nil {
+			return nil, err
+		}
+		if method == "search_count" || (method == "search" && args.get(4, "count") == true) {
+			return rs.SearchCount(), nil
+		}
+		if method == "search" {
+			return rs.Ids(), nil
+		}
+		fields, err := args.stringList(1, "fields")
+		if err != nil {
+			return nil, err
+		}
+		return xmlrpcRead(rs, fields)
+	case "read", "name_get":
+		ids, err := args.ids(0, "ids")
+		if err != nil {
+			return nil, err
+		}
+		rs := pool.Call("Search", model.Field("id").In(ids)).(models.RecordSet).Collection()
+		if method == "name_get" {
+			res := make([]interface{}, 0, rs.Len())
+			for _, rec := range rs.Records() {
+				res = append(res, []interface{}{rec.Ids()[0], rec.Call("NameGet")})
+			}
+			return res, nil
+		}
+		fields, err := args.stringList(1, "fields")
+		if err != nil {
+			return nil, err
+		}
+		return xmlrpcRead(rs, fields)
+	case "create":
+		values, err := xmlrpcValues(model, args.get(0, "vals"))
+		if err != nil {
+			return nil, err
+		}
+		return pool.Call("Create", values).(models.RecordSet).Ids()[0], nil
+	case "write", "unlink":
+		ids, err := args.ids(0, "ids")
+		if err != nil {
+			return nil, err
+		}
+		rs := pool.Call("Search", model.Field("id").In(ids)).(models.RecordSet).Collection()
+		if rs.Len() != len(ids) {
+			return nil, fmt.Errorf("some records of model %s do not exist or cannot be accessed", model.Name())
+		}
+		if method == "unlink" {
+			rs.Call("Unlink")
+			return true, nil
+		}
+		values, err := xmlrpcValues(model, args.get(1, "vals"))
+		if err != nil {
+			return nil, err
+		}
+		rs.Call("Write", values)
+		return true, nil
+	case "fields_get":
+		fields, err := args.stringList(0, "allfields")
+		if err != nil {
+			return nil, err
+		}
+		fArgs := models.FieldsGetArgs{}
+		for _, f := range fields {
+			fArgs.Fields = append(fArgs.Fields, models.FieldName(f))
+		}
+		data, err := json.Marshal(pool.Call("FieldsGet", fArgs))
+		if err != nil {
+			return nil, err
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, err
+		}
+		return xmlrpcValue(res), nil
+	}
+	return xmlrpcCallMethod(env, model, method, args)
+}
+
+// xmlrpcCallMethod calls the exposed method with the given name on the
+// records whose ids are given as first argument. The method can be given
+// by its name or by its name in snake case, such as "change_password".
+func xmlrpcCallMethod(env models.Environment, model *models.Model, method string, args xmlrpcArgs) (interface{}, error) {
+	meth, ok := model.Methods().Get(method)
+	if !ok {
+		meth, ok = model.Methods().Get(xmlrpcCamelCase(method))
+	}
+	if !ok || !meth.IsExposed() {
+		return nil, fmt.Errorf("unknown method %s of model %s", method, model.Name())
+	}
+	if !meth.CanExecute(env.Uid()) {
+		return nil, fmt.Errorf("method %s of model %s cannot be executed by the user", meth.Name(), model.Name())
+	}
+	ids, err := args.ids(0, "ids")
+	if err != nil {
+		return nil, err
+	}
+	rs := env.Pool(model.Name()).Call("Search", model.Field("id").In(ids)).(models.RecordSet).Collection()
+	if rs.Len() != len(ids) {
+		return nil, fmt.Errorf("some records of model %s do not exist or cannot be accessed", model.Name())
+	}
+	methArgs := []interface{}{}
+	if len(args.args) > 1 {
+		methArgs = args.args[1:]
+	}
+	data, err := json.Marshal(methArgs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := meth.CallJSON(rs, data)
+	if err != nil {
+		return nil, err
+	}
+	return xmlrpcValue(res), nil
+}
+
+// xmlrpcCamelCase returns the given snake case name in camel case
+func xmlrpcCamelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		parts[i] = strings.Title(part)
+	}
+	return strings.Join(parts, "")
+}
+
+// xmlrpcSearch returns the records of the given model matching the domain
+// given as first argument, ordered and paginated with the offset, limit and
+// order arguments, which are at offsetPos and the next positions.
+func xmlrpcSearch(env models.Environment, model *models.Model, args xmlrpcArgs, offsetPos int) (models.RecordCollection, error) {
+	rs := env.Pool(model.Name()).Call("FetchAll").(models.RecordSet).Collection()
+	if domain := args.get(0, "domain"); domain != nil {
+		list, ok := domain.([]interface{})
+		if !ok {
+			return rs, fmt.Errorf("domain must be a list")
+		}
+		cond, err := models.DomainToCondition(model, env.Uid(), list)
+		if err != nil {
+			return rs, err
+		}
+		if cond != nil {
+			rs = rs.Call("Search", cond).(models.RecordSet).Collection()
+		}
+	}
+	order, _ := args.get(offsetPos+2, "order").(string)
+	if order != "" {
+		orderExprs, err := xmlrpcOrder(model, env.Uid(), order)
+		if err != nil {
+			return rs, err
+		}
+		rs = rs.Call("OrderBy", orderExprs...).(models.RecordSet).Collection()
+	}
+	offset, err := args.integer(offsetPos, "offset", 0)
+	if err != nil {
+		return rs, err
+	}
+	if offset > 0 {
+		rs = rs.Call("Offset", offset).(models.RecordSet).Collection()
+	}
+	limit, err := args.integer(offsetPos+1, "limit", 0)
+	if err != nil {
+		return rs, err
+	}
+	if limit > 0 {
+		rs = rs.Call("Limit", limit).(models.RecordSet).Collection()
+	}
+	return rs, nil
+}
+
+// xmlrpcOrder returns the ORDER BY expressions of the
+// given Odoo order specification, such as "name desc, id".
+func xmlrpcOrder(model *models.Model, uid int64, order string) ([]interface{}, error) {
+	var res []interface{}
+	for _, spec := range strings.Split(order, ",") {
+		parts := strings.Fields(spec)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid order %s", order)
+		}
+		direction := "ASC"
+		if len(parts) == 2 {
+			direction = strings.ToUpper(parts[1])
+			if direction != "ASC" && direction != "DESC" {
+				return nil, fmt.Errorf("invalid order %s", order)
+			}
+		}
+		if err := checkFieldPath(model, uid, parts[0]); err != nil {
+			return nil, err
+		}
+		res = append(res, fmt.Sprintf("%s %s", parts[0], direction))
+	}
+	return res, nil
+}
+
+// xmlrpcRead returns the values of the given fields of the records of rs as
+// Odoo does: Many2One fields as a list of the id and the display name of the
+// related record, 2many fields as lists of ids and empty values as false.
+// All fields are returned if fields is empty.
+func xmlrpcRead(rs models.RecordCollection, fields []string) ([]interface{}, error) {
+	infos := fieldsInfo(rs.Env(), rs.ModelName())
+	if len(fields) == 0 {
+		for name := range infos {
+			fields = append(fields, name)
+		}
+	}
+	for i, field := range fields {
+		name, ok := jsonFieldName(rs.Model(), field)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s in model %s", field, rs.ModelName())
+		}
+		fields[i] = name
+	}
+	data := rs.Call("Read", fields).([]models.FieldMap)
+	names := make(map[string]map[int64]string)
+	res := make([]interface{}, len(data))
+	for i, fMap := range data {
+		rec := map[string]interface{}{"id": fMap["id"]}
+		for _, name := range fields {
+			info := infos[name]
+			if info == nil || !info.Type.IsRelationType() {
+				rec[name] = xmlrpcValue(fMap[name])
+				continue
+			}
+			ids := xmlrpcRelatedIds(fMap[name])
+			if !info.Type.Is2OneRelationType() {
+				rec[name] = ids
+				continue
+			}
+			if len(ids) == 0 {
+				rec[name] = false
+				continue
+			}
+			if names[name] == nil {
+				names[name] = xmlrpcDisplayNames(rs.Env(), info.Relation, data, name)
+			}
+			rec[name] = []interface{}{ids[0], names[name][ids[0]]}
+		}
+		res[i] = rec
+	}
+	return res, nil
+}
+
+// xmlrpcDisplayNames returns the display names of the records of the given
+// model referenced by the given field in data, mapped by their ids.
+func xmlrpcDisplayNames(env models.Environment, modelName string, data []models.FieldMap, field string) map[int64]string {
+	var ids []int64
+	for _, fMap := range data {
+		ids = append(ids, xmlrpcRelatedIds(fMap[field])...)
+	}
+	res := make(map[int64]string)
+	relModel := models.Registry.MustGet(modelName)
+	rs := env.Pool(relModel.Name()).Call("Search", relModel.Field("id").In(ids)).(models.RecordSet).Collection()
+	for _, rec := range rs.Records() {
+		res[rec.Ids()[0]] = rec.Call("NameGet").(string)
+	}
+	return res
+}
+
+// xmlrpcRelatedIds returns the ids of the given value of a relation field
+func xmlrpcRelatedIds(value interface{}) []int64 {
+	switch v := value.(type) {
+	case models.RecordSet:
+		return v.Ids()
+	case int64:
+		if v != 0 {
+			return []int64{v}
+		}
+	case []int64:
+		return v
+	}
+	return []int64{}
+}
+
+// xmlrpcValue returns the given value ready to be encoded as Odoo does:
+// empty values as false and dates as strings.
+func xmlrpcValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case types.Date:
+		if v.IsNull() {
+			return false
+		}
+		return time.Time(v).Format("2006-01-02")
+	case types.DateTime:
+		if v.IsNull() {
+			return false
+		}
+		return time.Time(v).Format("2006-01-02 15:04:05")
+	case models.RecordSet:
+		return v.Ids()
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			res[key] = xmlrpcValue(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, val := range v {
+			res[i] = xmlrpcValue(val)
+		}
+		return res
+	}
+	return value
+}
+
+// xmlrpcValues returns the given Odoo values of records of the given model as
+// a FieldMap. False values of non boolean fields are set to nil. 2many fields
+// take a list of ids or a list of Odoo commands, of which only (6, 0, ids)
+// to replace the related records and (5,) to remove them are supported.
+func xmlrpcValues(model *models.Model, vals interface{}) (models.FieldMap, error) {
+	data, ok := vals.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("values must be a struct")
+	}
+	res := make(models.FieldMap)
+	for key, value := range data {
+		name, ok := jsonFieldName(model, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s in model %s", key, model.Name())
+		}
+		if name == "id" {
+			continue
+		}
+		typ := model.Fields().MustGet(name).Type()
+		switch {
+		case value == false && typ != fieldtype.Boolean:
+			res[name] = nil
+		case typ.Is2ManyRelationType():
+			ids, err := xmlrpc2ManyValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %s", key, err)
+			}
+			res[name] = ids
+		default:
+			res[name] = value
+		}
+	}
+	return res, nil
+}
+
+// xmlrpc2ManyValue returns the ids of the given value of a 2many field
+func xmlrpc2ManyValue(value interface{}) ([]int64, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value %v", value)
+	}
+	ids := []int64{}
+	for _, elem := range list {
+		switch v := elem.(type) {
+		case int64:
+			ids = append(ids, v)
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("empty command")
+			}
+			switch v[0] {
+			case int64(5):
+				ids = []int64{}
+			case int64(6):
+				if len(v) != 3 {
+					return nil, fmt.Errorf("invalid command %v", v)
+				}
+				cmdIds, err := xmlrpcArgs{args: v[2:]}.ids(0, "ids")
+				if err != nil {
+					return nil, err
+				}
+				ids = cmdIds
+			default:
+				return nil, fmt.Errorf("unsupported command %v", v)
+			}
+		default:
+			return nil, fmt.Errorf("invalid value %v", elem)
+		}
+	}
+	return ids, nil
+}
+
+// declareXMLRPCControllers adds the XML-RPC endpoints of Odoo to the given group
+func declareXMLRPCControllers(grp *Group) {
+	xmlrpcGrp := grp.AddGroup("/xmlrpc/2")
+	xmlrpcGrp.AddController(http.MethodPost, "/common", XMLRPCCommon)
+	xmlrpcGrp.AddController(http.MethodPost, "/object", XMLRPCObject)
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/ratelimit"
+	"github.com/npiganeau/yep/yep/tools/xmlrpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestXMLRPC(t *testing.T) {
+	Convey("Testing XML-RPC endpoints", t, func() {
+		authenticate = func(login, secret string, context *types.Context) (int64, error) {
+			switch {
+			case login == "jsmith" && secret == "secret":
+				return 7, nil
+			case login == "totpuser" && secret == "secret":
+				return 8, nil
+			}
+			return 0, security.InvalidCredentialsError(login)
+		}
+		authenticateAPIKey = func(key, scope string) (int64, error) {
+			if key == "good.key" && scope == "xmlrpc" {
+				return 8, nil
+			}
+			return 0, security.InvalidCredentialsError(key)
+		}
+		secondFactorRequired = func(uid int64) bool {
+			return uid == 8
+		}
+		userLogin = func(uid int64) (string, bool) {
+			switch uid {
+			case 7:
+				return "jsmith", true
+			case 8:
+				return "totpuser", true
+			}
+			return "", false
+		}
+		Reset(func() {
+			authenticate = security.AuthenticationRegistry.Authenticate
+			authenticateAPIKey = models.AuthenticateAPIKey
+			secondFactorRequired = models.SecondFactorRequired
+			userLogin = models.UserLogin
+		})
+		registry := newGroup("/")
+		declareXMLRPCControllers(registry)
+		srv := newServer()
+		registry.createRoutes(srv.Group("/"))
+		call := func(path, method string, params ...interface{}) (interface{}, error) {
+			var body bytes.Buffer
+			So(xmlrpc.EncodeCall(&body, method, params...), ShouldBeNil)
+			req, _ := http.NewRequest(http.MethodPost, path, &body)
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			return xmlrpc.DecodeResponse(w.Body)
+		}
+		Convey("The version should be returned", func() {
+			res, err := call("/xmlrpc/2/common", "version")
+			So(err, ShouldBeNil)
+			So(res.(map[string]interface{})["server_version"], ShouldEqual, XMLRPCServerVersion)
+		})
+		Convey("Users should be authenticated", func() {
+			res, err := call("/xmlrpc/2/common", "authenticate", "db", "jsmith", "secret", map[string]interface{}{})
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, int64(7))
+			res, err = call("/xmlrpc/2/common", "login", "db", "jsmith", "wrong")
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, false)
+		})
+		Convey("Users with two-factor authentication should use API keys", func() {
+			res, err := call("/xmlrpc/2/common", "login", "db", "totpuser", "secret")
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, false)
+			res, err = call("/xmlrpc/2/common", "login", "db", "totpuser", "good.key")
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, int64(8))
+		})
+		Convey("Object calls with invalid credentials should be denied", func() {
+			_, err := call("/xmlrpc/2/object", "execute_kw", "db", 7, "wrong", "Users", "search", []interface{}{[]interface{}{}})
+			So(err, ShouldResemble, xmlrpc.Fault{Code: xmlrpcAccessDenied, String: "Access Denied"})
+			_, err = call("/xmlrpc/2/object", "execute_kw", "db", 8, "secret", "Users", "search", []interface{}{[]interface{}{}})
+			So(err, ShouldResemble, xmlrpc.Fault{Code: xmlrpcAccessDenied, String: "Access Denied"})
+		})
+		Convey("Failed authentications should be throttled", func() {
+			throttled := newGroup("/")
+			declareXMLRPCControllers(throttled)
+			throttled.GetGroup("/xmlrpc/2").AddMiddleWare(LoginThrottle(ratelimit.NewMemoryLimiter(0.01, 2)))
+			srv = newServer()
+			throttled.createRoutes(srv.Group("/"))
+			res, err := call("/xmlrpc/2/common", "login", "db", "jsmith", "secret")
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, int64(7))
+			res, err = call("/xmlrpc/2/common", "login", "db", "jsmith", "wrong")
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, false)
+			_, err = call("/xmlrpc/2/object", "execute_kw", "db", 7, "wrong", "Users", "search", []interface{}{[]interface{}{}})
+			So(err, ShouldResemble, xmlrpc.Fault{Code: xmlrpcAccessDenied, String: "Access Denied"})
+			var body bytes.Buffer
+			So(xmlrpc.EncodeCall(&body, "login", "db", "jsmith", "secret"), ShouldBeNil)
+			req, _ := http.NewRequest(http.MethodPost, "/xmlrpc/2/common", &body)
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusTooManyRequests)
+		})
+		Convey("Unknown models should be rejected", func() {
+			_, err := call("/xmlrpc/2/object", "execute_kw", "db", 7, "secret", "UnknownModel", "search", []interface{}{[]interface{}{}})
+			So(err.(xmlrpc.Fault).Code, ShouldEqual, xmlrpcApplicationError)
+		})
+	})
+	Convey("Testing XML-RPC helpers", t, func() {
+		So(xmlrpcCamelCase("change_password"), ShouldEqual, "ChangePassword")
+		ids, err := xmlrpc2ManyValue([]interface{}{[]interface{}{int64(6), int64(0), []interface{}{int64(1), int64(2)}}})
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []int64{1, 2})
+		_, err = xmlrpc2ManyValue([]interface{}{[]interface{}{int64(4), int64(1)}})
+		So(err, ShouldNotBeNil)
+		order, err := xmlrpcOrder(models.Registry.MustGet("Users"), security.SuperUserID, "name desc, id")
+		So(err, ShouldBeNil)
+		So(order, ShouldResemble, []interface{}{"name DESC", "id ASC"})
+		_, err = xmlrpcOrder(models.Registry.MustGet("Users"), 7, "password")
+		So(err, ShouldNotBeNil)
+	})
+}
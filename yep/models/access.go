@@ -0,0 +1,120 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+// modelAccessRights holds the access rights of each model that are
+// defined by ModelAccess records. Models without ModelAccess records
+// are not in this map and use the access rights declared in code.
+var modelAccessRights = struct {
+	sync.RWMutex
+	acls map[*Model]*security.AccessControlList
+}{
+	acls: make(map[*Model]*security.AccessControlList),
+}
+
+// declareModelAccessModel creates the ModelAccess model which holds
+// the access rights of the groups on the models of the application.
+//
+// ModelAccess records are typically loaded from a ModelAccess.csv data file
+// with the following columns:
+//
+//	id,Name,TargetModel,Group,PermRead,PermWrite,PermCreate,PermUnlink
+//
+// where Group is the external ID of a Group record. Group records that have
+// been created without explicit external ID have their group ID as external ID.
+func declareModelAccessModel() {
+	modelAccess := NewModel("ModelAccess")
+	modelAccess.AddCharField("Name", StringFieldParams{Required: true})
+	modelAccess.AddCharField("TargetModel", StringFieldParams{Required: true, Index: true, String: "Model",
+		Help: "The name of the model on which these access rights apply"})
+	modelAccess.AddMany2OneField("Group", ForeignKeyFieldParams{RelationModel: "Group", OnDelete: Cascade,
+		Help: "The group to which these access rights are granted. Leave empty to grant them to everyone."})
+	modelAccess.AddBooleanField("PermRead", SimpleFieldParams{String: "Read Access"})
+	modelAccess.AddBooleanField("PermWrite", SimpleFieldParams{String: "Write Access"})
+	modelAccess.AddBooleanField("PermCreate", SimpleFieldParams{String: "Create Access"})
+	modelAccess.AddBooleanField("PermUnlink", SimpleFieldParams{String: "Delete Access"})
+}
+
+// getModelAccessRights returns the access control list defined by
+// ModelAccess records for the given model or nil if there is none.
+func getModelAccessRights(m *Model) *security.AccessControlList {
+	modelAccessRights.RLock()
+	defer modelAccessRights.RUnlock()
+	return modelAccessRights.acls[m]
+}
+
+// loadModelAccessRights sets the access rights of the models from
+// the ModelAccess records read with the given selectFunc.
+//
+// Models that have at least one ModelAccess record only grant the
+// permissions of their records, and the access rights declared in
+// code with Model.GrantAccess and Model.RevokeAccess are ignored.
+func loadModelAccessRights(selectFunc dbSelectFunc) {
+	securitySyncMutex.Lock()
+	defer securitySyncMutex.Unlock()
+	accessModel := Registry.registryByName["ModelAccess"]
+	groupModel := Registry.registryByName["Group"]
+	adapter := adapters[db.DriverName()]
+	var accessData []struct {
+		Model      string  `db:"model"`
+		GroupID    *string `db:"group_id"`
+		PermRead   bool    `db:"perm_read"`
+		PermWrite  bool    `db:"perm_write"`
+		PermCreate bool    `db:"perm_create"`
+		PermUnlink bool    `db:"perm_unlink"`
+	}
+	selectFunc(&accessData, fmt.Sprintf(`
+		SELECT acc.target_model AS model, grp.group_id AS group_id, COALESCE(acc.perm_read, FALSE) AS perm_read,
+			COALESCE(acc.perm_write, FALSE) AS perm_write, COALESCE(acc.perm_create, FALSE) AS perm_create,
+			COALESCE(acc.perm_unlink, FALSE) AS perm_unlink
+		FROM %s acc LEFT JOIN %s grp ON grp.id = acc.%s`,
+		adapter.quoteTableName(accessModel.tableName), adapter.quoteTableName(groupModel.tableName),
+		accessModel.fields.registryByName["Group"].json))
+
+	acls := make(map[*Model]*security.AccessControlList)
+	for _, data := range accessData {
+		model, ok := Registry.Get(data.Model)
+		if !ok {
+			log.Warn("Unknown model in access rights", "model", data.Model)
+			continue
+		}
+		group := security.GroupEveryone
+		if data.GroupID != nil {
+			if group = security.Registry.GetGroup(*data.GroupID); group == nil {
+				log.Warn("Unknown group in access rights", "model", data.Model, "group", *data.GroupID)
+				continue
+			}
+		}
+		acl, ok := acls[model]
+		if !ok {
+			acl = security.NewAccessControlList()
+			acl.ReplacePermission(security.GroupEveryone, 0)
+			acls[model] = acl
+		}
+		var perm security.Permission
+		if data.PermRead {
+			perm |= security.Read
+		}
+		if data.PermWrite {
+			perm |= security.Write
+		}
+		if data.PermCreate {
+			perm |= security.Create
+		}
+		if data.PermUnlink {
+			perm |= security.Unlink
+		}
+		acl.AddPermission(group, perm)
+	}
+	modelAccessRights.Lock()
+	defer modelAccessRights.Unlock()
+	modelAccessRights.acls = acls
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+// declareAPIKeyModel creates the APIKey model which holds the keys
+// used by scripts and integrations to authenticate as a user.
+//
+// An API key has the form "<prefix>.<secret>". The prefix identifies
+// the key and only a hash of the secret is stored.
+func declareAPIKeyModel() {
+	apiKey := NewModel("APIKey")
+	apiKey.AddCharField("Name", StringFieldParams{Required: true,
+		Help: "A description of the use of this key"})
+	apiKey.AddMany2OneField("User", ForeignKeyFieldParams{RelationModel: "Users", Required: true,
+		Index: true, OnDelete: Cascade, Help: "The user this key authenticates"})
+	apiKey.AddCharField("Prefix", StringFieldParams{Required: true, Unique: true, NoCopy: true,
+		Help: "The public part of the key that identifies it"})
+	apiKey.AddCharField("Hash", StringFieldParams{Required: true, NoCopy: true,
+		Help: "The hash of the secret part of the key"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+	apiKey.AddCharField("Scopes", StringFieldParams{
+		Help: "Space separated list of scopes this key can be used for. An empty list allows all scopes."})
+	apiKey.AddDateTimeField("ExpirationDate", SimpleFieldParams{
+		Help: "The key cannot be used after this date. Leave empty for a key that never expires."})
+	apiKey.AddBooleanField("Revoked", SimpleFieldParams{NoCopy: true})
+	apiKey.AddDateTimeField("LastUsed", SimpleFieldParams{NoCopy: true,
+		Help: "The last time this key has been used to authenticate"})
+
+	apiKey.AddMethod("Revoke",
+		`Revoke revokes the API keys of this RecordSet so that they cannot be used
+		anymore. Only the owner of a key or an administrator can revoke it.`,
+		func(rc RecordCollection) {
+			for _, key := range rc.Sudo().Records() {
+				if key.Get("User").(RecordCollection).Ids()[0] != rc.Env().Uid() &&
+					!security.Registry.HasMembership(rc.Env().Uid(), security.GroupAdmin) {
+					log.Panic("Only the owner of an API key can revoke it", "uid", rc.Env().Uid(), "key", key.Ids()[0])
+				}
+			}
+			rc.Sudo().Call("Write", FieldMap{"Revoked": true})
+		}).AllowGroup(security.GroupEveryone).Expose()
+
+	users := Registry.MustGet("Users")
+	users.AddMethod("GenerateAPIKey",
+		`GenerateAPIKey creates a new API key for this user with the given name,
+		space separated scopes and expiration date, and returns it. The key is not
+		stored and cannot be retrieved afterwards. Only the user itself or an
+		administrator can create keys for a user.`,
+		func(rc RecordCollection, name, scopes string, expiration types.DateTime) string {
+			rc.checkSelfOrAdmin()
+			prefix := randomToken(8, hex.EncodeToString)
+			secret := randomToken(32, base64.RawURLEncoding.EncodeToString)
+			rc.Env().Pool("APIKey").Sudo().Call("Create", FieldMap{
+				"Name":           name,
+				"User":           rc.Ids()[0],
+				"Prefix":         prefix,
+				"Hash":           hashAPIKeySecret(secret),
+				"Scopes":         scopes,
+				"ExpirationDate": expiration,
+			})
+			return prefix + "." + secret
+		}).AllowGroup(security.GroupEveryone)
+}
+
+// randomToken returns n random bytes encoded with the given function
+func randomToken(n int, encode func([]byte) string) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Panic("Unable to generate random token", "error", err)
+	}
+	return encode(b)
+}
+
+// hashAPIKeySecret returns the hash of the given API key secret to store
+// in the database. API key secrets are long random strings, so that a fast
+// unsalted hash is enough, unlike passwords.
+func hashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// AuthenticateAPIKey returns the id of the user of the given API key.
+//
+// It returns a security.InvalidCredentialsError if the key is unknown,
+// revoked, expired or if it is not allowed for the given scope. If scope
+// is empty, the scopes of the key are not checked.
+func AuthenticateAPIKey(key, scope string) (int64, error) {
+	var uid int64
+	parts := strings.SplitN(key, ".", 2)
+	authErr := security.InvalidCredentialsError(parts[0])
+	if len(parts) != 2 {
+		return 0, authErr
+	}
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		keys := env.Pool("APIKey")
+		apiKey := keys.Search(keys.Model().Field("Prefix").Equals(parts[0]))
+		if apiKey.Len() != 1 {
+			return
+		}
+		hash := hashAPIKeySecret(parts[1])
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(apiKey.Get("Hash").(string))) != 1 {
+			return
+		}
+		if apiKey.Get("Revoked").(bool) {
+			log.Info("Authentication attempt with revoked API key", "key", parts[0])
+			return
+		}
+		expiration := apiKey.Get("ExpirationDate").(types.DateTime)
+		if !expiration.IsNull() && time.Now().After(time.Time(expiration)) {
+			log.Info("Authentication attempt with expired API key", "key", parts[0])
+			return
+		}
+		if !apiKeyHasScope(apiKey.Get("Scopes").(string), scope) {
+			log.Info("API key used outside of its scopes", "key", parts[0], "scope", scope)
+			return
+		}
+		apiKey.Call("Write", FieldMap{"LastUsed": types.DateTime(time.Now())})
+		uid = apiKey.Get("User").(RecordCollection).Ids()[0]
+	})
+	if err != nil {
+		return 0, err
+	}
+	if uid == 0 {
+		return 0, authErr
+	}
+	return uid, nil
+}
+
+// apiKeyHasScope returns true if the given space separated
+// keyScopes allow the given scope.
+func apiKeyHasScope(keyScopes, scope string) bool {
+	if scope == "" || strings.TrimSpace(keyScopes) == "" {
+		return true
+	}
+	for _, s := range strings.Fields(keyScopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+var (
+	// MaxLoginFailures is the number of consecutive failed login attempts
+	// after which a user is locked out. Set to 0 to disable lockout.
+	MaxLoginFailures int64 = 5
+	// LoginLockoutDuration is the time during which a user that has been
+	// locked out cannot log in, even with the right password.
+	LoginLockoutDuration = 15 * time.Minute
+)
+
+// DBAuthBackend is an authentication backend that checks the given password
+// against the hash stored in the Password field of the Users model.
+//
+// Users without password are unknown to this backend so that they can be
+// authenticated by other backends.
+type DBAuthBackend struct{}
+
+// Authenticate the user defined by login and secret.
+func (dab DBAuthBackend) Authenticate(login, secret string, context *types.Context) (int64, error) {
+	var (
+		uid     int64
+		authErr error
+	)
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		users := env.Pool("Users")
+		user := users.Search(users.Model().Field("Login").Equals(login))
+		if user.Len() != 1 || user.Get("Password").(string) == "" {
+			authErr = security.UserNotFoundError(login)
+			return
+		}
+		if user.isLockedOut() {
+			log.Info("Login attempt on locked out user", "login", login)
+			authErr = security.InvalidCredentialsError(login)
+			return
+		}
+		ok, upgrade := security.CheckPassword(user.Get("Password").(string), secret)
+		if !ok {
+			user.registerLoginFailure()
+			authErr = security.InvalidCredentialsError(login)
+			return
+		}
+		if upgrade {
+			user.setPassword(secret)
+		} else {
+			user.resetLoginFailures()
+		}
+		uid = user.Ids()[0]
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uid, authErr
+}
+
+var _ security.AuthBackend = DBAuthBackend{}
+
+// UserLogin returns the login of the user with the given uid,
+// or false if there is no such user.
+func UserLogin(uid int64) (string, bool) {
+	var login string
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		users := env.Pool("Users")
+		user := users.Search(users.Model().Field("ID").Equals(uid))
+		if user.Len() == 1 {
+			login = user.Get("Login").(string)
+		}
+	})
+	if err != nil {
+		log.Panic("Unable to read user login", "uid", uid, "error", err)
+	}
+	return login, login != ""
+}
+
+// isLockedOut returns true if the user of this RecordCollection
+// is locked out after too many failed login attempts.
+func (rc RecordCollection) isLockedOut() bool {
+	lockedUntil := rc.Get("LockedUntil").(types.DateTime)
+	return !lockedUntil.IsNull() && time.Time(lockedUntil).After(time.Now())
+}
+
+// registerLoginFailure increments the failed login attempts of the user
+// of this RecordCollection and locks it out after MaxLoginFailures.
+func (rc RecordCollection) registerLoginFailure() {
+	failures := rc.Get("LoginFailures").(int64) + 1
+	data := FieldMap{"LoginFailures": failures}
+	if MaxLoginFailures > 0 && failures >= MaxLoginFailures {
+		log.Warn("User locked out after too many failed login attempts", "login", rc.Get("Login"))
+		data["LoginFailures"] = 0
+		data["LockedUntil"] = types.DateTime(time.Now().Add(LoginLockoutDuration))
+	}
+	rc.Call("Write", data)
+}
+
+// resetLoginFailures resets the failed login attempts of the user
+// of this RecordCollection after a successful login.
+func (rc RecordCollection) resetLoginFailures() {
+	if rc.Get("LoginFailures").(int64) != 0 || !rc.Get("LockedUntil").(types.DateTime).IsNull() {
+		rc.Call("Write", FieldMap{"LoginFailures": 0, "LockedUntil": types.DateTime{}})
+	}
+}
+
+// SyncLDAPUser creates or updates the local user authenticated by the LDAP
+// server as the entry with the given DN, and returns its id.
+//
+// The user is made a member of the security groups with the given groupIDs
+// and is removed from the other groups of managedGroupIDs. Other groups of
+// the user are not changed.
+//
+// Users are matched on their DN only, so that an entry of the directory is
+// never bound to a user that has not been created by LDAP login or linked to
+// this entry by an administrator. A new user is created with the given login,
+// unless create is false or this login is already used by another user, in
+// which case an error is returned.
+func SyncLDAPUser(dn, login, name string, groupIDs, managedGroupIDs []string, create bool) (int64, error) {
+	if dn == "" {
+		return 0, security.UserNotFoundError(login)
+	}
+	var (
+		uid     int64
+		authErr error
+	)
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		users := env.Pool("Users")
+		user := users.Search(users.Model().Field("LDAPDN").Equals(dn))
+		data := FieldMap{"Name": name}
+		if len(managedGroupIDs) > 0 {
+			data["Groups"] = externalUserGroups(env, user, groupIDs, managedGroupIDs)
+		}
+		switch {
+		case !user.IsEmpty():
+			user.Call("Write", data)
+		case !users.Search(users.Model().Field("Login").Equals(login)).IsEmpty():
+			log.Warn("LDAP login matches a user that has not been created by LDAP", "login", login, "dn", dn)
+			authErr = security.InvalidCredentialsError(login)
+			return
+		case !create:
+			authErr = security.UserNotFoundError(login)
+			return
+		default:
+			data["Login"] = login
+			data["LDAPDN"] = dn
+			user = users.Call("Create", data).(RecordCollection)
+		}
+		uid = user.Ids()[0]
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uid, authErr
+}
+
+// SyncOIDCUser creates or updates the local user authenticated by the
+// OpenID Connect provider with the given issuer as the given subject, and
+// returns its id. The name and the groups of the user are updated as in
+// SyncLDAPUser.
+//
+// Users are matched on their issuer and subject only, so that an identity of
+// the provider is never bound to a user that has not been created by OIDC
+// login. A new user is created with the given login, unless create is false
+// or this login is already used by another user, in which case an error is
+// returned.
+func SyncOIDCUser(issuer, subject, login, name string, groupIDs, managedGroupIDs []string, create bool) (int64, error) {
+	if issuer == "" || subject == "" {
+		return 0, security.UserNotFoundError(login)
+	}
+	var (
+		uid     int64
+		authErr error
+	)
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		users := env.Pool("Users")
+		user := users.Search(users.Model().Field("OIDCIssuer").Equals(issuer).
+			And().Field("OIDCSubject").Equals(subject))
+		data := FieldMap{"Name": name}
+		if len(managedGroupIDs) > 0 {
+			data["Groups"] = externalUserGroups(env, user, groupIDs, managedGroupIDs)
+		}
+		switch {
+		case !user.IsEmpty():
+			user.Call("Write", data)
+		case !create:
+			authErr = security.UserNotFoundError(login)
+			return
+		case !users.Search(users.Model().Field("Login").Equals(login)).IsEmpty():
+			log.Warn("OIDC login matches a user that has not been created by OIDC", "login", login,
+				"issuer", issuer, "subject", subject)
+			authErr = security.InvalidCredentialsError(login)
+			return
+		default:
+			data["Login"] = login
+			data["OIDCIssuer"] = issuer
+			data["OIDCSubject"] = subject
+			user = users.Call("Create", data).(RecordCollection)
+		}
+		uid = user.Ids()[0]
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uid, authErr
+}
+
+// externalUserGroups returns the ids of the Group records the given user must
+// be a member of, that is its current groups that are not in managedGroupIDs
+// and the groups with the given groupIDs.
+func externalUserGroups(env Environment, user RecordCollection, groupIDs, managedGroupIDs []string) []int64 {
+	managed := make(map[string]bool)
+	for _, grpID := range managedGroupIDs {
+		managed[grpID] = true
+	}
+	var res []int64
+	if !user.IsEmpty() {
+		for _, grp := range user.Get("Groups").(RecordCollection).Records() {
+			if !managed[grp.Get("GroupID").(string)] {
+				res = append(res, grp.Ids()[0])
+			}
+		}
+	}
+	groups := env.Pool("Group")
+	for _, grpID := range groupIDs {
+		grp := groups.Search(groups.Model().Field("GroupID").Equals(grpID))
+		if grp.IsEmpty() {
+			log.Warn("External group mapped to unknown security group", "group", grpID)
+			continue
+		}
+		if !containsID(res, grp.Ids()[0]) {
+			res = append(res, grp.Ids()[0])
+		}
+	}
+	return res
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/spf13/viper"
+	"gopkg.in/ldap.v2"
+)
+
+// An LDAPConn is a connection to an LDAP server.
+// It is implemented by *ldap.Conn.
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// LDAPAuthBackend is an authentication backend that authenticates users
+// by binding to an LDAP server with their DN and password. It is configured
+// with the following keys of the viper configuration:
+//
+// - LDAP.Host: the hostname of the LDAP server. The backend is disabled if empty.
+// - LDAP.Port: the port of the LDAP server (default 389).
+// - LDAP.TLS: connect with LDAP over TLS.
+// - LDAP.StartTLS: upgrade the connection with StartTLS.
+// - LDAP.BindDN and LDAP.BindPassword: the credentials used to search users.
+// Anonymous search is used if LDAP.BindDN is empty.
+// - LDAP.BaseDN: the DN under which users are searched.
+// - LDAP.Filter: the filter to find a user, where %s is replaced by the login (default "(uid=%s)").
+// - LDAP.NameAttribute: the attribute holding the name of the user (default "cn").
+// - LDAP.GroupAttribute: the attribute holding the DN of the user's groups (default "memberOf").
+// - LDAP.GroupMapping: a map of LDAP group DNs to security group IDs. DNs are case insensitive.
+// - LDAP.NoUserCreation: do not create local users that do not exist yet.
+//
+// If the LDAP server cannot be reached or searched, the error is logged and
+// the login falls through to the next backends, so that local accounts can
+// still log in during an outage of the directory.
+//
+// On successful authentication, the local user bound to the LDAP entry of the
+// user is created or updated with SyncLDAPUser, and its membership in the
+// security groups of LDAP.GroupMapping is set according to the LDAP groups of
+// the user.
+type LDAPAuthBackend struct {
+	// Dial returns a new connection to the LDAP server.
+	// If nil, a connection is opened from the configuration.
+	Dial func() (LDAPConn, error)
+}
+
+// ldapConfig holds the LDAP configuration read from viper
+type ldapConfig struct {
+	baseDN         string
+	filter         string
+	nameAttribute  string
+	groupAttribute string
+	groupMapping   map[string]string
+	noUserCreation bool
+}
+
+// getLDAPConfig returns the LDAP configuration read from viper.
+// Default values are set in the init function of this package.
+func getLDAPConfig() ldapConfig {
+	groupMapping := make(map[string]string)
+	for dn, grpID := range viper.GetStringMapString("LDAP.GroupMapping") {
+		groupMapping[strings.ToLower(dn)] = grpID
+	}
+	return ldapConfig{
+		baseDN:         viper.GetString("LDAP.BaseDN"),
+		filter:         viper.GetString("LDAP.Filter"),
+		nameAttribute:  viper.GetString("LDAP.NameAttribute"),
+		groupAttribute: viper.GetString("LDAP.GroupAttribute"),
+		groupMapping:   groupMapping,
+		noUserCreation: viper.GetBool("LDAP.NoUserCreation"),
+	}
+}
+
+// dialLDAP opens a connection to the LDAP server defined in the configuration.
+func dialLDAP() (LDAPConn, error) {
+	host := viper.GetString("LDAP.Host")
+	addr := fmt.Sprintf("%s:%d", host, viper.GetInt("LDAP.Port"))
+	var (
+		conn *ldap.Conn
+		err  error
+	)
+	if viper.GetBool("LDAP.TLS") {
+		conn, err = ldap.DialTLS("tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = ldap.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetBool("LDAP.StartTLS") {
+		if err = conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Authenticate the user defined by login and secret against the LDAP server.
+func (lab LDAPAuthBackend) Authenticate(login, secret string, context *types.Context) (int64, error) {
+	dial := lab.Dial
+	if dial == nil {
+		if viper.GetString("LDAP.Host") == "" {
+			return 0, security.UserNotFoundError(login)
+		}
+		dial = dialLDAP
+	}
+	conf := getLDAPConfig()
+	conn, err := dial()
+	if err != nil {
+		log.Warn("Unable to connect to LDAP server", "error", err)
+		return 0, security.UserNotFoundError(login)
+	}
+	defer conn.Close()
+	if bindDN := viper.GetString("LDAP.BindDN"); bindDN != "" {
+		if err = conn.Bind(bindDN, viper.GetString("LDAP.BindPassword")); err != nil {
+			log.Warn("Unable to bind to LDAP server", "bindDN", bindDN, "error", err)
+			return 0, security.UserNotFoundError(login)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(conf.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, fmt.Sprintf(conf.filter, ldap.EscapeFilter(login)),
+		[]string{conf.nameAttribute, conf.groupAttribute}, nil))
+	if err != nil {
+		log.Warn("Unable to search LDAP server", "login", login, "error", err)
+		return 0, security.UserNotFoundError(login)
+	}
+	switch {
+	case len(res.Entries) == 0:
+		return 0, security.UserNotFoundError(login)
+	case len(res.Entries) > 1:
+		log.Warn("Several LDAP entries match login", "login", login)
+		return 0, security.InvalidCredentialsError(login)
+	}
+	entry := res.Entries[0]
+	// An empty password would make an unauthenticated bind succeed
+	if secret == "" || conn.Bind(entry.DN, secret) != nil {
+		return 0, security.InvalidCredentialsError(login)
+	}
+	name := entry.GetAttributeValue(conf.nameAttribute)
+	if name == "" {
+		name = login
+	}
+	groupIDs, managed := ldapGroups(entry.GetAttributeValues(conf.groupAttribute), conf)
+	return SyncLDAPUser(entry.DN, login, name, groupIDs, managed, !conf.noUserCreation)
+}
+
+// ldapGroups returns the IDs of the security groups mapped to the given
+// LDAP group DNs, and the IDs of all the security groups of the mapping.
+func ldapGroups(groupDNs []string, conf ldapConfig) ([]string, []string) {
+	var groupIDs, managed []string
+	for _, dn := range groupDNs {
+		if grpID, ok := conf.groupMapping[strings.ToLower(dn)]; ok {
+			groupIDs = append(groupIDs, grpID)
+		}
+	}
+	for _, grpID := range conf.groupMapping {
+		managed = append(managed, grpID)
+	}
+	return groupIDs, managed
+}
+
+var _ security.AuthBackend = LDAPAuthBackend{}
@@ -0,0 +1,158 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+var (
+	// TOTPIssuer is the name of the application shown
+	// in authenticator applications.
+	TOTPIssuer = "YEP"
+	// RecoveryCodesCount is the number of recovery codes
+	// generated for a user when enabling two-factor authentication.
+	RecoveryCodesCount = 10
+)
+
+// declareTOTPFields adds the fields and methods used for
+// two-factor authentication to the Users model.
+func declareTOTPFields() {
+	users := Registry.MustGet("Users")
+	users.AddCharField("TOTPSecret", StringFieldParams{NoCopy: true, String: "TOTP Secret",
+		Help: "The secret used to check the TOTP codes of this user"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+	users.AddBooleanField("TOTPEnabled", SimpleFieldParams{NoCopy: true, String: "Two-Factor Authentication",
+		Help: "If set, the user must give a TOTP code or a recovery code after logging in"})
+	users.AddCharField("RecoveryCodes", StringFieldParams{NoCopy: true,
+		Help: "Space separated hashes of the unused recovery codes of this user"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+	users.AddIntegerField("TOTPLastStep", SimpleFieldParams{NoCopy: true, String: "TOTP Last Step",
+		Help: "The time step of the last TOTP code accepted for this user, so that it cannot be used again"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+
+	users.AddMethod("EnableTOTP",
+		`EnableTOTP generates a new TOTP secret for this user and returns its
+		provisioning URI to be displayed as a QR code. Two-factor authentication
+		is actually enabled once a code has been given to ConfirmTOTP.`,
+		func(rc RecordCollection) string {
+			rc.checkSelfOrAdmin()
+			secret, err := security.GenerateTOTPSecret()
+			if err != nil {
+				log.Panic("Unable to generate TOTP secret", "error", err)
+			}
+			rc.Sudo().Call("Write", FieldMap{"TOTPSecret": secret, "TOTPEnabled": false})
+			return security.TOTPProvisioningURI(secret, rc.Get("Login").(string), TOTPIssuer)
+		}).AllowGroup(security.GroupEveryone)
+
+	users.AddMethod("ConfirmTOTP",
+		`ConfirmTOTP enables two-factor authentication for this user if code is
+		valid for the secret generated by EnableTOTP. It returns new recovery codes
+		that can be used once each instead of a TOTP code. It panics if the code
+		is not valid.`,
+		func(rc RecordCollection, code string) []string {
+			rc.checkSelfOrAdmin()
+			secret := rc.Sudo().Get("TOTPSecret").(string)
+			if secret == "" {
+				log.Panic("Invalid TOTP code", "user", rc.Ids()[0])
+			}
+			step, ok := security.MatchTOTP(secret, code, time.Now(), 0)
+			if !ok {
+				log.Panic("Invalid TOTP code", "user", rc.Ids()[0])
+			}
+			rc.Sudo().Call("Write", FieldMap{"TOTPEnabled": true, "TOTPLastStep": step})
+			return rc.Call("GenerateRecoveryCodes").([]string)
+		}).AllowGroup(security.GroupEveryone)
+
+	users.AddMethod("DisableTOTP",
+		`DisableTOTP disables two-factor authentication for this user.`,
+		func(rc RecordCollection) {
+			rc.checkSelfOrAdmin()
+			rc.Sudo().Call("Write", FieldMap{"TOTPSecret": "", "TOTPEnabled": false, "RecoveryCodes": "", "TOTPLastStep": 0})
+		}).AllowGroup(security.GroupEveryone)
+
+	users.AddMethod("GenerateRecoveryCodes",
+		`GenerateRecoveryCodes replaces the recovery codes of this user by new ones
+		and returns them. The codes are not stored and cannot be retrieved afterwards.`,
+		func(rc RecordCollection) []string {
+			rc.checkSelfOrAdmin()
+			codes := make([]string, RecoveryCodesCount)
+			hashes := make([]string, RecoveryCodesCount)
+			for i := range codes {
+				codes[i] = randomToken(5, hex.EncodeToString)
+				hashes[i] = hashRecoveryCode(codes[i])
+			}
+			rc.Sudo().Call("Write", FieldMap{"RecoveryCodes": strings.Join(hashes, " ")})
+			return codes
+		}).AllowGroup(security.GroupEveryone)
+}
+
+// hashRecoveryCode returns the hash of the given recovery code
+func hashRecoveryCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(hash[:])
+}
+
+// SecondFactorRequired returns true if the user with the given uid
+// has enabled two-factor authentication.
+func SecondFactorRequired(uid int64) bool {
+	var res bool
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		user := env.Pool("Users").withIds([]int64{uid})
+		res = user.Get("TOTPEnabled").(bool)
+	})
+	if err != nil {
+		log.Panic("Unable to read two-factor authentication status", "uid", uid, "error", err)
+	}
+	return res
+}
+
+// VerifySecondFactor returns true if code is a valid TOTP code or an unused
+// recovery code of the user with the given uid. Recovery codes are consumed
+// when used, and TOTP codes are refused if a code of the same or a later time
+// step has already been accepted. Failed attempts count as failed logins for
+// the lockout of the user.
+func VerifySecondFactor(uid int64, code string) bool {
+	var ok bool
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		user := env.Pool("Users").withIds([]int64{uid})
+		if !user.Get("TOTPEnabled").(bool) || user.isLockedOut() {
+			return
+		}
+		if step, valid := security.MatchTOTP(user.Get("TOTPSecret").(string), code, time.Now(),
+			user.Get("TOTPLastStep").(int64)); valid {
+			ok = true
+			user.Call("Write", FieldMap{"TOTPLastStep": step})
+			user.resetLoginFailures()
+			return
+		}
+		hash := hashRecoveryCode(code)
+		var remaining []string
+		for _, h := range strings.Fields(user.Get("RecoveryCodes").(string)) {
+			if !ok && subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				ok = true
+				continue
+			}
+			remaining = append(remaining, h)
+		}
+		if !ok {
+			user.registerLoginFailure()
+			return
+		}
+		log.Info("Recovery code used", "uid", uid, "remaining", len(remaining))
+		user.Call("Write", FieldMap{"RecoveryCodes": strings.Join(remaining, " ")})
+		user.resetLoginFailures()
+	})
+	if err != nil {
+		log.Warn("Unable to verify second factor", "uid", uid, "error", err)
+		return false
+	}
+	return ok
+}
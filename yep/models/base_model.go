@@ -224,6 +224,10 @@ func declareRecordSetMethods() {
 				if fInfo.relatedModel != nil {
 					relation = fInfo.relatedModel.name
 				}
+				var selection types.Selection
+				if fInfo.fieldType == fieldtype.Selection {
+					selection = fInfo.selectionValues(rc.Env())
+				}
 				res[fInfo.json] = &FieldInfo{
 					Help:       fInfo.help,
 					Searchable: true,
@@ -234,6 +238,8 @@ func declareRecordSetMethods() {
 					String:     fInfo.description,
 					Relation:   relation,
 					Required:   fInfo.required,
+					ReadOnly:   fInfo.readOnly,
+					Selection:  selection,
 				}
 			}
 			return res
@@ -246,7 +252,8 @@ func declareRecordSetMethods() {
 			args := FieldsGetArgs{
 				Fields: []FieldName{field.FieldName()},
 			}
-			return rc.Call("FieldsGet", args).(map[string]*FieldInfo)[string(field.FieldName())]
+			fJSON := rc.model.fields.MustGet(string(field.FieldName())).json
+			return rc.Call("FieldsGet", args).(map[string]*FieldInfo)[fJSON]
 		}).AllowGroup(security.GroupEveryone)
 
 	commonMixin.AddMethod("DefaultGet",
@@ -385,6 +392,7 @@ type FieldInfo struct {
 	String           string                 `json:"string"`
 	Domain           *Condition             `json:"domain"`
 	Relation         string                 `json:"relation"`
+	Selection        types.Selection        `json:"selection"`
 }
 
 // FieldsGetArgs is the args struct for the FieldsGet method
@@ -47,7 +47,10 @@ func BootStrap() {
 	bootStrapMethods()
 	processDepends()
 	checkComputeMethodsSignature()
+	checkSelectionMethodsSignature()
 	setupSecurity()
+	setupCompanyRules()
+	loadSecurityRegistry()
 }
 
 // createModelLinks create links with related Model
@@ -147,6 +150,9 @@ func injectMixInModel(mixInMI, mi *Model) {
 		for group := range methInfo.groups {
 			mi.methods.MustGet(methName).groups[group] = true
 		}
+		if methInfo.exposed {
+			mi.methods.MustGet(methName).exposed = true
+		}
 	}
 	mixed[modelCouple{model: mi, mixIn: mixInMI}] = true
 }
@@ -246,6 +252,7 @@ func SyncDatabase() {
 		}
 	}
 	updateDBSequences()
+	syncSecurityGroups()
 }
 
 // updateDBSequences synchronizes sequences between the DB
@@ -0,0 +1,309 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/spf13/viper"
+)
+
+const (
+	// busNotifyChannel is the Postgres channel on which the
+	// channels of new bus messages are notified.
+	busNotifyChannel = "yep_bus"
+	// busPublishLock is the key of the Postgres advisory
+	// lock that serializes the transactions publishing messages.
+	busPublishLock int64 = 0x79657062
+)
+
+// declareBusMessageModel creates the BusMessage model which holds the
+// messages published on the bus until they are delivered to all clients.
+func declareBusMessageModel() {
+	busMessage := NewModel("BusMessage")
+	busMessage.AddCharField("Channel", StringFieldParams{Required: true, Index: true,
+		Help: "The channel on which the message has been published"})
+	busMessage.AddTextField("Message", StringFieldParams{Help: "The JSON encoded message"})
+	busMessage.RevokeAccess(security.GroupEveryone, security.All)
+}
+
+// Publish publishes the given message on the given channel of the bus. The
+// message is delivered to the subscribers of the channel on all the server
+// instances when the transaction of this Environment is committed, and it
+// is discarded if the transaction is rolled back.
+//
+// The message must be JSON encodable.
+//
+// Transactions publishing messages are serialized until they are committed,
+// so that messages are committed in the order of their ids and clients never
+// miss a message with a lower id than the last one they received.
+func (env Environment) Publish(channel string, message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Panic("Unable to encode bus message", "channel", channel, "error", err)
+	}
+	env.cr.Execute("SELECT pg_advisory_xact_lock(?)", busPublishLock)
+	env.Pool("BusMessage").Sudo().Call("Create", FieldMap{
+		"Channel": channel,
+		"Message": string(data),
+	})
+	// Notifications are only delivered by Postgres on commit
+	env.cr.Execute("SELECT pg_notify(?, ?)", busNotifyChannel, channel)
+}
+
+// A BusNotification is a message published on a channel of the bus
+type BusNotification struct {
+	ID      int64           `json:"id"`
+	Channel string          `json:"channel"`
+	Message json.RawMessage `json:"message"`
+}
+
+// BusNotifications returns the messages published on the given channels
+// after the message with the given id, oldest first.
+func BusNotifications(channels []string, last int64) []BusNotification {
+	if len(channels) == 0 {
+		return nil
+	}
+	var rows []struct {
+		ID      int64
+		Channel string
+		Message string
+	}
+	query := fmt.Sprintf(`SELECT id, channel, message FROM %s WHERE id > ? AND channel IN (?) ORDER BY id`,
+		Registry.MustGet("BusMessage").tableName)
+	dbSelectNoTx(&rows, query, last, channels)
+	res := make([]BusNotification, len(rows))
+	for i, row := range rows {
+		res[i] = BusNotification{ID: row.ID, Channel: row.Channel, Message: json.RawMessage(row.Message)}
+	}
+	return res
+}
+
+// LastBusNotificationID returns the id of the last message published on the
+// bus, so that clients can subscribe to the messages published from now on.
+func LastBusNotificationID() int64 {
+	var res int64
+	query := fmt.Sprintf(`SELECT COALESCE(MAX(id), 0) FROM %s`, Registry.MustGet("BusMessage").tableName)
+	dbGetNoTx(&res, query)
+	return res
+}
+
+// WaitBusNotifications returns the messages published on the given channels
+// after the message with the given id. If there are none, it waits until a
+// message is published on one of the channels, the given timeout expires or
+// ctx is done, in which case it returns nil.
+//
+// Messages published by other server instances are only received if the bus
+// has been started with StartBus.
+func WaitBusNotifications(ctx context.Context, channels []string, last int64, timeout time.Duration) []BusNotification {
+	wake := bus.subscribe(channels)
+	defer bus.unsubscribe(channels, wake)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if res := BusNotifications(channels, last); len(res) > 0 {
+			return res
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// A busDispatcher wakes up the clients waiting for messages on the
+// channels notified by Postgres.
+type busDispatcher struct {
+	sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+// bus is the busDispatcher of this server instance
+var bus = &busDispatcher{waiters: make(map[string]map[chan struct{}]bool)}
+
+// subscribe returns a chan that receives a value
+// when a message is notified on one of the given channels.
+func (bd *busDispatcher) subscribe(channels []string) chan struct{} {
+	bd.Lock()
+	defer bd.Unlock()
+	wake := make(chan struct{}, 1)
+	for _, channel := range channels {
+		if bd.waiters[channel] == nil {
+			bd.waiters[channel] = make(map[chan struct{}]bool)
+		}
+		bd.waiters[channel][wake] = true
+	}
+	return wake
+}
+
+// unsubscribe removes the given chan from the waiters of the given channels
+func (bd *busDispatcher) unsubscribe(channels []string, wake chan struct{}) {
+	bd.Lock()
+	defer bd.Unlock()
+	for _, channel := range channels {
+		delete(bd.waiters[channel], wake)
+		if len(bd.waiters[channel]) == 0 {
+			delete(bd.waiters, channel)
+		}
+	}
+}
+
+// notify wakes up the waiters of the given channels,
+// or all the waiters if no channel is given.
+func (bd *busDispatcher) notify(channels ...string) {
+	bd.Lock()
+	defer bd.Unlock()
+	if len(channels) == 0 {
+		for channel := range bd.waiters {
+			channels = append(channels, channel)
+		}
+	}
+	for _, channel := range channels {
+		for wake := range bd.waiters[channel] {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// StartBus starts listening to the messages published on the bus by all the
+// server instances, so that they are delivered to the clients of this
+// instance. It must be called after connecting to the database and after
+// the models have been bootstrapped.
+//
+// Messages older than the Bus.Retention configuration key (one hour by
+// default) are deleted periodically.
+func StartBus() {
+	if db.DriverName() != "postgres" {
+		log.Panic("The bus requires a Postgres database", "driver", db.DriverName())
+	}
+	viper.SetDefault("Bus.Retention", time.Hour)
+	listener := pq.NewListener(dbConnData, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warn("Bus listener error", "event", ev, "error", err)
+		}
+	})
+	if err := listener.Listen(busNotifyChannel); err != nil {
+		log.Panic("Unable to listen to bus notifications", "error", err)
+	}
+	go listenBus(listener, viper.GetDuration("Bus.Retention"))
+	log.Info("Bus started")
+}
+
+// listenBus dispatches the notifications of the given listener
+// and deletes the messages older than retention.
+func listenBus(listener *pq.Listener, retention time.Duration) {
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+	for {
+		select {
+		case n := <-listener.Notify:
+			if n == nil {
+				// The connection has been reestablished and notifications may
+				// have been lost, so all the waiters check for new messages.
+				bus.notify()
+				continue
+			}
+			bus.notify(n.Extra)
+		case <-ping.C:
+			go listener.Ping()
+			deleteOldBusMessages(retention)
+		}
+	}
+}
+
+// deleteOldBusMessages deletes the bus messages older than retention
+func deleteOldBusMessages(retention time.Duration) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Warn("Unable to delete old bus messages", "error", r)
+		}
+	}()
+	query := fmt.Sprintf(`DELETE FROM %s WHERE create_date < ?`, Registry.MustGet("BusMessage").tableName)
+	dbExecuteNoTx(query, time.Now().Add(-retention))
+}
+
+// A BusChannelAuthorizer returns true if the user with
+// the given uid is allowed to subscribe to the given channel.
+type BusChannelAuthorizer func(uid int64, channel string) bool
+
+// busAuthorizers are the BusChannelAuthorizers mapped by channel prefix
+var busAuthorizers = struct {
+	sync.RWMutex
+	byPrefix map[string]BusChannelAuthorizer
+}{byPrefix: make(map[string]BusChannelAuthorizer)}
+
+// RegisterBusChannel registers the given authorizer for the channels with
+// the given prefix, that is the channels named "<prefix>:<name>".
+//
+// Subscriptions to channels without registered authorizer are denied.
+func RegisterBusChannel(prefix string, authorizer BusChannelAuthorizer) {
+	busAuthorizers.Lock()
+	defer busAuthorizers.Unlock()
+	busAuthorizers.byPrefix[prefix] = authorizer
+}
+
+// CanSubscribe returns true if the user with the
+// given uid is allowed to subscribe to the given channel.
+func CanSubscribe(uid int64, channel string) bool {
+	busAuthorizers.RLock()
+	authorizer, ok := busAuthorizers.byPrefix[strings.SplitN(channel, ":", 2)[0]]
+	busAuthorizers.RUnlock()
+	if !ok {
+		return false
+	}
+	return authorizer(uid, channel)
+}
+
+// UserChannel returns the channel of the user with the given uid.
+// Only this user can subscribe to it.
+func UserChannel(uid int64) string {
+	return fmt.Sprintf("user:%d", uid)
+}
+
+// RecordChannel returns the channel of the record of the given model with
+// the given id. Users who can read the record can subscribe to it.
+func RecordChannel(modelName string, id int64) string {
+	return fmt.Sprintf("record:%s:%d", modelName, id)
+}
+
+// authorizeUserChannel is the BusChannelAuthorizer of user channels
+func authorizeUserChannel(uid int64, channel string) bool {
+	return channel == UserChannel(uid)
+}
+
+// authorizeRecordChannel is the BusChannelAuthorizer of record channels
+func authorizeRecordChannel(uid int64, channel string) bool {
+	parts := strings.Split(channel, ":")
+	if len(parts) != 3 {
+		return false
+	}
+	model, ok := Registry.Get(parts[1])
+	if !ok {
+		return false
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return false
+	}
+	var res bool
+	err = ExecuteInNewEnvironment(uid, func(env Environment) {
+		rs := env.Pool(model.name).Call("Search", model.Field("ID").Equals(id)).(RecordSet).Collection()
+		res = rs.SearchCount() == 1
+	})
+	return err == nil && res
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+// declareCompanyModels creates the Company model and the CompanyMixin
+// that models must inherit to have their records scoped by company.
+func declareCompanyModels() {
+	company := NewModel("Company")
+	company.AddCharField("Name", StringFieldParams{Required: true, Unique: true})
+	company.AddMany2OneField("Parent", ForeignKeyFieldParams{RelationModel: "Company", String: "Parent Company"})
+	company.AddOne2ManyField("Children", ReverseFieldParams{RelationModel: "Company", ReverseFK: "Parent",
+		String: "Child Companies"})
+
+	companyMixin := NewMixinModel("CompanyMixin")
+	companyMixin.AddMany2OneField("Company", ForeignKeyFieldParams{RelationModel: "Company", Index: true,
+		Default: func(env Environment, values FieldMap) interface{} {
+			return env.CompanyID()
+		},
+	})
+}
+
+// isCompanyDependent returns true if this model inherits the CompanyMixin,
+// i.e. if its records belong to a company.
+func (m *Model) isCompanyDependent() bool {
+	for _, mixin := range m.mixins {
+		if mixin.name == "CompanyMixin" || mixin.isCompanyDependent() {
+			return true
+		}
+	}
+	return false
+}
+
+// setupCompanyRules adds a global record rule to each company dependent
+// model so that users can only access records of their allowed companies
+// and records that do not belong to any company.
+func setupCompanyRules() {
+	for _, model := range Registry.registryByName {
+		if model.isMixin() || !model.isCompanyDependent() {
+			continue
+		}
+		cond := model.Field("Company").In(func(rc RecordCollection) []int64 {
+			return rc.Env().CompanyIDs()
+		}).Or().Field("Company").Equals(nil)
+		model.AddRecordRule(&RecordRule{
+			Name:      fmt.Sprintf("%sCompanyRule", model.name),
+			Global:    true,
+			Condition: cond,
+			Perms:     security.All,
+		})
+	}
+}
+
+// checkCompanyConsistency checks that the records of this RecordCollection are
+// not linked through the relation fields of fMap to records that belong to
+// another company. All relation fields are checked if the company of the
+// records is in fMap. It panics if a cross-company link is found.
+func (rc RecordCollection) checkCompanyConsistency(fMap FieldMap) {
+	if !rc.model.isCompanyDependent() {
+		return
+	}
+	var checkAll bool
+	for fName := range fMap {
+		if fi, ok := rc.model.fields.get(fName); ok && fi.name == "Company" {
+			checkAll = true
+		}
+	}
+	var toCheck []*Field
+	for _, fi := range rc.model.fields.registryByName {
+		if fi.name == "Company" || fi.isRelatedField() || fi.fieldType.IsReverseRelationType() || fi.relatedModel == nil {
+			continue
+		}
+		if !fi.relatedModel.isCompanyDependent() {
+			continue
+		}
+		_, inName := fMap[fi.name]
+		_, inJSON := fMap[fi.json]
+		if !checkAll && !inName && !inJSON {
+			continue
+		}
+		toCheck = append(toCheck, fi)
+	}
+	if len(toCheck) == 0 {
+		return
+	}
+	for _, rec := range rc.Sudo().Records() {
+		company := rec.Get("Company").(RecordCollection)
+		if company.IsEmpty() {
+			continue
+		}
+		for _, fi := range toCheck {
+			for _, target := range rec.Get(fi.name).(RecordCollection).Records() {
+				targetCompany := target.Get("Company").(RecordCollection)
+				if !targetCompany.IsEmpty() && targetCompany.Ids()[0] != company.Ids()[0] {
+					log.Panic("Records of different companies cannot be linked", "model", rc.ModelName(),
+						"id", rec.Ids()[0], "company", company.Ids()[0], "field", fi.name,
+						"target", target.Ids()[0], "targetCompany", targetCompany.Ids()[0])
+				}
+			}
+		}
+	}
+}
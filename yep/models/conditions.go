@@ -313,13 +313,17 @@ func (c *Condition) substituteExprs(mi *Model, substs map[string][]string) {
 	}
 }
 
-// evaluateArgFunctions recursively evaluates all args in the queries that are
-// functions and substitute it with the result.
-func (c *Condition) evaluateArgFunctions(rc RecordCollection) {
+// evaluateArgFunctions returns a copy of this condition in which all args that
+// are functions are recursively evaluated and substituted with their result.
+// The condition itself is not modified so that conditions shared between queries
+// (such as record rules conditions) can be evaluated in different contexts.
+func (c Condition) evaluateArgFunctions(rc RecordCollection) *Condition {
+	predicates := make([]predicate, len(c.predicates))
 	for i, p := range c.predicates {
 		if p.cond != nil {
-			p.cond.evaluateArgFunctions(rc)
+			p.cond = p.cond.evaluateArgFunctions(rc)
 		}
+		predicates[i] = p
 
 		fnctVal := reflect.ValueOf(p.arg)
 		if fnctVal.Kind() != reflect.Func {
@@ -338,6 +342,8 @@ func (c *Condition) evaluateArgFunctions(rc RecordCollection) {
 		}
 
 		res := fnctVal.Call([]reflect.Value{argValue})
-		c.predicates[i].arg = res[0].Interface()
+		predicates[i].arg = res[0].Interface()
 	}
+	c.predicates = predicates
+	return &c
 }
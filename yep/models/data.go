@@ -104,6 +104,8 @@ func getRecordValuesMap(headers []string, modelName string, record []string, env
 			if err != nil {
 				log.Panic("Error while converting float", "line", line, "field", headers[i], "value", record[i], "error", err)
 			}
+		case fi.fieldType.IsFKRelationType() && record[i] == "":
+			val = nil
 		case fi.fieldType.IsFKRelationType():
 			relRC := env.Pool(fi.relatedModelName).Search(fi.relatedModel.Field("YEPExternalID").Equals(record[i]))
 			if relRC.Len() != 1 {
@@ -23,8 +23,9 @@ import (
 )
 
 var (
-	db       *sqlx.DB
-	adapters map[string]dbAdapter
+	db         *sqlx.DB
+	dbConnData string
+	adapters   map[string]dbAdapter
 )
 
 // A ColumnData holds information from the db schema about one column
@@ -40,6 +41,9 @@ type dbAdapter interface {
 	operatorSQL(operator.Operator, interface{}) (string, interface{})
 	// typeSQL returns the SQL type string, including columns constraints if any
 	typeSQL(fi *Field) string
+	// columnDataType returns the data type of the column of the given Field,
+	// as reported by the database schema
+	columnDataType(fi *Field) string
 	// columnSQLDefinition returns the SQL type string, including columns constraints if any
 	columnSQLDefinition(fi *Field) string
 	// fieldSQLDefault returns the SQL default value of the Field
@@ -79,33 +83,64 @@ func registerDBAdapter(name string, adapter dbAdapter) {
 // Cursor is a wrapper around a database transaction
 type Cursor struct {
 	tx *sqlx.Tx
+	// securityGroups is true if Group records have been modified in this transaction
+	securityGroups bool
+	// securityUIDs are the ids of the users whose groups have been modified in this transaction
+	securityUIDs []int64
+	// modelAccess is true if ModelAccess records have been modified in this transaction
+	modelAccess bool
+	// profile records the method calls and queries of this transaction if profiling is enabled
+	profile *Profile
+	// queries counts the queries of this transaction and detects slow and repeated queries
+	queries *queryMonitor
 }
 
 // Execute a query without returning any rows. It panics in case of error.
 // The args are for any placeholder parameters in the query.
 func (c *Cursor) Execute(query string, args ...interface{}) sql.Result {
+	defer c.recordQuery(query, time.Now())
 	return dbExecute(c.tx, query, args...)
 }
 
 // Get queries a row into the database and maps the result into dest.
 // The query must return only one row. Get panics on errors
 func (c *Cursor) Get(dest interface{}, query string, args ...interface{}) {
+	defer c.recordQuery(query, time.Now())
 	dbGet(c.tx, dest, query, args...)
 }
 
 // Select queries multiple rows and map the result into dest which must be a slice.
 // Select panics on errors.
 func (c *Cursor) Select(dest interface{}, query string, args ...interface{}) {
+	defer c.recordQuery(query, time.Now())
 	dbSelect(c.tx, dest, query, args...)
 }
 
+// query queries multiple rows and returns them as a sqlx.Rows.
+// It panics on errors.
+func (c *Cursor) query(query string, args ...interface{}) *sqlx.Rows {
+	defer c.recordQuery(query, time.Now())
+	return dbQuery(c.tx, query, args...)
+}
+
+// recordQuery records the given query started at start time in the
+// query counters of this cursor and in its profile, if any.
+func (c *Cursor) recordQuery(query string, start time.Time) {
+	duration := time.Now().Sub(start)
+	c.queries.addQuery(query, duration)
+	if c.profile != nil {
+		c.profile.addQuery(query, duration)
+	}
+}
+
 // newCursor returns a new db cursor on the given database
 func newCursor(db *sqlx.DB) *Cursor {
 	adapter := adapters[db.DriverName()]
 	tx := db.MustBegin()
 	dbExecute(tx, adapter.setTransactionIsolation())
 	return &Cursor{
-		tx: tx,
+		tx:      tx,
+		queries: newQueryMonitor(),
 	}
 }
 
@@ -114,6 +149,7 @@ func newCursor(db *sqlx.DB) *Cursor {
 // connection data.
 func DBConnect(driver, connData string) {
 	db = sqlx.MustConnect(driver, connData)
+	dbConnData = connData
 	log.Info("Connected to database", "driver", driver, "connData", connData)
 }
 
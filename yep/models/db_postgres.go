@@ -52,6 +52,7 @@ var pgTypes = map[fieldtype.Type]string{
 	fieldtype.Float:     "double precision",
 	fieldtype.HTML:      "text",
 	fieldtype.Binary:    "bytea",
+	fieldtype.Image:     "bytea",
 	fieldtype.Selection: "varchar",
 	fieldtype.Many2One:  "integer",
 	fieldtype.One2One:   "integer",
@@ -67,6 +68,7 @@ var pgDefaultValues = map[fieldtype.Type]string{
 	fieldtype.Float:     "0.0",
 	fieldtype.HTML:      "''",
 	fieldtype.Binary:    "''",
+	fieldtype.Image:     "''",
 	fieldtype.Selection: "''",
 }
 
@@ -87,6 +89,26 @@ func (d *postgresAdapter) typeSQL(fi *Field) string {
 	return typ
 }
 
+// pgDataTypes maps the type aliases of pgTypes to the canonical type
+// names reported by information_schema.
+var pgDataTypes = map[string]string{
+	"bool":    "boolean",
+	"varchar": "character varying",
+}
+
+// columnDataType returns the data type of the column of the given Field,
+// as reported in the data_type column of information_schema.columns.
+func (d *postgresAdapter) columnDataType(fi *Field) string {
+	if fi.fieldType == fieldtype.Float && fi.digits != (types.Digits{}) {
+		return "numeric"
+	}
+	typ := d.typeSQL(fi)
+	if dataType, ok := pgDataTypes[typ]; ok {
+		return dataType
+	}
+	return typ
+}
+
 // columnSQLDefinition returns the SQL type string, including columns constraints if any
 func (d *postgresAdapter) columnSQLDefinition(fi *Field) string {
 	var res string
@@ -0,0 +1,352 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/models/operator"
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+// domainOperatorAliases maps the operators of Odoo domains that
+// have no equivalent in the operator package to their equivalent.
+var domainOperatorAliases = map[string]operator.Operator{
+	"<>": operator.NotEquals,
+}
+
+// DomainToCondition returns the Condition on the given model equivalent to
+// the given Odoo domain, such as:
+//
+//	[]interface{}{"|", []interface{}{"Name", "=", "John"}, []interface{}{"Profile.Age", ">", 20}}
+//
+// A domain is a list of criteria in Polish notation. Each criterion is a list
+// of a field path, an operator and a value. Criteria are implicitly joined by
+// AND, unless they follow a "&" or "|" operator, which applies to the next two
+// criteria, or a "!" operator, which negates the next criterion.
+//
+// As in Odoo, a false value with the = or != operator on a non boolean field
+// matches NULL values.
+//
+// It returns a nil Condition if the domain is empty, and an error if it is
+// malformed or refers to fields that do not exist in the model or that the
+// user with the given uid is not allowed to read.
+func DomainToCondition(model *Model, uid int64, domain []interface{}) (*Condition, error) {
+	dp := &domainParser{model: model, uid: uid, domain: domain}
+	var res *Condition
+	for dp.pos < len(domain) {
+		cond, err := dp.next()
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = cond
+			continue
+		}
+		res = newCondition().AndCond(res).AndCond(cond)
+	}
+	return res, nil
+}
+
+// A domainParser converts an Odoo domain to a Condition
+type domainParser struct {
+	model  *Model
+	uid    int64
+	domain []interface{}
+	pos    int
+}
+
+// next returns the Condition of the next term of the domain
+// with its operands, and moves after them.
+func (dp *domainParser) next() (*Condition, error) {
+	if dp.pos >= len(dp.domain) {
+		return nil, fmt.Errorf("missing criterion at the end of domain")
+	}
+	term := dp.domain[dp.pos]
+	dp.pos++
+	switch t := term.(type) {
+	case string:
+		switch t {
+		case "&", "|":
+			left, err := dp.next()
+			if err != nil {
+				return nil, err
+			}
+			right, err := dp.next()
+			if err != nil {
+				return nil, err
+			}
+			if t == "|" {
+				return newCondition().AndCond(left).OrCond(right), nil
+			}
+			return newCondition().AndCond(left).AndCond(right), nil
+		case "!":
+			operand, err := dp.next()
+			if err != nil {
+				return nil, err
+			}
+			return newCondition().AndNotCond(operand), nil
+		}
+		return nil, fmt.Errorf("unknown domain operator %s", t)
+	case []interface{}:
+		return dp.criterion(t)
+	}
+	return nil, fmt.Errorf("invalid domain term %v", term)
+}
+
+// criterion returns the Condition of the given domain criterion
+func (dp *domainParser) criterion(crit []interface{}) (*Condition, error) {
+	if len(crit) != 3 {
+		return nil, fmt.Errorf("domain criterion %v must have 3 elements", crit)
+	}
+	path, ok := crit[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid field path %v in domain criterion", crit[0])
+	}
+	opName, ok := crit[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid operator %v in domain criterion", crit[1])
+	}
+	op, ok := domainOperatorAliases[opName]
+	if !ok {
+		op = operator.Operator(opName)
+	}
+	if !op.IsValid() {
+		return nil, fmt.Errorf("unknown operator %s in domain criterion", opName)
+	}
+	fi, err := dp.field(path)
+	if err != nil {
+		return nil, err
+	}
+	value := crit[2]
+	switch {
+	case op.IsMulti():
+		val := reflect.ValueOf(value)
+		if val.Kind() != reflect.Slice {
+			value = []interface{}{value}
+			break
+		}
+		if val.Len() == 0 {
+			// Conditions discard empty lists, so we match
+			// all or no records with the never null id.
+			if op == operator.In {
+				return dp.model.Field("ID").Equals(nil), nil
+			}
+			return dp.model.Field("ID").NotEquals(nil), nil
+		}
+	case value == false && fi.fieldType != fieldtype.Boolean:
+		if op != operator.Equals && op != operator.NotEquals {
+			return nil, fmt.Errorf("false value can only be used with = and != operators")
+		}
+		value = nil
+	}
+	return dp.model.Field(path).AddOperator(op, value), nil
+}
+
+// field returns the field at the end of the given path, or an error if the
+// path is not a valid field path from the model or if the user of the parser
+// is not allowed to read one of its fields.
+func (dp *domainParser) field(path string) (fi *Field, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid field path %s in model %s", path, dp.model.name)
+		}
+	}()
+	jsonizeExpr(dp.model, strings.Split(path, ExprSep))
+	fi = dp.model.getRelatedFieldInfo(path)
+	if !dp.model.CanAccessFieldPath(dp.uid, path, security.Read) {
+		return nil, fmt.Errorf("not allowed to read field %s in model %s", path, dp.model.name)
+	}
+	return fi, nil
+}
+
+// ParseDomain returns the Condition on the given model equivalent to the
+// given Odoo domain string, such as:
+//
+//	[('name', 'ilike', 'John'), '|', ('profile_id.age', '>', 20), ('active', '=', True)]
+//
+// The domain can be written in JSON or in Python literal syntax, that is with
+// lists or tuples, single or double quoted strings, numbers, and the True,
+// False and None constants. Other Python expressions, such as variables or
+// function calls, are not supported.
+//
+// Field paths and operators are validated as in DomainToCondition.
+// It returns a nil Condition if the domain is empty.
+func ParseDomain(model *Model, uid int64, domain string) (*Condition, error) {
+	if strings.TrimSpace(domain) == "" {
+		return nil, nil
+	}
+	lp := &literalParser{input: []rune(domain)}
+	value, err := lp.value()
+	if err != nil {
+		return nil, err
+	}
+	lp.skipSpaces()
+	if lp.pos < len(lp.input) {
+		return nil, lp.errorf("unexpected %q after domain", lp.input[lp.pos])
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("domain must be a list")
+	}
+	return DomainToCondition(model, uid, list)
+}
+
+// A literalParser parses JSON and Python literals. Lists and tuples are
+// returned as []interface{}, integers as int64 and other numbers as float64.
+type literalParser struct {
+	input []rune
+	pos   int
+}
+
+// errorf returns an error with the given formatted
+// message and the current position of the parser.
+func (lp *literalParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid domain at position %d: %s", lp.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpaces moves the parser after white spaces
+func (lp *literalParser) skipSpaces() {
+	for lp.pos < len(lp.input) && unicode.IsSpace(lp.input[lp.pos]) {
+		lp.pos++
+	}
+}
+
+// value parses the next literal value
+func (lp *literalParser) value() (interface{}, error) {
+	lp.skipSpaces()
+	if lp.pos >= len(lp.input) {
+		return nil, lp.errorf("unexpected end of domain")
+	}
+	switch r := lp.input[lp.pos]; {
+	case r == '[':
+		return lp.list(']')
+	case r == '(':
+		return lp.list(')')
+	case r == '\'' || r == '"':
+		return lp.str()
+	case r == '-' || r == '+' || r == '.' || unicode.IsDigit(r):
+		return lp.number()
+	case unicode.IsLetter(r):
+		return lp.constant()
+	default:
+		return nil, lp.errorf("unexpected %q", r)
+	}
+}
+
+// list parses a list or a tuple ending with the given rune
+func (lp *literalParser) list(end rune) ([]interface{}, error) {
+	lp.pos++
+	res := []interface{}{}
+	for {
+		lp.skipSpaces()
+		if lp.pos < len(lp.input) && lp.input[lp.pos] == end {
+			lp.pos++
+			return res, nil
+		}
+		elem, err := lp.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, elem)
+		lp.skipSpaces()
+		if lp.pos >= len(lp.input) {
+			return nil, lp.errorf("missing %q", end)
+		}
+		switch lp.input[lp.pos] {
+		case ',':
+			lp.pos++
+		case end:
+		default:
+			return nil, lp.errorf("expected ',' or %q, got %q", end, lp.input[lp.pos])
+		}
+	}
+}
+
+// str parses a single or double quoted string
+func (lp *literalParser) str() (string, error) {
+	quote := lp.input[lp.pos]
+	lp.pos++
+	var res []rune
+	for lp.pos < len(lp.input) {
+		r := lp.input[lp.pos]
+		lp.pos++
+		switch r {
+		case quote:
+			return string(res), nil
+		case '\\':
+			if lp.pos >= len(lp.input) {
+				return "", lp.errorf("unterminated string")
+			}
+			esc := lp.input[lp.pos]
+			lp.pos++
+			switch esc {
+			case 'n':
+				res = append(res, '\n')
+			case 't':
+				res = append(res, '\t')
+			case 'r':
+				res = append(res, '\r')
+			case 'u':
+				if lp.pos+4 > len(lp.input) {
+					return "", lp.errorf("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(string(lp.input[lp.pos:lp.pos+4]), 16, 32)
+				if err != nil {
+					return "", lp.errorf("invalid unicode escape")
+				}
+				res = append(res, rune(code))
+				lp.pos += 4
+			default:
+				res = append(res, esc)
+			}
+		default:
+			res = append(res, r)
+		}
+	}
+	return "", lp.errorf("unterminated string")
+}
+
+// number parses an integer or a floating point number
+func (lp *literalParser) number() (interface{}, error) {
+	start := lp.pos
+	for lp.pos < len(lp.input) && strings.ContainsRune("+-.eE0123456789", lp.input[lp.pos]) {
+		lp.pos++
+	}
+	text := string(lp.input[start:lp.pos])
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		lp.pos = start
+		return nil, lp.errorf("invalid number %s", text)
+	}
+	return f, nil
+}
+
+// constant parses the True, False and None constants
+// of Python and the true, false and null constants of JSON.
+func (lp *literalParser) constant() (interface{}, error) {
+	start := lp.pos
+	for lp.pos < len(lp.input) && (unicode.IsLetter(lp.input[lp.pos]) || unicode.IsDigit(lp.input[lp.pos]) || lp.input[lp.pos] == '_') {
+		lp.pos++
+	}
+	switch name := string(lp.input[start:lp.pos]); name {
+	case "True", "true":
+		return true, nil
+	case "False", "false":
+		return false, nil
+	case "None", "null":
+		return nil, nil
+	default:
+		lp.pos = start
+		return nil, lp.errorf("unsupported expression %s", name)
+	}
+}
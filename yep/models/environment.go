@@ -15,7 +15,11 @@
 package models
 
 import (
+	"context"
+	"sync"
+
 	"github.com/lib/pq"
+	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/models/types"
 	"github.com/npiganeau/yep/yep/tools/logging"
 )
@@ -54,6 +58,54 @@ func (env Environment) Context() *types.Context {
 	return env.context
 }
 
+// CompanyIDs returns the ids of the companies the user of this Environment is
+// allowed to access, i.e. the user's current company and allowed companies. The
+// superuser is allowed to access all companies.
+//
+// If the context has an "allowed_company_ids" key, the result is restricted to
+// the given companies.
+func (env Environment) CompanyIDs() []int64 {
+	var ids []int64
+	if env.uid == security.SuperUserID {
+		ids = env.Pool("Company").Sudo().FetchAll().Ids()
+	} else {
+		user := env.Pool("Users").Sudo().withIds([]int64{env.uid})
+		ids = user.Get("Companies").(RecordCollection).Ids()
+		if company := user.Get("Company").(RecordCollection); !company.IsEmpty() && !containsID(ids, company.Ids()[0]) {
+			ids = append([]int64{company.Ids()[0]}, ids...)
+		}
+	}
+	if !env.context.HasKey("allowed_company_ids") {
+		return ids
+	}
+	var res []int64
+	for _, id := range contextIDs(env.context.Get("allowed_company_ids")) {
+		if containsID(ids, id) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// CompanyID returns the id of the current company of this Environment. This
+// is the first of the "allowed_company_ids" of the context if any, or the
+// current company of the user otherwise. It returns 0 if there is no current
+// company.
+func (env Environment) CompanyID() int64 {
+	if env.context.HasKey("allowed_company_ids") {
+		if ids := env.CompanyIDs(); len(ids) > 0 {
+			return ids[0]
+		}
+		return 0
+	}
+	user := env.Pool("Users").Sudo().withIds([]int64{env.uid})
+	company := user.Get("Company").(RecordCollection)
+	if company.IsEmpty() {
+		return 0
+	}
+	return company.Ids()[0]
+}
+
 // commit the transaction of this environment.
 //
 // WARNING: Do NOT call Commit on Environment instances that you
@@ -61,6 +113,9 @@ func (env Environment) Context() *types.Context {
 // automatically commit the Environment.
 func (env Environment) commit() {
 	env.cr.tx.Commit()
+	updateSecurityRegistry(env.cr)
+	env.cr.queries.report()
+	endProfile(env.cr)
 }
 
 // rollback the transaction of this environment.
@@ -70,6 +125,8 @@ func (env Environment) commit() {
 // for the framework to roll back automatically for you.
 func (env Environment) rollback() {
 	env.cr.tx.Rollback()
+	env.cr.queries.report()
+	endProfile(env.cr)
 }
 
 // newEnvironment returns a new Environment with the given parameters
@@ -89,9 +146,62 @@ func newEnvironment(uid int64, context ...types.Context) Environment {
 		context: &ctx,
 		cache:   newCache(),
 	}
+	if profilingEnabled() {
+		env.cr.profile = newProfile(uid)
+	}
 	return env
 }
 
+// runningEnvironments counts the environments created by ExecuteInNewEnvironment
+// and SimulateInNewEnvironment that have not been committed or rolled back yet.
+// idle is closed when count drops to zero.
+var runningEnvironments struct {
+	sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+// startEnvironment records the start of a new environment
+// and returns the function to call when it is terminated.
+func startEnvironment() func() {
+	runningEnvironments.Lock()
+	defer runningEnvironments.Unlock()
+	if runningEnvironments.count == 0 {
+		runningEnvironments.idle = make(chan struct{})
+	}
+	runningEnvironments.count++
+	return func() {
+		runningEnvironments.Lock()
+		defer runningEnvironments.Unlock()
+		runningEnvironments.count--
+		if runningEnvironments.count == 0 {
+			close(runningEnvironments.idle)
+		}
+	}
+}
+
+// WaitForEnvironments blocks until all the environments created by
+// ExecuteInNewEnvironment and SimulateInNewEnvironment have been
+// committed or rolled back, or until ctx is done in which case it
+// returns the error of ctx.
+//
+// It is typically called before DBClose when shutting down the server.
+func WaitForEnvironments(ctx context.Context) error {
+	runningEnvironments.Lock()
+	if runningEnvironments.count == 0 {
+		runningEnvironments.Unlock()
+		return nil
+	}
+	idle := runningEnvironments.idle
+	runningEnvironments.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // ExecuteInNewEnvironment executes the given fnct in a new Environment
 // within a new transaction.
 //
@@ -100,6 +210,7 @@ func newEnvironment(uid int64, context ...types.Context) Environment {
 // errors are automatically retried several times before returning an
 // error if they still occur.
 func ExecuteInNewEnvironment(uid int64, fnct func(Environment)) (rError error) {
+	defer startEnvironment()()
 	env := newEnvironment(uid)
 	defer func() {
 		if r := recover(); r != nil {
@@ -108,6 +219,7 @@ func ExecuteInNewEnvironment(uid int64, fnct func(Environment)) (rError error) {
 				// Transaction error
 				env.retries++
 				if env.retries < DBSerializationMaxRetries {
+					transactionRetries.Inc()
 					if ExecuteInNewEnvironment(uid, fnct) == nil {
 						rError = nil
 						return
@@ -129,6 +241,7 @@ func ExecuteInNewEnvironment(uid int64, fnct func(Environment)) (rError error) {
 // This function always rolls back the transaction but returns an error
 // only if fnct panicked during its execution.
 func SimulateInNewEnvironment(uid int64, fnct func(Environment)) (rError error) {
+	defer startEnvironment()()
 	env := newEnvironment(uid)
 	defer func() {
 		env.rollback()
@@ -0,0 +1,158 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+// crudMethods are the names of the methods whose
+// execution permission is checked for each Permission.
+var crudMethods = []struct {
+	perm   security.Permission
+	method string
+}{
+	{security.Read, "Load"},
+	{security.Write, "Write"},
+	{security.Create, "Create"},
+	{security.Unlink, "Unlink"},
+}
+
+// explainAccess is the security.AccessExplainer of the models package.
+// It evaluates method execution permissions, model and field access rights
+// and record rules in the order in which they are checked by the ORM.
+func explainAccess(uid int64, modelName string, ids []int64, perm security.Permission) []security.Check {
+	model, ok := Registry.Get(modelName)
+	if !ok {
+		return []security.Check{{Kind: security.ModelCheck, Name: modelName, Details: []string{"unknown model"}}}
+	}
+	userGroups := security.Registry.UserGroups(uid)
+	var res []security.Check
+	for _, cm := range crudMethods {
+		if perm&cm.perm == 0 {
+			continue
+		}
+		res = append(res, explainMethodPermission(model.methods.MustGet(cm.method), userGroups))
+	}
+	res = append(res, explainModelPermission(model, uid, perm))
+	res = append(res, explainFieldPermissions(model, uid, perm)...)
+	if perm&^security.Create != 0 {
+		for _, id := range ids {
+			res = append(res, explainRecordRules(model, uid, id, perm&^security.Create))
+		}
+	}
+	return res
+}
+
+// explainMethodPermission returns the check of the execution
+// permission of the given method for a user with the given groups.
+func explainMethodPermission(method *Method, userGroups map[*security.Group]security.InheritanceInfo) security.Check {
+	check := security.Check{
+		Kind: security.MethodCheck,
+		Name: fmt.Sprintf("%s.%s", method.model.name, method.name),
+	}
+	var allowed []string
+	for group, ok := range method.groups {
+		if !ok {
+			continue
+		}
+		allowed = append(allowed, group.ID)
+		if _, ok := userGroups[group]; ok {
+			check.Granted = true
+		}
+	}
+	sort.Strings(allowed)
+	check.Details = append(check.Details, fmt.Sprintf("allowed groups: %v", allowed))
+	return check
+}
+
+// explainModelPermission returns the check of the access
+// rights of the user with the given uid on the given model.
+func explainModelPermission(model *Model, uid int64, perm security.Permission) security.Check {
+	check := security.Check{
+		Kind:    security.ModelCheck,
+		Name:    model.name,
+		Granted: checkModelPermission(model, uid, perm),
+	}
+	if uid == security.SuperUserID {
+		check.Details = append(check.Details, "super user has all permissions")
+		return check
+	}
+	acl := getModelAccessRights(model)
+	if acl != nil {
+		check.Details = append(check.Details, "access rights defined by ModelAccess records")
+	} else {
+		acl = model.acl
+		check.Details = append(check.Details, "access rights declared in code")
+	}
+	var rights []string
+	for group, groupPerm := range acl.Permissions() {
+		if groupPerm != 0 {
+			rights = append(rights, fmt.Sprintf("%s: %s", group.ID, groupPerm))
+		}
+	}
+	sort.Strings(rights)
+	check.Details = append(check.Details, rights...)
+	return check
+}
+
+// explainFieldPermissions returns a check for each field of the given
+// model on which the user with the given uid is denied the read or write
+// permission of perm.
+func explainFieldPermissions(model *Model, uid int64, perm security.Permission) []security.Check {
+	var res []security.Check
+	for _, fieldPerm := range []security.Permission{security.Read, security.Write} {
+		if perm&fieldPerm == 0 {
+			continue
+		}
+		var fieldNames []string
+		for fName := range model.fields.registryByName {
+			fieldNames = append(fieldNames, fName)
+		}
+		sort.Strings(fieldNames)
+		for _, fName := range fieldNames {
+			if checkFieldPermission(model.fields.registryByName[fName], uid, fieldPerm) {
+				continue
+			}
+			res = append(res, security.Check{
+				Kind:    security.FieldCheck,
+				Name:    fmt.Sprintf("%s.%s", model.name, fName),
+				Details: []string{fmt.Sprintf("no %s permission, the field is ignored", fieldPerm)},
+			})
+		}
+	}
+	return res
+}
+
+// explainRecordRules returns the check of the record rules of the given
+// model for the user with the given uid on the record with the given id.
+func explainRecordRules(model *Model, uid int64, id int64, perm security.Permission) security.Check {
+	check := security.Check{
+		Kind: security.RecordRuleCheck,
+		Name: fmt.Sprintf("%s,%d", model.name, id),
+	}
+	err := SimulateInNewEnvironment(uid, func(env Environment) {
+		granted, ruleChecks := model.CheckRecordRules(env, id, perm)
+		check.Granted = granted
+		for _, ruleCheck := range ruleChecks {
+			scope := "global"
+			if !ruleCheck.Rule.Global {
+				scope = fmt.Sprintf("group %s", ruleCheck.Rule.Group.ID)
+			}
+			match := "does not match"
+			if ruleCheck.Matches {
+				match = "matches"
+			}
+			check.Details = append(check.Details, fmt.Sprintf("rule %s (%s): %s", ruleCheck.Rule.Name, scope, match))
+		}
+	})
+	if err != nil {
+		check.Granted = false
+		check.Details = append(check.Details, fmt.Sprintf("unable to evaluate record rules: %s", err))
+	}
+	return check
+}
@@ -16,6 +16,7 @@ package models
 
 import (
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -63,6 +64,20 @@ type FieldsCollection struct {
 	bootstrapped         bool
 }
 
+// All returns the fields of this collection sorted by name
+func (fc *FieldsCollection) All() []*Field {
+	names := make([]string, 0, len(fc.registryByName))
+	for name := range fc.registryByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]*Field, len(names))
+	for i, name := range names {
+		res[i] = fc.registryByName[name]
+	}
+	return res
+}
+
 // get returns the Field of the field with the given name.
 // name can be either the name of the field or its JSON name.
 func (fc *FieldsCollection) get(name string) (fi *Field, ok bool) {
@@ -219,6 +234,7 @@ type Field struct {
 	m2mOurField      *Field
 	m2mTheirField    *Field
 	selection        types.Selection
+	selectionMethod  string
 	fieldType        fieldtype.Type
 	groupOperator    string
 	size             int
@@ -231,6 +247,8 @@ type Field struct {
 	defaultFunc      func(Environment, FieldMap) interface{}
 	onDelete         OnDeleteAction
 	translate        bool
+	readOnly         bool
+	imageVariants    map[string]int
 }
 
 // isComputedField returns true if this field is computed
@@ -263,6 +281,60 @@ func (f *Field) isStored() bool {
 	return true
 }
 
+// Name returns the name of this field
+func (f *Field) Name() string {
+	return f.name
+}
+
+// JSON returns the JSON name of this field
+func (f *Field) JSON() string {
+	return f.json
+}
+
+// Type returns the type of this field
+func (f *Field) Type() fieldtype.Type {
+	return f.fieldType
+}
+
+// RelatedModelName returns the name of the model this
+// relation field points to, or an empty string.
+func (f *Field) RelatedModelName() string {
+	return f.relatedModelName
+}
+
+// Help returns the help string of this field
+func (f *Field) Help() string {
+	return f.help
+}
+
+// IsRequired returns true if this field is required
+func (f *Field) IsRequired() bool {
+	return f.required
+}
+
+// IsReadOnly returns true if the value of this field cannot be set, that is
+// for the id field, for read only fields and for computed or related fields.
+func (f *Field) IsReadOnly() bool {
+	return f.json == "id" || f.readOnly || f.isComputedField() || f.isRelatedField()
+}
+
+// selectionValues returns the allowed values of this selection field, that is
+// the values returned by its selection method (if any) updated with its static
+// selection.
+func (f *Field) selectionValues(env Environment) types.Selection {
+	res := make(types.Selection)
+	if f.selectionMethod != "" {
+		sel := env.Pool(f.model.name).Sudo().Call(f.selectionMethod).(types.Selection)
+		for k, v := range sel {
+			res[k] = v
+		}
+	}
+	for k, v := range f.selection {
+		res[k] = v
+	}
+	return res
+}
+
 // checkFieldInfo makes sanity checks on the given Field.
 // It panics in case of severe error and logs recoverable errors.
 func checkFieldInfo(fi *Field) {
@@ -302,16 +374,17 @@ func snakeCaseFieldName(fName string, typ fieldtype.Type) string {
 }
 
 // createM2MRelModelInfo creates a Model relModelName (if it does not exist)
-// for the m2m relation defined between model1 and model2.
+// for the m2m relation defined between model1 and model2. The fields of the
+// intermediate model pointing to model1 and model2 are named field1 and field2.
 // It returns the Model of the intermediate model, the Field of that model
 // pointing to our model, and the Field pointing to the other model.
-func createM2MRelModelInfo(relModelName, model1, model2 string) (*Model, *Field, *Field) {
+func createM2MRelModelInfo(relModelName, model1, model2, field1, field2 string) (*Model, *Field, *Field) {
 	if relMI, exists := Registry.Get(relModelName); exists {
 		var m1, m2 *Field
 		for fName, fi := range relMI.fields.registryByName {
-			if fName == model1 {
+			if fName == field1 {
 				m1 = fi
-			} else if fName == model2 {
+			} else if fName == field2 {
 				m2 = fi
 			}
 		}
@@ -327,8 +400,8 @@ func createM2MRelModelInfo(relModelName, model1, model2 string) (*Model, *Field,
 		options:   Many2ManyLinkModel,
 	}
 	ourField := &Field{
-		name:             model1,
-		json:             strutils.SnakeCaseString(model1) + "_id",
+		name:             field1,
+		json:             strutils.SnakeCaseString(field1) + "_id",
 		acl:              security.NewAccessControlList(),
 		model:            newMI,
 		required:         true,
@@ -338,15 +411,15 @@ func createM2MRelModelInfo(relModelName, model1, model2 string) (*Model, *Field,
 		index:            true,
 		onDelete:         Cascade,
 		structField: reflect.StructField{
-			Name: model1,
+			Name: field1,
 			Type: reflect.TypeOf(int64(0)),
 		},
 	}
 	newMI.fields.add(ourField)
 
 	theirField := &Field{
-		name:             model2,
-		json:             strutils.SnakeCaseString(model2) + "_id",
+		name:             field2,
+		json:             strutils.SnakeCaseString(field2) + "_id",
 		acl:              security.NewAccessControlList(),
 		model:            newMI,
 		required:         true,
@@ -356,7 +429,7 @@ func createM2MRelModelInfo(relModelName, model1, model2 string) (*Model, *Field,
 		index:            true,
 		onDelete:         Cascade,
 		structField: reflect.StructField{
-			Name: model2,
+			Name: field2,
 			Type: reflect.TypeOf(int64(0)),
 		},
 	}
@@ -425,3 +498,24 @@ func checkComputeMethodsSignature() {
 		}
 	}
 }
+
+// checkSelectionMethodsSignature checks all methods used in selection
+// fields and check their signature. It panics if it is not the case.
+func checkSelectionMethodsSignature() {
+	for _, mi := range Registry.registryByName {
+		for _, fi := range mi.fields.registryByName {
+			if fi.selectionMethod == "" {
+				continue
+			}
+			method, ok := mi.methods.get(fi.selectionMethod)
+			if !ok {
+				log.Panic("Unknown selection method", "model", mi.name, "field", fi.name, "method", fi.selectionMethod)
+			}
+			methType := method.methodType
+			if methType.NumIn() != 1 || methType.NumOut() != 1 || methType.Out(0) != reflect.TypeOf(types.Selection{}) {
+				log.Panic("Selection methods should have no arguments and return a types.Selection",
+					"model", mi.name, "field", fi.name, "method", method.name)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/npiganeau/yep/yep/models/fieldtype"
 	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/imageutils"
 	"github.com/npiganeau/yep/yep/tools/strutils"
 )
 
@@ -75,20 +76,21 @@ type StringFieldParams struct {
 
 // A SelectionFieldParams holds all the possible options for a selection field
 type SelectionFieldParams struct {
-	JSON      string
-	String    string
-	Help      string
-	Stored    bool
-	Required  bool
-	Unique    bool
-	Index     bool
-	Compute   string
-	Depends   []string
-	Related   string
-	NoCopy    bool
-	Selection types.Selection
-	Translate bool
-	Default   func(Environment, FieldMap) interface{}
+	JSON            string
+	String          string
+	Help            string
+	Stored          bool
+	Required        bool
+	Unique          bool
+	Index           bool
+	Compute         string
+	Depends         []string
+	Related         string
+	NoCopy          bool
+	Selection       types.Selection
+	SelectionMethod string
+	Translate       bool
+	Default         func(Environment, FieldMap) interface{}
 }
 
 // A ForeignKeyFieldParams holds all the possible options for a many2one or one2one field
@@ -382,6 +384,29 @@ func (m *Model) AddHTMLField(name string, params StringFieldParams) *Field {
 	return m.addStringField(name, params, fieldtype.HTML, reflect.TypeOf(*new(string)))
 }
 
+// AddImageField adds an image field with the given name to this Model.
+// Image fields are binary fields mapped to string type in go, which value must
+// be a base64 encoded PNG, JPEG or GIF image.
+//
+// For each of imageutils.DefaultVariants, a read-only image field named after
+// this field and suffixed with the variant's suffix (e.g. ImageSmall for an
+// Image field) is also added. These fields hold resized versions of the image
+// and are automatically updated when the image is written.
+func (m *Model) AddImageField(name string, params SimpleFieldParams) *Field {
+	fInfo := m.addSimpleField(name, params, fieldtype.Image, reflect.TypeOf(*new(string)))
+	fInfo.imageVariants = make(map[string]int)
+	for _, variant := range imageutils.DefaultVariants {
+		variantParams := SimpleFieldParams{
+			String: fmt.Sprintf("%s (%dpx)", fInfo.description, variant.Size),
+			NoCopy: true,
+		}
+		variantInfo := m.addSimpleField(name+variant.Suffix, variantParams, fieldtype.Image, reflect.TypeOf(*new(string)))
+		variantInfo.readOnly = true
+		fInfo.imageVariants[variantInfo.name] = variant.Size
+	}
+	return fInfo
+}
+
 // AddIntegerField adds an integer field with the given name to this Model.
 // Integer fields are mapped to int64 type in go.
 func (m *Model) AddIntegerField(name string, params SimpleFieldParams) *Field {
@@ -413,7 +438,7 @@ func (m *Model) AddMany2ManyField(name string, params Many2ManyFieldParams) *Fie
 	if m2mRelModName == "" {
 		m2mRelModName = fmt.Sprintf("%s%sRel", modelNames[0], modelNames[1])
 	}
-	m2mRelModel, m2mOurField, m2mTheirField := createM2MRelModelInfo(m2mRelModName, our, their)
+	m2mRelModel, m2mOurField, m2mTheirField := createM2MRelModelInfo(m2mRelModName, m.name, params.RelationModel, our, their)
 
 	json, str := getJSONAndString(name, fieldtype.Float, params.JSON, params.String)
 	fInfo := &Field{
@@ -466,32 +491,36 @@ func (m *Model) AddRev2OneField(name string, params ReverseFieldParams) *Field {
 }
 
 // AddSelectionField adds a selection field with the given name to this Model.
+// Selection fields are mapped to string type in go. Allowed values are the keys
+// of the Selection parameter and of the selection returned by the method given
+// in the SelectionMethod parameter.
 func (m *Model) AddSelectionField(name string, params SelectionFieldParams) *Field {
 	structField := reflect.StructField{
 		Name: name,
-		Type: reflect.TypeOf(*new(types.Selection)),
+		Type: reflect.TypeOf(*new(string)),
 	}
 	json, str := getJSONAndString(name, fieldtype.Float, params.JSON, params.String)
 	fInfo := &Field{
-		model:       m,
-		acl:         security.NewAccessControlList(),
-		name:        name,
-		json:        json,
-		description: str,
-		help:        params.Help,
-		stored:      params.Stored,
-		required:    params.Required,
-		unique:      params.Unique,
-		index:       params.Index,
-		compute:     params.Compute,
-		depends:     params.Depends,
-		relatedPath: params.Related,
-		noCopy:      params.NoCopy,
-		structField: structField,
-		selection:   params.Selection,
-		fieldType:   fieldtype.Selection,
-		defaultFunc: params.Default,
-		translate:   params.Translate,
+		model:           m,
+		acl:             security.NewAccessControlList(),
+		name:            name,
+		json:            json,
+		description:     str,
+		help:            params.Help,
+		stored:          params.Stored,
+		required:        params.Required,
+		unique:          params.Unique,
+		index:           params.Index,
+		compute:         params.Compute,
+		depends:         params.Depends,
+		relatedPath:     params.Related,
+		noCopy:          params.NoCopy,
+		structField:     structField,
+		selection:       params.Selection,
+		selectionMethod: params.SelectionMethod,
+		fieldType:       fieldtype.Selection,
+		defaultFunc:     params.Default,
+		translate:       params.Translate,
 	}
 	m.fields.add(fInfo)
 	return fInfo
@@ -576,6 +605,32 @@ func (f *Field) SetTranslate(value bool) *Field {
 	return f
 }
 
+// SetSelection overrides the value of the Selection parameter of this Field
+func (f *Field) SetSelection(value types.Selection) *Field {
+	f.selection = value
+	return f
+}
+
+// UpdateSelection adds the given value to the Selection parameter of this Field.
+// Keys of value that already exist in the selection override the existing labels.
+func (f *Field) UpdateSelection(value types.Selection) *Field {
+	newSelection := make(types.Selection)
+	for k, v := range f.selection {
+		newSelection[k] = v
+	}
+	for k, v := range value {
+		newSelection[k] = v
+	}
+	f.selection = newSelection
+	return f
+}
+
+// SetSelectionMethod overrides the value of the SelectionMethod parameter of this Field
+func (f *Field) SetSelectionMethod(value string) *Field {
+	f.selectionMethod = value
+	return f
+}
+
 // SetDefault overrides the value of the Default parameter of this Field
 func (f *Field) SetDefault(value func(Environment, FieldMap) interface{}) *Field {
 	f.defaultFunc = value
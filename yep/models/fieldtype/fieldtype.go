@@ -22,6 +22,7 @@ const (
 	DateTime  Type = "datetime"
 	Float     Type = "float"
 	HTML      Type = "html"
+	Image     Type = "image"
 	Integer   Type = "integer"
 	Many2Many Type = "many2many"
 	Many2One  Type = "many2one"
@@ -73,7 +74,7 @@ func (t Type) DefaultGoType() reflect.Type {
 	switch t {
 	case NoType:
 		return reflect.TypeOf(nil)
-	case Binary, Char, Text, HTML:
+	case Binary, Char, Text, HTML, Image, Selection:
 		return reflect.TypeOf(*new(string))
 	case Boolean:
 		return reflect.TypeOf(true)
@@ -87,8 +88,6 @@ func (t Type) DefaultGoType() reflect.Type {
 		return reflect.TypeOf(*new(int64))
 	case One2Many, Many2Many:
 		return reflect.TypeOf(*new([]int64))
-	case Selection:
-		return reflect.TypeOf(*new(types.Selection))
 	}
 	return reflect.TypeOf(nil)
 }
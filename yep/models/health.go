@@ -0,0 +1,67 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CheckDBConnection returns an error if the database is not reachable
+func CheckDBConnection() error {
+	if db == nil {
+		return errors.New("not connected to database")
+	}
+	return db.Ping()
+}
+
+// CheckDatabaseSchema returns an error if the database schema is not
+// compatible with the models, that is if a table or a column of a stored
+// field is missing or if a column has not the type of its field. Such errors
+// are fixed by SyncDatabase.
+//
+// Models must have been bootstrapped before calling this function.
+func CheckDatabaseSchema() (rError error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rError = fmt.Errorf("unable to read database schema: %v", r)
+		}
+	}()
+	adapter := adapters[db.DriverName()]
+	dbTables := adapter.tables()
+	var tableNames []string
+	for tableName, model := range Registry.registryByTableName {
+		if model.isMixin() || model.isManual() {
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	for _, tableName := range tableNames {
+		if !dbTables[tableName] {
+			return fmt.Errorf("table %s is missing", tableName)
+		}
+		model := Registry.registryByTableName[tableName]
+		dbColumns := adapter.columns(tableName)
+		var colNames []string
+		for colName, fi := range model.fields.registryByJSON {
+			if colName == "id" || !fi.isStored() {
+				continue
+			}
+			colNames = append(colNames, colName)
+		}
+		sort.Strings(colNames)
+		for _, colName := range colNames {
+			colData, ok := dbColumns[colName]
+			if !ok {
+				return fmt.Errorf("column %s of table %s is missing", colName, tableName)
+			}
+			if fieldType := adapter.columnDataType(model.fields.registryByJSON[colName]); colData.DataType != fieldType {
+				return fmt.Errorf("column %s of table %s has type %s instead of %s", colName, tableName, colData.DataType, fieldType)
+			}
+		}
+	}
+	return nil
+}
@@ -15,9 +15,13 @@
 package models
 
 import (
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/tools/logging"
 	"github.com/npiganeau/yep/yep/tools/strutils"
+	"github.com/spf13/viper"
 )
 
 var log *logging.Logger
@@ -25,6 +29,13 @@ var log *logging.Logger
 func init() {
 	log = logging.GetLogger("models")
 	sqlx.NameMapper = strutils.SnakeCaseString
+	// configuration defaults, set once since viper is not safe for concurrent writes
+	viper.SetDefault("DB.SlowQueryThreshold", 500*time.Millisecond)
+	viper.SetDefault("DB.RepeatedQueryThreshold", 20)
+	viper.SetDefault("LDAP.Port", 389)
+	viper.SetDefault("LDAP.Filter", "(uid=%s)")
+	viper.SetDefault("LDAP.NameAttribute", "cn")
+	viper.SetDefault("LDAP.GroupAttribute", "memberOf")
 	// DB drivers
 	adapters = make(map[string]dbAdapter)
 	registerDBAdapter("postgres", new(postgresAdapter))
@@ -34,4 +45,24 @@ func init() {
 	declareCommonMixin()
 	declareBaseMixin()
 	declareModelMixin()
+	// declare framework models
+	declareCompanyModels()
+	declareUsersModel()
+	declareGroupModel()
+	declareModelAccessModel()
+	declareAPIKeyModel()
+	declareTOTPFields()
+	declareSessionModel()
+	declareBusMessageModel()
+	declareRateLimitBucketModel()
+	// authentication backends
+	// LDAP is registered first so that local passwords are checked before
+	// the directory is queried.
+	security.AuthenticationRegistry.RegisterBackend(LDAPAuthBackend{})
+	security.AuthenticationRegistry.RegisterBackend(DBAuthBackend{})
+	// access explanations
+	security.RegisterAccessExplainer(explainAccess)
+	// bus channels
+	RegisterBusChannel("user", authorizeUserChannel)
+	RegisterBusChannel("record", authorizeRecordChannel)
 }
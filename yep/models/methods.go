@@ -83,6 +83,7 @@ type Method struct {
 	nextLayer     map[*methodLayer]*methodLayer
 	groups        map[*security.Group]bool
 	groupsCallers map[callerGroup]bool
+	exposed       bool
 }
 
 // addMethodLayer adds the given layer to this Method.
@@ -102,6 +103,16 @@ func (m *Method) getNextLayer(methodLayer *methodLayer) *methodLayer {
 	return m.nextLayer[methodLayer]
 }
 
+// layerDepth returns the depth of the given layer in the layers of this
+// method, 0 being the top layer.
+func (m *Method) layerDepth(methLayer *methodLayer) int {
+	var depth int
+	for cl := m.topLayer; cl != nil && cl != methLayer; cl = m.getNextLayer(cl) {
+		depth++
+	}
+	return depth
+}
+
 // invertedLayers returns the list of method layers starting
 // from the base methods and going up all inherited layers
 func (m *Method) invertedLayers() []*methodLayer {
@@ -185,6 +196,7 @@ func copyMethod(m *Model, method *Method) *Method {
 		nextLayer:     make(map[*methodLayer]*methodLayer),
 		groups:        make(map[*security.Group]bool),
 		groupsCallers: make(map[callerGroup]bool),
+		exposed:       method.exposed,
 	}
 }
 
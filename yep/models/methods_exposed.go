@@ -0,0 +1,329 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/openapi"
+)
+
+var (
+	recordSetType       = reflect.TypeOf((*RecordSet)(nil)).Elem()
+	conditionType       = reflect.TypeOf(Condition{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// Name returns the name of this method
+func (m *Method) Name() string {
+	return m.name
+}
+
+// Doc returns the documentation of this method, that is the
+// documentation of its first layer with collapsed white spaces.
+func (m *Method) Doc() string {
+	m.RLock()
+	defer m.RUnlock()
+	for _, layer := range m.invertedLayers() {
+		if layer.doc != "" {
+			return strings.Join(strings.Fields(layer.doc), " ")
+		}
+	}
+	return ""
+}
+
+// Expose makes this method callable by the web APIs on the records of its
+// model. Execution permissions still apply to exposed methods.
+//
+// Exposed methods must not be variadic and must return at most one value.
+// Their arguments must be JSON decodable and cannot be RecordSets or
+// Conditions, so that they can be given as a JSON array. Expose panics
+// if this method does not meet these conditions.
+func (m *Method) Expose() *Method {
+	m.Lock()
+	defer m.Unlock()
+	if m.methodType.IsVariadic() {
+		log.Panic("Variadic methods cannot be exposed", "model", m.model.name, "method", m.name)
+	}
+	if m.methodType.NumOut() > 1 {
+		log.Panic("Methods with several return values cannot be exposed", "model", m.model.name, "method", m.name)
+	}
+	for i := 1; i < m.methodType.NumIn(); i++ {
+		if _, ok := goTypeSchema(m.methodType.In(i), false, make(map[reflect.Type]bool)); !ok {
+			log.Panic("Method argument cannot be decoded from JSON", "model", m.model.name, "method", m.name,
+				"argument", i, "type", m.methodType.In(i))
+		}
+	}
+	if m.methodType.NumOut() == 1 {
+		if _, ok := goTypeSchema(m.methodType.Out(0), true, make(map[reflect.Type]bool)); !ok {
+			log.Panic("Method return value cannot be encoded to JSON", "model", m.model.name, "method", m.name,
+				"type", m.methodType.Out(0))
+		}
+	}
+	m.exposed = true
+	return m
+}
+
+// IsExposed returns true if this method can be called by the web APIs
+func (m *Method) IsExposed() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.exposed
+}
+
+// CanExecute returns true if the user with the given uid is allowed
+// to call this method directly, that is not from another method.
+func (m *Method) CanExecute(uid int64) bool {
+	m.RLock()
+	defer m.RUnlock()
+	for group := range security.Registry.UserGroups(uid) {
+		if m.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the Method with the given name and true,
+// or false if this collection has no such method.
+func (mc *MethodsCollection) Get(methodName string) (*Method, bool) {
+	return mc.get(methodName)
+}
+
+// Exposed returns the exposed methods of this collection sorted by name
+func (mc *MethodsCollection) Exposed() []*Method {
+	var res []*Method
+	for _, meth := range mc.registry {
+		if meth.IsExposed() {
+			res = append(res, meth)
+		}
+	}
+	sort.Sort(methodsByName(res))
+	return res
+}
+
+// methodsByName sorts a slice of Method by their name
+type methodsByName []*Method
+
+func (m methodsByName) Len() int           { return len(m) }
+func (m methodsByName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m methodsByName) Less(i, j int) bool { return m[i].name < m[j].name }
+
+// CallJSON calls this exposed method on the given RecordCollection with
+// the arguments given as a JSON array in data and returns its result.
+// data may be empty if the method takes no argument. RecordSets returned
+// by the method are converted to slices of ids.
+//
+// It returns an error if this method is not exposed or if the arguments
+// cannot be decoded. Errors of the method itself are panics as usual.
+func (m *Method) CallJSON(rc RecordCollection, data []byte) (interface{}, error) {
+	if !m.IsExposed() {
+		return nil, fmt.Errorf("method %s of model %s is not exposed", m.name, m.model.name)
+	}
+	var rawArgs []json.RawMessage
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &rawArgs); err != nil {
+			return nil, fmt.Errorf("arguments must be a JSON array: %s", err)
+		}
+	}
+	if len(rawArgs) != m.methodType.NumIn()-1 {
+		return nil, fmt.Errorf("method %s of model %s takes %d arguments, %d given",
+			m.name, m.model.name, m.methodType.NumIn()-1, len(rawArgs))
+	}
+	args := make([]interface{}, len(rawArgs))
+	for i, rawArg := range rawArgs {
+		arg := reflect.New(m.methodType.In(i + 1))
+		if err := json.Unmarshal(rawArg, arg.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid argument %d: %s", i+1, err)
+		}
+		args[i] = arg.Elem().Interface()
+	}
+	res := rc.Call(m.name, args...)
+	if rs, ok := res.(RecordSet); ok {
+		return rs.Ids(), nil
+	}
+	return res, nil
+}
+
+// ArgsSchema returns the schema of the JSON array of the arguments
+// of this method, or nil if it takes no argument.
+func (m *Method) ArgsSchema() *openapi.Schema {
+	nArgs := m.methodType.NumIn() - 1
+	if nArgs == 0 {
+		return nil
+	}
+	var items []*openapi.Schema
+	descriptions := make([]string, nArgs)
+	for i := 0; i < nArgs; i++ {
+		argType := m.methodType.In(i + 1)
+		schema, _ := goTypeSchema(argType, false, make(map[reflect.Type]bool))
+		descriptions[i] = fmt.Sprintf("%d. %s", i+1, argType)
+		if !containsSchema(items, schema) {
+			items = append(items, schema)
+		}
+	}
+	res := &openapi.Schema{
+		Type:        "array",
+		Description: fmt.Sprintf("The arguments of the method: %s", strings.Join(descriptions, ", ")),
+		MinItems:    &nArgs,
+		MaxItems:    &nArgs,
+		Items:       items[0],
+	}
+	if len(items) > 1 {
+		res.Items = &openapi.Schema{OneOf: items}
+	}
+	return res
+}
+
+// ResultSchema returns the schema of the value returned
+// by this method, or nil if it returns nothing.
+func (m *Method) ResultSchema() *openapi.Schema {
+	if m.methodType.NumOut() == 0 {
+		return nil
+	}
+	res, _ := goTypeSchema(m.methodType.Out(0), true, make(map[reflect.Type]bool))
+	return res
+}
+
+// containsSchema returns true if schemas contains a schema equal to schema
+func containsSchema(schemas []*openapi.Schema, schema *openapi.Schema) bool {
+	for _, s := range schemas {
+		if reflect.DeepEqual(s, schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// goTypeSchema returns the schema of the JSON values of the given Go type
+// and true, or false if values of this type cannot be decoded from JSON or,
+// if result is true, encoded to JSON. seen holds the struct types being
+// documented to stop recursion.
+//
+// RecordSets can only be encoded, as slices of ids.
+func goTypeSchema(typ reflect.Type, result bool, seen map[reflect.Type]bool) (*openapi.Schema, bool) {
+	switch {
+	case typ.Implements(recordSetType):
+		if !result {
+			return nil, false
+		}
+		return &openapi.Schema{Type: "array", Description: "Ids of records", Items: &openapi.Schema{Type: "integer", Format: "int64"}}, true
+	case typ == conditionType || typ == reflect.PtrTo(conditionType):
+		return nil, false
+	case typ == reflect.TypeOf(types.Date{}) || typ == reflect.TypeOf(types.DateTime{}):
+		// These types do not implement json.Unmarshaler
+		if !result {
+			return nil, false
+		}
+		if typ == reflect.TypeOf(types.Date{}) {
+			return dateSchema(), true
+		}
+		return dateTimeSchema(), true
+	case typ == reflect.TypeOf(time.Time{}):
+		return &openapi.Schema{Type: "string", Format: "date-time"}, true
+	case result && typ.Implements(jsonMarshalerType), !result && reflect.PtrTo(typ).Implements(jsonUnmarshalerType):
+		// We cannot tell the schema of custom JSON values
+		return &openapi.Schema{}, true
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &openapi.Schema{Type: "boolean"}, true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &openapi.Schema{Type: "integer", Format: "int32"}, true
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &openapi.Schema{Type: "integer", Format: "int64"}, true
+	case reflect.Float32:
+		return &openapi.Schema{Type: "number", Format: "float"}, true
+	case reflect.Float64:
+		return &openapi.Schema{Type: "number", Format: "double"}, true
+	case reflect.String:
+		return &openapi.Schema{Type: "string"}, true
+	case reflect.Interface:
+		if typ.NumMethod() > 0 && !result {
+			return nil, false
+		}
+		return &openapi.Schema{}, true
+	case reflect.Ptr:
+		res, ok := goTypeSchema(typ.Elem(), result, seen)
+		if !ok {
+			return nil, false
+		}
+		if res.Ref == "" {
+			res.Nullable = true
+		}
+		return res, true
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &openapi.Schema{Type: "string", Format: "byte"}, true
+		}
+		items, ok := goTypeSchema(typ.Elem(), result, seen)
+		if !ok {
+			return nil, false
+		}
+		return &openapi.Schema{Type: "array", Items: items}, true
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return nil, false
+		}
+		values, ok := goTypeSchema(typ.Elem(), result, seen)
+		if !ok {
+			return nil, false
+		}
+		return &openapi.Schema{Type: "object", AdditionalProperties: values}, true
+	case reflect.Struct:
+		if seen[typ] {
+			return &openapi.Schema{Type: "object"}, true
+		}
+		seen[typ] = true
+		defer delete(seen, typ)
+		res := &openapi.Schema{Type: "object", Properties: make(map[string]*openapi.Schema)}
+		if !addStructPropertiesSchemas(res, typ, result, seen) {
+			return nil, false
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// addStructPropertiesSchemas adds to the properties of schema the schemas
+// of the exported fields of the given struct type, following the rules of
+// the encoding/json package for names and embedded structs. It returns
+// false if one of the fields is not supported by goTypeSchema.
+func addStructPropertiesSchemas(schema *openapi.Schema, typ reflect.Type, result bool, seen map[reflect.Type]bool) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			if !addStructPropertiesSchemas(schema, sf.Type, result, seen) {
+				return false
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			// Unexported field
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fieldSchema, ok := goTypeSchema(sf.Type, result, seen)
+		if !ok {
+			return false
+		}
+		schema.Properties[name] = fieldSchema
+	}
+	return true
+}
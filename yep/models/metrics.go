@@ -0,0 +1,47 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	methodCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "yep",
+		Name:      "method_call_duration_seconds",
+		Help:      "Duration of model method calls, including their sub calls, by model and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"model", "method"})
+	transactionRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "yep",
+		Name:      "transaction_retries_total",
+		Help:      "Number of transactions retried after a serialization failure.",
+	})
+	dbOpenConnections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "yep",
+		Name:      "db_open_connections",
+		Help:      "Number of open connections to the database.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().OpenConnections)
+	})
+)
+
+// observeMethodCall returns a function that records the duration
+// of the call of the given method of the given model when called.
+func observeMethodCall(modelName, methName string) func() {
+	start := time.Now()
+	return func() {
+		methodCallDuration.WithLabelValues(modelName, methName).Observe(time.Now().Sub(start).Seconds())
+	}
+}
+
+func init() {
+	prometheus.MustRegister(methodCallDuration, transactionRetries, dbOpenConnections)
+}
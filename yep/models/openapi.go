@@ -0,0 +1,90 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/tools/openapi"
+)
+
+// dateSchema returns the schema of types.Date values
+func dateSchema() *openapi.Schema {
+	return &openapi.Schema{Type: "string", Format: "date", Nullable: true,
+		Description: "Date as YYYY-MM-DD or false if not set"}
+}
+
+// dateTimeSchema returns the schema of types.DateTime values. Their
+// format is not RFC 3339 so that the "date-time" format cannot be used.
+func dateTimeSchema() *openapi.Schema {
+	return &openapi.Schema{Type: "string", Nullable: true,
+		Description: "Date and time as YYYY-MM-DD HH:MM:SS in UTC or false if not set"}
+}
+
+// JSONSchema returns the schema of the records of this model as
+// returned by the web APIs. Properties are the JSON names of the
+// fields of the model.
+func (m *Model) JSONSchema() *openapi.Schema {
+	res := &openapi.Schema{
+		Type:       "object",
+		Title:      m.name,
+		Properties: make(map[string]*openapi.Schema),
+	}
+	for _, field := range m.fields.registryByName {
+		res.Properties[field.json] = field.jsonSchema()
+		if field.required {
+			res.Required = append(res.Required, field.json)
+		}
+	}
+	sort.Strings(res.Required)
+	return res
+}
+
+// jsonSchema returns the schema of the values of this field
+func (f *Field) jsonSchema() *openapi.Schema {
+	var res *openapi.Schema
+	switch f.fieldType {
+	case fieldtype.Boolean:
+		res = &openapi.Schema{Type: "boolean"}
+	case fieldtype.Integer:
+		res = &openapi.Schema{Type: "integer", Format: "int64"}
+	case fieldtype.Float:
+		res = &openapi.Schema{Type: "number", Format: "double"}
+	case fieldtype.Char:
+		res = &openapi.Schema{Type: "string", MaxLength: f.size}
+	case fieldtype.Text, fieldtype.HTML, fieldtype.Reference:
+		res = &openapi.Schema{Type: "string"}
+	case fieldtype.Binary, fieldtype.Image:
+		res = &openapi.Schema{Type: "string", Format: "byte"}
+	case fieldtype.Date:
+		res = dateSchema()
+	case fieldtype.DateTime:
+		res = dateTimeSchema()
+	case fieldtype.Selection:
+		res = &openapi.Schema{Type: "string"}
+		if f.selectionMethod == "" {
+			for key := range f.selection {
+				res.Enum = append(res.Enum, key)
+			}
+			sort.Strings(res.Enum)
+		}
+	case fieldtype.Many2One, fieldtype.One2One, fieldtype.Rev2One:
+		res = &openapi.Schema{Type: "integer", Format: "int64", Nullable: true, Relation: f.relatedModelName,
+			Description: "Id of the related record, or the related record if its fields are requested"}
+	case fieldtype.One2Many, fieldtype.Many2Many:
+		res = &openapi.Schema{Type: "array", Relation: f.relatedModelName,
+			Items:       &openapi.Schema{Type: "integer", Format: "int64"},
+			Description: "Ids of the related records, or the related records if their fields are requested"}
+	default:
+		res = &openapi.Schema{}
+	}
+	res.Title = f.description
+	if f.help != "" {
+		res.Description = strings.TrimSpace(f.help + "\n" + res.Description)
+	}
+	res.ReadOnly = f.IsReadOnly()
+	return res
+}
@@ -0,0 +1,232 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// A ProfiledQuery is an SQL query executed during a profiled method call
+type ProfiledQuery struct {
+	Query    string
+	Duration time.Duration
+}
+
+// A ProfiledCall is a method call recorded by the profiler.
+//
+// Depth is the depth of the called method layer in the layers of the
+// method, 0 being the layer that has been defined last. Queries are the
+// SQL queries issued by this call, excluding those of its sub calls.
+type ProfiledCall struct {
+	Model    string
+	Method   string
+	Depth    int
+	Duration time.Duration
+	Queries  []ProfiledQuery
+	Calls    []*ProfiledCall
+	parent   *ProfiledCall
+	start    time.Time
+}
+
+// Name returns the "Model.Method" name of this call
+func (pc *ProfiledCall) Name() string {
+	return fmt.Sprintf("%s.%s", pc.Model, pc.Method)
+}
+
+// selfDuration returns the duration of this call
+// minus the duration of its sub calls.
+func (pc *ProfiledCall) selfDuration() time.Duration {
+	res := pc.Duration
+	for _, sub := range pc.Calls {
+		res -= sub.Duration
+	}
+	return res
+}
+
+// A Profile records the method calls and the SQL queries made
+// in an Environment, that is in a single transaction.
+//
+// Calls and Queries are the top level method calls and the
+// queries that have been issued outside any method call.
+type Profile struct {
+	sync.Mutex
+	UID      int64
+	Start    time.Time
+	Duration time.Duration
+	Calls    []*ProfiledCall
+	Queries  []ProfiledQuery
+	current  *ProfiledCall
+}
+
+// newProfile returns a new Profile for the given uid
+func newProfile(uid int64) *Profile {
+	return &Profile{
+		UID:   uid,
+		Start: time.Now(),
+	}
+}
+
+// enterCall records the start of a call of the given method layer
+// and returns the function to call when the method returns.
+func (p *Profile) enterCall(modelName string, methLayer *methodLayer) func() {
+	p.Lock()
+	defer p.Unlock()
+	call := &ProfiledCall{
+		Model:  modelName,
+		Method: methLayer.method.name,
+		Depth:  methLayer.method.layerDepth(methLayer),
+		parent: p.current,
+		start:  time.Now(),
+	}
+	if p.current == nil {
+		p.Calls = append(p.Calls, call)
+	} else {
+		p.current.Calls = append(p.current.Calls, call)
+	}
+	p.current = call
+	return func() {
+		p.Lock()
+		defer p.Unlock()
+		call.Duration = time.Now().Sub(call.start)
+		p.current = call.parent
+	}
+}
+
+// addQuery records the given query executed in the given duration
+func (p *Profile) addQuery(query string, duration time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	pq := ProfiledQuery{Query: query, Duration: duration}
+	if p.current == nil {
+		p.Queries = append(p.Queries, pq)
+		return
+	}
+	p.current.Queries = append(p.current.Queries, pq)
+}
+
+// Tree returns a human readable tree of the calls of this Profile
+// with their duration and the number of queries they issued.
+func (p *Profile) Tree() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Profile of uid %d started at %s (%s, %d queries outside methods)\n",
+		p.UID, p.Start.Format(time.RFC3339), p.Duration, len(p.Queries))
+	var printCalls func(calls []*ProfiledCall, indent string)
+	printCalls = func(calls []*ProfiledCall, indent string) {
+		for _, call := range calls {
+			fmt.Fprintf(&buf, "%s%s [layer %d] %s, %d queries\n", indent, call.Name(), call.Depth, call.Duration, len(call.Queries))
+			printCalls(call.Calls, indent+"  ")
+		}
+	}
+	printCalls(p.Calls, "  ")
+	return buf.String()
+}
+
+// WriteFolded writes the calls of this Profile to w in the folded stacks
+// format used by flame graph tools, that is one line per call stack with
+// the semicolon separated method names and the time spent in the last
+// method, excluding its sub calls, in microseconds. Identical stacks are
+// merged.
+func (p *Profile) WriteFolded(w io.Writer) error {
+	stacks := make(map[string]time.Duration)
+	var walk func(calls []*ProfiledCall, prefix string)
+	walk = func(calls []*ProfiledCall, prefix string) {
+		for _, call := range calls {
+			stack := call.Name()
+			if prefix != "" {
+				stack = prefix + ";" + stack
+			}
+			stacks[stack] += call.selfDuration()
+			walk(call.Calls, stack)
+		}
+	}
+	walk(p.Calls, "")
+	keys := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		keys = append(keys, stack)
+	}
+	sort.Strings(keys)
+	for _, stack := range keys {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, stacks[stack]/time.Microsecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A ProfileHandler is called with the Profile of each
+// Environment at the end of its transaction.
+type ProfileHandler func(*Profile)
+
+var (
+	profileHandler    ProfileHandler = defaultProfileHandler
+	profileHandlerMux sync.RWMutex
+	profileCounter    uint64
+)
+
+// SetProfileHandler sets the function that is called with the Profile of each
+// Environment when profiling is enabled. Set it to nil to restore the default
+// handler.
+func SetProfileHandler(handler ProfileHandler) {
+	profileHandlerMux.Lock()
+	defer profileHandlerMux.Unlock()
+	if handler == nil {
+		handler = defaultProfileHandler
+	}
+	profileHandler = handler
+}
+
+// profilingEnabled returns true if method calls must be profiled
+func profilingEnabled() bool {
+	return viper.GetBool("Profiler.Enabled")
+}
+
+// endProfile finalizes the profile of the given Cursor,
+// if any, and passes it to the profile handler.
+func endProfile(cr *Cursor) {
+	if cr.profile == nil {
+		return
+	}
+	cr.profile.Duration = time.Now().Sub(cr.profile.Start)
+	profileHandlerMux.RLock()
+	handler := profileHandler
+	profileHandlerMux.RUnlock()
+	handler(cr.profile)
+}
+
+// defaultProfileHandler logs the tree of the given profile. If the
+// Profiler.Dir configuration key is set, the profile is also written
+// in this directory in the folded stacks format.
+func defaultProfileHandler(p *Profile) {
+	log.Info("Method calls profile", "uid", p.UID, "duration", p.Duration, "calls", len(p.Calls))
+	for _, line := range strings.Split(strings.TrimSpace(p.Tree()), "\n") {
+		log.Info(line)
+	}
+	dir := viper.GetString("Profiler.Dir")
+	if dir == "" {
+		return
+	}
+	profileHandlerMux.Lock()
+	profileCounter++
+	fileName := filepath.Join(dir, fmt.Sprintf("yep-%s-%d.folded", p.Start.Format("20060102-150405"), profileCounter))
+	profileHandlerMux.Unlock()
+	f, err := os.Create(fileName)
+	if err != nil {
+		log.Warn("Unable to create profile file", "file", fileName, "error", err)
+		return
+	}
+	defer f.Close()
+	if err := p.WriteFolded(f); err != nil {
+		log.Warn("Unable to write profile file", "file", fileName, "error", err)
+	}
+}
@@ -16,6 +16,7 @@ package models
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/npiganeau/yep/yep/models/fieldtype"
@@ -130,6 +131,18 @@ func (q *Query) predicateSQLClause(p predicate, first ...bool) (string, SQLParam
 		return sql, args
 	}
 
+	if argVal := reflect.ValueOf(p.arg); p.operator.IsMulti() && argVal.Kind() == reflect.Slice && argVal.Len() == 0 {
+		// This can only happen with args evaluated from functions, since
+		// empty slices are discarded when building conditions.
+		switch p.operator {
+		case operator.In:
+			sql += "FALSE "
+		case operator.NotIn:
+			sql += "TRUE "
+		}
+		return sql, args
+	}
+
 	opSql, arg := adapter.operatorSQL(p.operator, p.arg)
 	sql += fmt.Sprintf(`%s %s `, field, opSql)
 	args = append(args, arg)
@@ -494,7 +507,7 @@ func (q *Query) substituteConditionExprs(substMap map[string][]string) {
 // evaluateConditionArgFunctions evaluates all args in the queries that are functions and
 // substitute it with the result.
 func (q *Query) evaluateConditionArgFunctions() {
-	q.cond.evaluateArgFunctions(q.recordSet)
+	q.cond = q.cond.evaluateArgFunctions(q.recordSet)
 }
 
 // newQuery returns a new empty query
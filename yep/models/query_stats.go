@@ -0,0 +1,199 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// queryStringLiteral matches the SQL string literals of a query
+	queryStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// queryNumberLiteral matches the SQL number literals of a query
+	queryNumberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	// queryPlaceholderList matches lists of placeholders such as in "IN (?, ?, ?)"
+	queryPlaceholderList = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	// queryWhiteSpaces matches sequences of white spaces
+	queryWhiteSpaces = regexp.MustCompile(`\s+`)
+)
+
+// A QueryShape holds the statistics of the queries of an
+// Environment that only differ by their parameters.
+type QueryShape struct {
+	Query    string
+	Count    int
+	Duration time.Duration
+	// Method is the "Model.Method" name of the method call
+	// that issued the first query of this shape, if any.
+	Method string
+}
+
+// QueryStats holds the statistics of the SQL queries
+// executed in an Environment, that is in a single transaction.
+type QueryStats struct {
+	Count     int
+	Duration  time.Duration
+	SlowCount int
+	Shapes    map[string]QueryShape
+}
+
+// Repeated returns the shapes of the queries that have been executed at
+// least threshold times, sorted by decreasing count. Such queries are usually
+// the sign of an N+1 problem, typically a Get on each record in a loop.
+func (qs QueryStats) Repeated(threshold int) []QueryShape {
+	var res []QueryShape
+	for _, shape := range qs.Shapes {
+		if shape.Count >= threshold {
+			res = append(res, shape)
+		}
+	}
+	sort.Sort(queryShapesByCount(res))
+	return res
+}
+
+// queryShapesByCount sorts QueryShape by decreasing count and then by query
+type queryShapesByCount []QueryShape
+
+func (q queryShapesByCount) Len() int {
+	return len(q)
+}
+
+func (q queryShapesByCount) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q queryShapesByCount) Less(i, j int) bool {
+	if q[i].Count != q[j].Count {
+		return q[i].Count > q[j].Count
+	}
+	return q[i].Query < q[j].Query
+}
+
+// queryShape returns the shape of the given query, that is the query
+// without its literals and with placeholder lists reduced to a single
+// placeholder, so that queries that only differ by their parameters
+// have the same shape.
+func queryShape(query string) string {
+	res := queryStringLiteral.ReplaceAllString(query, "?")
+	res = queryNumberLiteral.ReplaceAllString(res, "?")
+	res = queryPlaceholderList.ReplaceAllString(res, "?")
+	res = queryWhiteSpaces.ReplaceAllString(res, " ")
+	return strings.TrimSpace(res)
+}
+
+// A queryMonitor counts the queries of a Cursor, logs those that are slower
+// than its slow threshold and reports the shapes of the queries that have
+// been executed at least repeatedThreshold times.
+type queryMonitor struct {
+	sync.Mutex
+	stats             QueryStats
+	calls             []queryMonitorCall
+	slowThreshold     time.Duration
+	repeatedThreshold int
+}
+
+// A queryMonitorCall is a method call in the stack of a queryMonitor
+type queryMonitorCall struct {
+	model  string
+	method string
+}
+
+// newQueryMonitor returns a new queryMonitor with the thresholds
+// set in the DB.SlowQueryThreshold and DB.RepeatedQueryThreshold
+// configuration keys. A zero or negative value disables the
+// corresponding detection.
+func newQueryMonitor() *queryMonitor {
+	return &queryMonitor{
+		stats:             QueryStats{Shapes: make(map[string]QueryShape)},
+		slowThreshold:     viper.GetDuration("DB.SlowQueryThreshold"),
+		repeatedThreshold: viper.GetInt("DB.RepeatedQueryThreshold"),
+	}
+}
+
+// enterCall pushes the given method call on the stack of
+// method calls and returns the function that pops it.
+func (qm *queryMonitor) enterCall(modelName, methName string) func() {
+	qm.Lock()
+	defer qm.Unlock()
+	qm.calls = append(qm.calls, queryMonitorCall{model: modelName, method: methName})
+	return func() {
+		qm.Lock()
+		defer qm.Unlock()
+		qm.calls = qm.calls[:len(qm.calls)-1]
+	}
+}
+
+// currentCall returns the name of the method call being executed
+// or an empty string if queries are issued outside any method.
+//
+// qm must be locked by the caller.
+func (qm *queryMonitor) currentCall() string {
+	if len(qm.calls) == 0 {
+		return ""
+	}
+	call := qm.calls[len(qm.calls)-1]
+	return fmt.Sprintf("%s.%s", call.model, call.method)
+}
+
+// addQuery records the given query executed in the given duration
+// and logs it if it is slower than the slow query threshold.
+func (qm *queryMonitor) addQuery(query string, duration time.Duration) {
+	qm.Lock()
+	defer qm.Unlock()
+	method := qm.currentCall()
+	qm.stats.Count++
+	qm.stats.Duration += duration
+	if qm.slowThreshold > 0 && duration >= qm.slowThreshold {
+		qm.stats.SlowCount++
+		log.Warn("Slow query", "query", query, "duration", duration, "method", method)
+	}
+	shape := queryShape(query)
+	qs, ok := qm.stats.Shapes[shape]
+	if !ok {
+		qs = QueryShape{Query: shape, Method: method}
+	}
+	qs.Count++
+	qs.Duration += duration
+	qm.stats.Shapes[shape] = qs
+}
+
+// snapshot returns a copy of the current statistics of this queryMonitor
+func (qm *queryMonitor) snapshot() QueryStats {
+	qm.Lock()
+	defer qm.Unlock()
+	res := qm.stats
+	res.Shapes = make(map[string]QueryShape, len(qm.stats.Shapes))
+	for shape, qs := range qm.stats.Shapes {
+		res.Shapes[shape] = qs
+	}
+	return res
+}
+
+// report logs the query counters of this queryMonitor at debug level
+// and warns about the queries that have been repeated at least
+// repeatedThreshold times.
+func (qm *queryMonitor) report() {
+	stats := qm.snapshot()
+	log.Debug("Transaction queries", "count", stats.Count, "duration", stats.Duration, "slow", stats.SlowCount)
+	if qm.repeatedThreshold <= 0 {
+		return
+	}
+	for _, shape := range stats.Repeated(qm.repeatedThreshold) {
+		log.Warn("Repeated query, possible N+1 problem", "query", shape.Query, "count", shape.Count,
+			"duration", shape.Duration, "method", shape.Method)
+	}
+}
+
+// QueryStats returns the statistics of the SQL
+// queries executed so far in this Environment.
+func (env Environment) QueryStats() QueryStats {
+	return env.cr.queries.snapshot()
+}
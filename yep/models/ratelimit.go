@@ -0,0 +1,121 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/tools/ratelimit"
+)
+
+// declareRateLimitBucketModel creates the RateLimitBucket model which holds
+// the token buckets of the DBLimiters shared by all the server instances.
+func declareRateLimitBucketModel() {
+	bucket := NewModel("RateLimitBucket")
+	bucket.AddCharField("Key", StringFieldParams{Required: true, Unique: true,
+		Help: "The name of the limiter and the key of the bucket"})
+	bucket.AddFloatField("Tokens", FloatFieldParams{Help: "The tokens left in the bucket at the last update"})
+	bucket.AddDateTimeField("LastUpdate", SimpleFieldParams{})
+	bucket.RevokeAccess(security.GroupEveryone, security.All)
+}
+
+// A DBLimiter is a ratelimit.Limiter that holds its buckets in the
+// database, so that they are shared by all the server instances.
+type DBLimiter struct {
+	sync.Mutex
+	name      string
+	rate      float64
+	burst     int
+	lastSweep time.Time
+}
+
+// NewDBLimiter returns a new DBLimiter with buckets of the given burst size
+// refilled at rate tokens per second. The name identifies the buckets of
+// this limiter in the database and must be the same on all the instances.
+func NewDBLimiter(name string, rate float64, burst int) *DBLimiter {
+	return &DBLimiter{
+		name:  name,
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+// Take takes a token from the bucket of the given key and returns true.
+// If the bucket is empty, it returns false and the time after which a
+// token will be available.
+func (dl *DBLimiter) Take(key string) (bool, time.Duration) {
+	dl.sweep()
+	var (
+		ok   bool
+		wait time.Duration
+	)
+	tableName := Registry.MustGet("RateLimitBucket").tableName
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		// The advisory lock prevents concurrent inserts of the same bucket
+		// without INSERT ... ON CONFLICT which requires Postgres 9.5.
+		env.cr.Execute("SELECT pg_advisory_xact_lock(hashtext(?))", dl.bucketKey(key))
+		env.cr.Execute(fmt.Sprintf(`INSERT INTO %s (key, tokens, last_update) SELECT ?, ?, now()
+			WHERE NOT EXISTS (SELECT 1 FROM %s WHERE key = ?)`, tableName, tableName),
+			dl.bucketKey(key), dl.burst, dl.bucketKey(key))
+		var row struct {
+			Tokens  float64
+			Elapsed float64
+		}
+		env.cr.Get(&row, fmt.Sprintf(`SELECT tokens, EXTRACT(EPOCH FROM now() - last_update) AS elapsed
+			FROM %s WHERE key = ? FOR UPDATE`, tableName), dl.bucketKey(key))
+		tokens := ratelimit.Refill(row.Tokens, time.Duration(row.Elapsed*float64(time.Second)), dl.rate, dl.burst)
+		if tokens < 1 {
+			wait = ratelimit.Wait(tokens, dl.rate)
+		} else {
+			tokens--
+			ok = true
+		}
+		env.cr.Execute(fmt.Sprintf(`UPDATE %s SET tokens = ?, last_update = now() WHERE key = ?`, tableName),
+			tokens, dl.bucketKey(key))
+	})
+	if err != nil {
+		log.Panic("Unable to take rate limit token", "limiter", dl.name, "key", key, "error", err)
+	}
+	return ok, wait
+}
+
+// Available returns true if a token is available in the bucket of the
+// given key, without taking it. Otherwise, it returns false and the time
+// after which a token will be available.
+func (dl *DBLimiter) Available(key string) (bool, time.Duration) {
+	var rows []struct {
+		Tokens  float64
+		Elapsed float64
+	}
+	dbSelectNoTx(&rows, fmt.Sprintf(`SELECT tokens, EXTRACT(EPOCH FROM now() - last_update) AS elapsed
+		FROM %s WHERE key = ?`, Registry.MustGet("RateLimitBucket").tableName), dl.bucketKey(key))
+	if len(rows) == 0 {
+		return true, 0
+	}
+	tokens := ratelimit.Refill(rows[0].Tokens, time.Duration(rows[0].Elapsed*float64(time.Second)), dl.rate, dl.burst)
+	return tokens >= 1, ratelimit.Wait(tokens, dl.rate)
+}
+
+// bucketKey returns the key in the database of the bucket of the given key
+func (dl *DBLimiter) bucketKey(key string) string {
+	return dl.name + ":" + key
+}
+
+// sweep deletes the buckets of this limiter that are full, at
+// most once per minute, so that the table does not grow forever.
+func (dl *DBLimiter) sweep() {
+	dl.Lock()
+	defer dl.Unlock()
+	if time.Since(dl.lastSweep) < time.Minute {
+		return
+	}
+	dl.lastSweep = time.Now()
+	dbExecuteNoTx(fmt.Sprintf(`DELETE FROM %s WHERE key LIKE ? AND EXTRACT(EPOCH FROM now() - last_update) > ?`,
+		Registry.MustGet("RateLimitBucket").tableName), dl.name+":%", float64(dl.burst)/dl.rate)
+}
+
+var _ ratelimit.Limiter = new(DBLimiter)
@@ -102,6 +102,11 @@ func (rc RecordCollection) MethodType(methName string) reflect.Type {
 // callMulti is a wrapper around reflect.Value.Call() to use with interface{} type.
 func (rc RecordCollection) callMulti(methLayer *methodLayer, args ...interface{}) []interface{} {
 	rc.checkExecutionPermission(methLayer.method)
+	defer rc.env.cr.queries.enterCall(rc.model.name, methLayer.method.name)()
+	defer observeMethodCall(rc.model.name, methLayer.method.name)()
+	if profile := rc.env.cr.profile; profile != nil {
+		defer profile.enterCall(rc.model.name, methLayer)()
+	}
 	inVals := make([]reflect.Value, len(args)+1)
 	inVals[0] = reflect.ValueOf(rc)
 	for i, arg := range args {
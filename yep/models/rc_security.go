@@ -23,25 +23,31 @@ func (rc RecordCollection) addRecordRuleConditions(uid int64, perm security.Perm
 		return rc
 	}
 	rSet := rc
+	globalRules, groupRules := rc.model.rulesRegistry.applicableRules(uid, perm)
 	// Add global rules
-	for _, rule := range rSet.model.rulesRegistry.globalRules {
-		if perm&rule.Perms > 0 {
-			rSet = rSet.Search(rule.Condition)
+	for _, rule := range globalRules {
+		if cond := rule.condition(rc.Env()); cond != nil && !cond.IsEmpty() {
+			rSet = rSet.Search(cond)
 		}
 	}
 	// Add groups rules
-	userGroups := security.Registry.UserGroups(uid)
 	groupCondition := newCondition()
-	for group := range userGroups {
-		for _, rule := range rSet.model.rulesRegistry.rulesByGroup[group.Name] {
-			if perm&rule.Perms > 0 {
-				groupCondition = groupCondition.OrCond(rule.Condition)
-			}
+	for _, rule := range groupRules {
+		cond := rule.condition(rc.Env())
+		if cond == nil || cond.IsEmpty() {
+			// This rule grants access to all records
+			groupCondition = newCondition()
+			break
 		}
+		groupCondition = groupCondition.OrCond(cond)
 	}
 	if !groupCondition.IsEmpty() {
 		rSet = rSet.Search(groupCondition)
 	}
+	// Functions in rules conditions must be evaluated
+	// with the Environment of this RecordCollection
+	rSet.query = rSet.query.clone()
+	rSet.query.recordSet = rSet
 	rSet.filtered = true
 	return rSet
 }
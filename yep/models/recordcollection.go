@@ -24,6 +24,7 @@ import (
 	"github.com/npiganeau/yep/yep/models/fieldtype"
 	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/imageutils"
 )
 
 // RecordCollection is a generic struct representing several
@@ -71,11 +72,15 @@ func (rc RecordCollection) Ids() []int64 {
 // Instead use rs.Call("Create")
 func (rc RecordCollection) create(data FieldMapper) RecordCollection {
 	rc.checkExecutionPermission(rc.model.methods.MustGet("Create"))
+	rc.checkModelAccess(security.Create)
 	fMap := data.FieldMap()
 	fMap = filterMapOnAuthorizedFields(rc.model, fMap, rc.env.uid, security.Write)
 	rc.applyDefaults(&fMap)
 	rc.addAccessFieldsCreateData(&fMap)
 	rc.model.convertValuesToFieldType(&fMap)
+	rc.processImageFields(&fMap)
+	rc.hashPassword(&fMap)
+	rc.checkSelectionValues(fMap)
 	fMap = rc.createEmbeddedRecords(fMap)
 	// clean our fMap from ID and non stored fields
 	fMap.RemovePKIfZero()
@@ -88,6 +93,10 @@ func (rc RecordCollection) create(data FieldMapper) RecordCollection {
 	rSet := rc.withIds([]int64{createdId})
 	// update reverse relation fields
 	rSet.updateRelationFields(fMap)
+	// check links with records of other companies
+	rSet.checkCompanyConsistency(fMap)
+	// update security groups and memberships
+	rSet.syncSecurityRegistry(fMap)
 	// compute stored fields
 	rSet.updateStoredFields(fMap)
 	return rSet
@@ -165,11 +174,71 @@ func (rc RecordCollection) addAccessFieldsCreateData(fMap *FieldMap) {
 	}
 }
 
+// processImageFields checks that the values of the image fields of the given
+// fMap are valid images and adds the resized variants of these images to fMap.
+// Values given for variant fields are discarded since these are read-only.
+// It panics if a value is not a valid image.
+func (rc RecordCollection) processImageFields(fMap *FieldMap) {
+	variants := make(FieldMap)
+	for fName, value := range *fMap {
+		fi, ok := rc.model.fields.get(fName)
+		if !ok || fi.fieldType != fieldtype.Image {
+			continue
+		}
+		if fi.readOnly {
+			delete(*fMap, fName)
+			continue
+		}
+		data, _ := value.(string)
+		if data == "" {
+			for variantName := range fi.imageVariants {
+				variants[variantName] = ""
+			}
+			continue
+		}
+		var names []string
+		var sizes []int
+		for variantName, size := range fi.imageVariants {
+			names = append(names, variantName)
+			sizes = append(sizes, size)
+		}
+		resized, err := imageutils.ResizeBase64(data, sizes...)
+		if err != nil {
+			log.Panic("Invalid image data", "model", rc.ModelName(), "field", fi.name, "error", err)
+		}
+		for i, variantName := range names {
+			variants[variantName] = resized[i]
+		}
+	}
+	for variantName, value := range variants {
+		(*fMap)[variantName] = value
+	}
+}
+
+// checkSelectionValues checks that the values of the selection fields of the
+// given fMap are allowed by these fields. It panics if it is not the case.
+func (rc RecordCollection) checkSelectionValues(fMap FieldMap) {
+	for fName, value := range fMap {
+		fi, ok := rc.model.fields.get(fName)
+		if !ok || fi.fieldType != fieldtype.Selection {
+			continue
+		}
+		val, _ := value.(string)
+		if val == "" {
+			continue
+		}
+		if _, exists := fi.selectionValues(rc.Env())[val]; !exists {
+			log.Panic("Invalid value for selection field", "model", rc.ModelName(), "field", fi.name, "value", val)
+		}
+	}
+}
+
 // update updates the database with the given data and returns the number of updated rows.
 // It panics in case of error.
 // This function is private and low level. It should not be called directly.
 // Instead use rs.Call("Write")
 func (rc RecordCollection) update(data FieldMapper, fieldsToUnset ...FieldNamer) bool {
+	rc.checkModelAccess(security.Write)
 	rSet := rc.addRecordRuleConditions(rc.env.uid, security.Write)
 	fMap := data.FieldMap()
 	if _, ok := data.(FieldMap); !ok {
@@ -181,6 +250,9 @@ func (rc RecordCollection) update(data FieldMapper, fieldsToUnset ...FieldNamer)
 	}
 	rSet.addAccessFieldsUpdateData(&fMap)
 	rSet.model.convertValuesToFieldType(&fMap)
+	rSet.processImageFields(&fMap)
+	rSet.hashPassword(&fMap)
+	rSet.checkSelectionValues(fMap)
 	// clean our fMap from ID and non stored fields
 	fMap.RemovePK()
 	storedFieldMap := filterMapOnStoredFields(rSet.model, fMap)
@@ -191,6 +263,10 @@ func (rc RecordCollection) update(data FieldMapper, fieldsToUnset ...FieldNamer)
 	rSet.updateRelationFields(fMap)
 	// write related fields
 	rSet.updateRelatedFields(fMap)
+	// check links with records of other companies
+	rSet.checkCompanyConsistency(fMap)
+	// update security groups and memberships
+	rSet.syncSecurityRegistry(fMap)
 	// compute stored fields
 	rSet.updateStoredFields(fMap)
 	return true
@@ -300,10 +376,16 @@ func (rc RecordCollection) updateRelatedFields(fMap FieldMap) {
 // Instead use rs.Unlink() or rs.Call("Unlink")
 func (rc RecordCollection) unlink() int64 {
 	rc.checkExecutionPermission(rc.model.methods.MustGet("Unlink"))
+	rc.checkModelAccess(security.Unlink)
 	rSet := rc.addRecordRuleConditions(rc.env.uid, security.Unlink)
+	if rSet.model.name == "Users" {
+		// We need the ids to remove memberships after deletion
+		rSet = rSet.Fetch()
+	}
 	sql, args := rSet.query.deleteQuery()
 	res := rSet.env.cr.Execute(sql, args...)
 	num, _ := res.RowsAffected()
+	rSet.syncSecurityRegistry(nil)
 	return num
 }
 
@@ -350,8 +432,11 @@ func (rc RecordCollection) GroupBy(fields ...FieldNamer) RecordCollection {
 // Fetch query the database with the current filter and returns a RecordSet
 // with the queries ids. Fetch is lazy and only return ids. Use Load() instead
 // if you want to fetch all fields.
+//
+// It panics if the current user is not allowed to read the model.
 func (rc RecordCollection) Fetch() RecordCollection {
 	if !rc.fetched && !rc.query.isEmpty() {
+		rc.checkModelAccess(security.Read)
 		// We do not load empty queries to keep empty record sets empty
 		// Call FetchAll instead to load all the records of the table
 		return rc.Load("id")
@@ -368,9 +453,18 @@ func (rc RecordCollection) FetchAll() RecordCollection {
 }
 
 // SearchCount fetch from the database the number of records that match the RecordSet conditions
-// It panics in case of error
+// and the read record rules of the current user. It panics in case of error or if the current
+// user is not allowed to read the model.
 func (rc RecordCollection) SearchCount() int {
-	rSet := rc.Limit(0)
+	rc.checkModelAccess(security.Read)
+	return rc.searchCount()
+}
+
+// searchCount returns the number of records that match the RecordSet
+// conditions and the read record rules of the current user, without
+// checking the access rights of the user on the model.
+func (rc RecordCollection) searchCount() int {
+	rSet := rc.addRecordRuleConditions(rc.env.uid, security.Read).Limit(0)
 	sql, args := rSet.query.countQuery()
 	var res int
 	rSet.env.cr.Get(&res, sql, args...)
@@ -385,6 +479,7 @@ func (rc RecordCollection) SearchCount() int {
 // fields to be retrieved.
 func (rc RecordCollection) Load(fields ...string) RecordCollection {
 	rc.checkExecutionPermission(rc.model.methods.MustGet("Load"))
+	rc.checkModelAccess(security.Read)
 	if rc.query.isEmpty() {
 		// Never load RecordSets without query.
 		return rc
@@ -401,7 +496,7 @@ func (rc RecordCollection) Load(fields ...string) RecordCollection {
 	subFields, rSet := rSet.substituteRelatedFields(fields)
 	dbFields := filterOnDBFields(rSet.model, subFields)
 	sql, args := rSet.query.selectQuery(dbFields)
-	rows := dbQuery(rSet.env.cr.tx, sql, args...)
+	rows := rSet.env.cr.query(sql, args...)
 	defer rows.Close()
 	var ids []int64
 	for rows.Next() {
@@ -451,6 +546,53 @@ func (rc RecordCollection) loadRelationFields(fields []string) {
 	}
 }
 
+// RelatedIds returns the ids of the records related to the records of this
+// RecordCollection through the given relation field, mapped by record id.
+// Records without related records are not in the returned map.
+//
+// Unlike calling Get on each record, RelatedIds issues a constant number of
+// queries whatever the number of records. The related records are not checked
+// against the record rules of the related model, so that they should be
+// searched before being read.
+func (rc RecordCollection) RelatedIds(fieldName string) map[int64][]int64 {
+	rSet := rc.Fetch()
+	fi := rSet.model.fields.MustGet(fieldName)
+	if !fi.isRelationField() {
+		log.Panic("Field is not a relation field", "model", rSet.ModelName(), "field", fieldName)
+	}
+	res := make(map[int64][]int64)
+	if rSet.IsEmpty() || len(filterOnAuthorizedFields(rSet.model, rSet.env.uid, []string{fi.name}, security.Read)) == 0 {
+		return res
+	}
+	switch fi.fieldType {
+	case fieldtype.Many2One, fieldtype.One2One:
+		for _, rec := range rSet.Records() {
+			if relID, ok := rec.get(fi.name, false).(int64); ok && relID != 0 {
+				res[rec.ids[0]] = []int64{relID}
+			}
+		}
+	case fieldtype.One2Many, fieldtype.Rev2One, fieldtype.Many2Many:
+		var query string
+		if fi.fieldType == fieldtype.Many2Many {
+			query = fmt.Sprintf(`SELECT %s AS our_id, %s AS their_id FROM %s WHERE %s IN (?)`, fi.m2mOurField.json,
+				fi.m2mTheirField.json, fi.m2mRelModel.tableName, fi.m2mOurField.json)
+		} else {
+			fkJSON := fi.relatedModel.fields.MustGet(fi.reverseFK).json
+			query = fmt.Sprintf(`SELECT %s AS our_id, id AS their_id FROM %s WHERE %s IN (?) ORDER BY id`, fkJSON,
+				fi.relatedModel.tableName, fkJSON)
+		}
+		var links []struct {
+			OurID   int64 `db:"our_id"`
+			TheirID int64 `db:"their_id"`
+		}
+		rSet.env.cr.Select(&links, query, rSet.ids)
+		for _, link := range links {
+			res[link.OurID] = append(res[link.OurID], link.TheirID)
+		}
+	}
+	return res
+}
+
 // Get returns the value of the given fieldName for the first record of this RecordCollection.
 // It returns the type's zero value if the RecordCollection is empty.
 func (rc RecordCollection) Get(fieldName string) interface{} {
@@ -575,7 +717,7 @@ func (rc RecordCollection) Aggregates(fieldNames ...FieldNamer) []GroupAggregate
 	fieldsOperatorMap := rSet.fieldsGroupOperators(dbFields)
 	sql, args := rSet.query.selectGroupQuery(fieldsOperatorMap)
 	var res []GroupAggregateRow
-	rows := dbQuery(rSet.env.cr.tx, sql, args...)
+	rows := rSet.env.cr.query(sql, args...)
 	defer rows.Close()
 
 	for rows.Next() {
@@ -18,6 +18,7 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -41,6 +42,14 @@ type modelCollection struct {
 	sequences           map[string]*Sequence
 }
 
+// IsBootstrapped returns true if the models have been bootstrapped.
+// It waits for the end of the bootstrap if it is in progress.
+func (mc *modelCollection) IsBootstrapped() bool {
+	mc.RLock()
+	defer mc.RUnlock()
+	return mc.bootstrapped
+}
+
 // Get the given Model by name or by table name
 func (mc *modelCollection) Get(nameOrJSON string) (mi *Model, ok bool) {
 	mi, ok = mc.registryByName[nameOrJSON]
@@ -60,6 +69,22 @@ func (mc *modelCollection) MustGet(nameOrJSON string) *Model {
 	return mi
 }
 
+// All returns all the models of the registry sorted by name
+func (mc *modelCollection) All() []*Model {
+	mc.RLock()
+	defer mc.RUnlock()
+	names := make([]string, 0, len(mc.registryByName))
+	for name := range mc.registryByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]*Model, len(names))
+	for i, name := range names {
+		res[i] = mc.registryByName[name]
+	}
+	return res
+}
+
 // GetSequence the given Sequence by name or by db name
 func (mc *modelCollection) GetSequence(nameOrJSON string) (s *Sequence, ok bool) {
 	s, ok = mc.sequences[nameOrJSON]
@@ -289,6 +314,22 @@ func (m *Model) isM2MLink() bool {
 	return false
 }
 
+// Name returns the name of this model
+func (m *Model) Name() string {
+	return m.name
+}
+
+// IsMixin returns true if this is a mixin model. Mixin models
+// have no table in the database and cannot be queried.
+func (m *Model) IsMixin() bool {
+	return m.isMixin()
+}
+
+// IsM2MLink returns true if this is the link model of a Many2Many field
+func (m *Model) IsM2MLink() bool {
+	return m.isM2MLink()
+}
+
 // Fields returns the fields collection of this model
 func (m *Model) Fields() *FieldsCollection {
 	return m.fields
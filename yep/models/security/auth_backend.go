@@ -76,12 +76,10 @@ func (ar *AuthBackendRegistry) Authenticate(login, secret string, context *types
 	for _, backend := range ar.backends {
 		uid, err := backend.Authenticate(login, secret, context)
 		if err != nil {
-			switch err.(type) {
-			case UserNotFoundError:
+			if _, ok := err.(UserNotFoundError); ok {
 				continue
-			case InvalidCredentialsError:
-				return 0, err
 			}
+			return 0, err
 		}
 		return uid, nil
 	}
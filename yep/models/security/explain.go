@@ -0,0 +1,144 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package security
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A CheckKind is the access control mechanism evaluated by a Check
+type CheckKind string
+
+// The access control mechanisms that can be evaluated by Explain
+const (
+	MethodCheck     CheckKind = "method"
+	ModelCheck      CheckKind = "model"
+	FieldCheck      CheckKind = "field"
+	RecordRuleCheck CheckKind = "record rules"
+)
+
+// A Check is the result of the evaluation of an access control mechanism
+// for an Explanation.
+//
+// Field checks are only reported for fields on which the permission is
+// denied. They never deny access to the records since non authorized fields
+// are only filtered out.
+type Check struct {
+	Kind    CheckKind
+	Name    string
+	Granted bool
+	Details []string
+}
+
+// String returns a one line description of this Check
+func (c Check) String() string {
+	res := "denied"
+	if c.Granted {
+		res = "granted"
+	}
+	return fmt.Sprintf("[%s] %s %s", res, c.Kind, c.Name)
+}
+
+// A GroupMembership is a group of a user, either given explicitly
+// or through inheritance.
+type GroupMembership struct {
+	Group     *Group
+	Inherited bool
+}
+
+// An Explanation reports how the access of a user to records of a model has
+// been decided by the different access control mechanisms.
+type Explanation struct {
+	UID        int64
+	Model      string
+	IDs        []int64
+	Permission Permission
+	Groups     []GroupMembership
+	Checks     []Check
+	Granted    bool
+	// DeniedBy is the first check that denied access, if any
+	DeniedBy *Check
+}
+
+// String returns a human readable report of this Explanation
+func (e *Explanation) String() string {
+	var buf bytes.Buffer
+	res := "denied"
+	if e.Granted {
+		res = "granted"
+	}
+	fmt.Fprintf(&buf, "Access of user %d to %s %v for %s: %s\n", e.UID, e.Model, e.IDs, e.Permission, res)
+	groups := make([]string, len(e.Groups))
+	for i, gm := range e.Groups {
+		groups[i] = gm.Group.ID
+		if gm.Inherited {
+			groups[i] += " (inherited)"
+		}
+	}
+	fmt.Fprintf(&buf, "Groups: %s\n", strings.Join(groups, ", "))
+	for _, check := range e.Checks {
+		fmt.Fprintln(&buf, check)
+		for _, detail := range check.Details {
+			fmt.Fprintf(&buf, "    %s\n", detail)
+		}
+	}
+	if e.DeniedBy != nil {
+		fmt.Fprintf(&buf, "Denied by: %s %s\n", e.DeniedBy.Kind, e.DeniedBy.Name)
+	}
+	return buf.String()
+}
+
+// groupMembershipsByID sorts a slice of GroupMembership by group ID
+type groupMembershipsByID []GroupMembership
+
+func (g groupMembershipsByID) Len() int           { return len(g) }
+func (g groupMembershipsByID) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+func (g groupMembershipsByID) Less(i, j int) bool { return g[i].Group.ID < g[j].Group.ID }
+
+// An AccessExplainer evaluates the access control mechanisms that apply to
+// the given perm of the user with the given uid on the records with the given
+// ids of the given model.
+type AccessExplainer func(uid int64, model string, ids []int64, perm Permission) []Check
+
+// accessExplainer is the AccessExplainer used by Explain
+var accessExplainer AccessExplainer
+
+// RegisterAccessExplainer sets the AccessExplainer used by Explain.
+// It is called by the models package which implements access control.
+func RegisterAccessExplainer(explainer AccessExplainer) {
+	accessExplainer = explainer
+}
+
+// Explain returns an Explanation of the access of the user with the given uid
+// to the records with the given ids of the given model for the given perm.
+// ids may be empty to only explain the access to the model.
+func Explain(uid int64, model string, ids []int64, perm Permission) *Explanation {
+	if accessExplainer == nil {
+		log.Panic("No access explainer registered")
+	}
+	exp := &Explanation{
+		UID:        uid,
+		Model:      model,
+		IDs:        ids,
+		Permission: perm,
+		Granted:    true,
+	}
+	for group, info := range Registry.UserGroups(uid) {
+		exp.Groups = append(exp.Groups, GroupMembership{Group: group, Inherited: info == InheritedGroup})
+	}
+	sort.Sort(groupMembershipsByID(exp.Groups))
+	exp.Checks = accessExplainer(uid, model, ids, perm)
+	for i, check := range exp.Checks {
+		if check.Kind == FieldCheck || check.Granted {
+			continue
+		}
+		exp.Granted = false
+		exp.DeniedBy = &exp.Checks[i]
+		break
+	}
+	return exp
+}
@@ -119,6 +119,40 @@ func (gc *GroupCollection) UnregisterGroup(group *Group) {
 	delete(gc.groups, group.ID)
 }
 
+// SetInherits sets the groups that the given group inherits from
+// and updates the memberships of all users accordingly.
+// This method panics if it would create an inheritance loop.
+func (gc *GroupCollection) SetInherits(group *Group, inherits ...*Group) {
+	for _, iGrp := range inherits {
+		var parents []*Group
+		gc.inheritedBy(iGrp, &parents)
+		parents = append(parents, iGrp)
+		for _, parent := range parents {
+			if parent == group {
+				log.Panic("Circular group inheritance", "group", group.ID, "inherits", iGrp.ID)
+			}
+		}
+	}
+	gc.Lock()
+	group.Inherits = inherits
+	// Keep native memberships and recompute inherited ones
+	natives := make(map[int64][]*Group)
+	for uid, groups := range gc.memberships {
+		for grp, ii := range groups {
+			if ii == NativeGroup {
+				natives[uid] = append(natives[uid], grp)
+			}
+		}
+	}
+	gc.memberships = make(map[int64]map[*Group]InheritanceInfo)
+	gc.Unlock()
+	for uid, groups := range natives {
+		for _, grp := range groups {
+			gc.AddMembership(uid, grp)
+		}
+	}
+}
+
 // GetGroup returns the group with the given groupID or nil if not found
 func (gc *GroupCollection) GetGroup(groupID string) *Group {
 	return gc.groups[groupID]
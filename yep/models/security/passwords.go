@@ -0,0 +1,141 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A PasswordHashAlgorithm is an algorithm used to hash passwords
+type PasswordHashAlgorithm string
+
+const (
+	// Bcrypt hashes passwords with bcrypt
+	Bcrypt PasswordHashAlgorithm = "bcrypt"
+	// Argon2ID hashes passwords with argon2id
+	Argon2ID PasswordHashAlgorithm = "argon2id"
+)
+
+// Argon2Params are the parameters of the argon2id algorithm
+type Argon2Params struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+var (
+	// PasswordHashing is the algorithm used to hash new passwords.
+	// Hashes made with another algorithm are upgraded on login.
+	PasswordHashing = Bcrypt
+	// BcryptCost is the cost used for new bcrypt hashes.
+	// Bcrypt hashes with a lower cost are upgraded on login.
+	BcryptCost = bcrypt.DefaultCost
+	// Argon2 holds the parameters used for new argon2id hashes.
+	// Argon2id hashes with other parameters are upgraded on login.
+	Argon2 = Argon2Params{
+		Time:       1,
+		Memory:     64 * 1024,
+		Threads:    4,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+)
+
+// HashPassword returns a salted hash of the given password computed
+// with the PasswordHashing algorithm. The returned string holds the
+// algorithm, its parameters and the salt with the hash.
+func HashPassword(password string) (string, error) {
+	switch PasswordHashing {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+		return string(hash), err
+	case Argon2ID:
+		salt := make([]byte, Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, Argon2.Time, Argon2.Memory, Argon2.Threads, Argon2.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, Argon2.Memory, Argon2.Time,
+			Argon2.Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unknown password hash algorithm %s", PasswordHashing)
+}
+
+// CheckPassword returns true if the given password matches the given hash.
+// The second returned value is true if the hash has not been computed with
+// the current PasswordHashing algorithm and parameters and should be
+// replaced by a new hash of the password.
+func CheckPassword(hash, password string) (bool, bool) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			log.Warn("Invalid argon2id password hash", "error", err)
+			return false, false
+		}
+		pwdKey := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, pwdKey) != 1 {
+			return false, false
+		}
+		params.SaltLength = uint32(len(salt))
+		params.KeyLength = uint32(len(key))
+		return true, PasswordHashing != Argon2ID || params != Argon2
+	case strings.HasPrefix(hash, "$2"):
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, false
+		}
+		cost, _ := bcrypt.Cost([]byte(hash))
+		return true, PasswordHashing != Bcrypt || cost < BcryptCost
+	}
+	return false, false
+}
+
+// decodeArgon2Hash returns the parameters, the salt and the key
+// of the given argon2id hash.
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, fmt.Errorf("wrong number of parts in hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
@@ -14,13 +14,66 @@
 
 package security
 
-// A Permission defines which of the read, write or unlink rights apply.
+import "strings"
+
+// A Permission defines which of the read, write, unlink or create rights apply.
 type Permission uint8
 
-// The four Permissions are Read, Write, Unlink and All.
+// The five Permissions are Read, Write, Unlink, Create and All.
 const (
 	Read = 1 << Permission(iota)
 	Write
 	Unlink
-	All = Read | Write | Unlink
+	Create
+	All = Read | Write | Unlink | Create
 )
+
+// permissionNames are the names of each single Permission, in display order
+var permissionNames = []struct {
+	perm Permission
+	name string
+}{
+	{Read, "read"},
+	{Write, "write"},
+	{Create, "create"},
+	{Unlink, "unlink"},
+}
+
+// String returns the names of the permissions set in p separated by "|"
+func (p Permission) String() string {
+	var names []string
+	for _, pn := range permissionNames {
+		if p&pn.perm != 0 {
+			names = append(names, pn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// ParsePermission returns the Permission given by the comma or "|" separated
+// names in s, such as "read,write". The name "all" gives All. The second
+// returned value is false if s contains an unknown name.
+func ParsePermission(s string) (Permission, bool) {
+	var res Permission
+	for _, name := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ',' || r == '|' }) {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			res |= All
+			continue
+		}
+		var found bool
+		for _, pn := range permissionNames {
+			if pn.name == name {
+				res |= pn.perm
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return res, true
+}
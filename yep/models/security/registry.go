@@ -57,7 +57,9 @@ func (acl *AccessControlList) CheckPermission(group *Group, perm Permission) boo
 		return true
 	}
 	for _, inhGroup := range group.Inherits {
-		return acl.CheckPermission(inhGroup, perm)
+		if acl.CheckPermission(inhGroup, perm) {
+			return true
+		}
 	}
 	return false
 }
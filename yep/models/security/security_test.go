@@ -16,6 +16,7 @@ package security
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -27,6 +28,7 @@ func TestAccessControlList(t *testing.T) {
 		group1 := gr.NewGroup("group1_test", "Group 1")
 		group1Inherit := gr.NewGroup("group1_inherited", "Group 1 Inherited", group1)
 		group2 := gr.NewGroup("group2_test", "Group 2")
+		group12Inherit := gr.NewGroup("group12_inherited", "Group 1 and 2 Inherited", group1, group2)
 		acl.AddPermission(group1, Read)
 		acl.AddPermission(group2, All)
 		So(acl.perms, ShouldHaveLength, 3)
@@ -41,7 +43,7 @@ func TestAccessControlList(t *testing.T) {
 
 		Convey("Removing permissions from groups", func() {
 			acl.RemovePermission(group2, Read)
-			So(acl.perms[group2], ShouldEqual, Write|Unlink)
+			So(acl.perms[group2], ShouldEqual, Write|Unlink|Create)
 			acl.RemovePermission(group1, Write|Unlink)
 			So(acl.perms[group1], ShouldEqual, Read)
 		})
@@ -60,6 +62,7 @@ func TestAccessControlList(t *testing.T) {
 			So(acl.CheckPermission(group2, All), ShouldBeTrue)
 			So(acl.CheckPermission(group1, Read|Write), ShouldBeFalse)
 			So(acl.CheckPermission(group1Inherit, Read|Unlink), ShouldBeFalse)
+			So(acl.CheckPermission(group12Inherit, Create), ShouldBeTrue)
 		})
 	})
 }
@@ -177,3 +180,147 @@ func TestGroupRegistry(t *testing.T) {
 		})
 	})
 }
+
+func TestSetInherits(t *testing.T) {
+	Convey("Testing group inheritance changes", t, func() {
+		gr := NewGroupCollection()
+		group1 := gr.NewGroup("group1_test", "Group 1")
+		group2 := gr.NewGroup("group2_test", "Group 2")
+		gr.AddMembership(2, group2)
+		Convey("Memberships should be updated when inheritance changes", func() {
+			gr.SetInherits(group2, group1)
+			So(gr.HasMembership(2, group1), ShouldBeTrue)
+			So(gr.UserGroups(2)[group1], ShouldEqual, InheritedGroup)
+			gr.SetInherits(group2)
+			So(gr.HasMembership(2, group1), ShouldBeFalse)
+			So(gr.HasMembership(2, group2), ShouldBeTrue)
+		})
+		Convey("Circular inheritance should panic", func() {
+			gr.SetInherits(group2, group1)
+			So(func() { gr.SetInherits(group1, group2) }, ShouldPanic)
+			So(func() { gr.SetInherits(group1, group1) }, ShouldPanic)
+		})
+	})
+}
+
+func TestPasswords(t *testing.T) {
+	Convey("Testing password hashing", t, func() {
+		Reset(func() {
+			PasswordHashing = Bcrypt
+		})
+		Convey("Bcrypt hashes should be checked", func() {
+			hash, err := HashPassword("secret")
+			So(err, ShouldBeNil)
+			So(hash, ShouldNotContainSubstring, "secret")
+			ok, upgrade := CheckPassword(hash, "secret")
+			So(ok, ShouldBeTrue)
+			So(upgrade, ShouldBeFalse)
+			ok, _ = CheckPassword(hash, "wrong")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Argon2id hashes should be checked", func() {
+			PasswordHashing = Argon2ID
+			hash, err := HashPassword("secret")
+			So(err, ShouldBeNil)
+			So(hash, ShouldStartWith, "$argon2id$")
+			ok, upgrade := CheckPassword(hash, "secret")
+			So(ok, ShouldBeTrue)
+			So(upgrade, ShouldBeFalse)
+			ok, _ = CheckPassword(hash, "wrong")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Hashes of another algorithm should be upgraded", func() {
+			hash, _ := HashPassword("secret")
+			PasswordHashing = Argon2ID
+			ok, upgrade := CheckPassword(hash, "secret")
+			So(ok, ShouldBeTrue)
+			So(upgrade, ShouldBeTrue)
+		})
+		Convey("Invalid hashes should not match", func() {
+			ok, _ := CheckPassword("secret", "secret")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	Convey("Testing TOTP codes", t, func() {
+		// RFC 6238 test secret "12345678901234567890"
+		secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+		Convey("Codes should match RFC 6238 test vectors", func() {
+			code, err := TOTPCode(secret, time.Unix(59, 0))
+			So(err, ShouldBeNil)
+			So(code, ShouldEqual, "287082")
+			code, _ = TOTPCode(secret, time.Unix(1111111109, 0))
+			So(code, ShouldEqual, "081804")
+		})
+		Convey("Codes should be accepted within the allowed skew", func() {
+			now := time.Now()
+			code, _ := TOTPCode(secret, now)
+			So(CheckTOTP(secret, code, now), ShouldBeTrue)
+			So(CheckTOTP(secret, code, now.Add(TOTPPeriod)), ShouldBeTrue)
+			So(CheckTOTP(secret, code, now.Add(5*TOTPPeriod)), ShouldBeFalse)
+			So(CheckTOTP(secret, "abc", now), ShouldBeFalse)
+		})
+		Convey("Codes should only be matched after the last step", func() {
+			now := time.Now()
+			code, _ := TOTPCode(secret, now)
+			step, ok := MatchTOTP(secret, code, now, 0)
+			So(ok, ShouldBeTrue)
+			So(step, ShouldEqual, now.Unix()/int64(TOTPPeriod/time.Second))
+			_, ok = MatchTOTP(secret, code, now, step)
+			So(ok, ShouldBeFalse)
+			_, ok = MatchTOTP(secret, code, now, step-1)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Generated secrets should be usable in a provisioning URI", func() {
+			newSecret, err := GenerateTOTPSecret()
+			So(err, ShouldBeNil)
+			_, err = TOTPCode(newSecret, time.Now())
+			So(err, ShouldBeNil)
+			uri := TOTPProvisioningURI(newSecret, "john", "YEP")
+			So(uri, ShouldStartWith, "otpauth://totp/YEP:john?")
+			So(uri, ShouldContainSubstring, "secret="+newSecret)
+		})
+	})
+}
+
+func TestExplain(t *testing.T) {
+	Convey("Testing access explanations", t, func() {
+		Convey("Permissions should be parsed and printed", func() {
+			perm, ok := ParsePermission("read, Write|unlink")
+			So(ok, ShouldBeTrue)
+			So(perm, ShouldEqual, Read|Write|Unlink)
+			So(perm.String(), ShouldEqual, "read|write|unlink")
+			perm, ok = ParsePermission("all")
+			So(ok, ShouldBeTrue)
+			So(perm, ShouldEqual, All)
+			_, ok = ParsePermission("execute")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Explanations should report groups and the denying check", func() {
+			group := Registry.NewGroup("explain_test", "Explain Test")
+			groupInherit := Registry.NewGroup("explain_inherit_test", "Explain Inherit Test", group)
+			Registry.AddMembership(12, groupInherit)
+			Reset(func() {
+				Registry.UnregisterGroup(groupInherit)
+				Registry.UnregisterGroup(group)
+				RegisterAccessExplainer(nil)
+			})
+			RegisterAccessExplainer(func(uid int64, model string, ids []int64, perm Permission) []Check {
+				return []Check{
+					{Kind: MethodCheck, Name: "Partner.Load", Granted: true},
+					{Kind: FieldCheck, Name: "Partner.Phone"},
+					{Kind: RecordRuleCheck, Name: "Partner,3", Details: []string{"rule own_partners: does not match"}},
+				}
+			})
+			exp := Explain(12, "Partner", []int64{3}, Read)
+			So(exp.Groups, ShouldContain, GroupMembership{Group: group, Inherited: true})
+			So(exp.Groups, ShouldContain, GroupMembership{Group: groupInherit})
+			So(exp.Groups, ShouldContain, GroupMembership{Group: GroupEveryone})
+			So(exp.Granted, ShouldBeFalse)
+			So(exp.DeniedBy.Kind, ShouldEqual, RecordRuleCheck)
+			So(exp.String(), ShouldContainSubstring, "Denied by: record rules Partner,3")
+		})
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// TOTPPeriod is the validity period of a TOTP code
+	TOTPPeriod = 30 * time.Second
+	// TOTPDigits is the number of digits of TOTP codes
+	TOTPDigits = 6
+	// TOTPSkew is the number of periods before and after the current
+	// one during which a code is still accepted, to allow for clock drift.
+	TOTPSkew = 1
+)
+
+// GenerateTOTPSecret returns a new random base32 encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI to enroll the given secret
+// in an authenticator application, usually displayed as a QR code. account
+// is the name of the user's account and issuer the name of the application.
+func TOTPProvisioningURI(secret, account, issuer string) string {
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprintf("%d", TOTPDigits)},
+		"period":    {fmt.Sprintf("%d", int(TOTPPeriod/time.Second))},
+	}
+	escape := func(s string) string {
+		return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	}
+	label := escape(issuer) + ":" + escape(account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// TOTPCode returns the TOTP code of the given base32 encoded secret at the given time,
+// as defined in RFC 6238 with HMAC-SHA1.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return totpCode(secret, t.Unix()/int64(TOTPPeriod/time.Second))
+}
+
+// totpCode returns the TOTP code of the given secret for the given counter
+func totpCode(secret string, counter int64) (string, error) {
+	secret = strings.TrimRight(strings.ToUpper(strings.Replace(secret, " ", "", -1)), "=")
+	if len(secret)%8 != 0 {
+		secret += strings.Repeat("=", 8-len(secret)%8)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// CheckTOTP returns true if code is a valid TOTP code for the given secret
+// at the given time, within TOTPSkew periods.
+func CheckTOTP(secret, code string, t time.Time) bool {
+	_, ok := MatchTOTP(secret, code, t, math.MinInt64)
+	return ok
+}
+
+// MatchTOTP returns the time step of code and true if code is a valid TOTP
+// code for the given secret at the given time, within TOTPSkew periods, and
+// if its time step is after the given last step.
+//
+// Storing the step of the last accepted code and giving it as last prevents
+// a code from being replayed during its validity window.
+func MatchTOTP(secret, code string, t time.Time, last int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	counter := t.Unix() / int64(TOTPPeriod/time.Second)
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		step := counter + int64(i)
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 && step > last {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -14,7 +14,57 @@
 
 package models
 
-import "github.com/npiganeau/yep/yep/models/security"
+import (
+	"strings"
+
+	"github.com/npiganeau/yep/yep/models/security"
+)
+
+// GrantAccess grants the given perm to the given group on this model.
+//
+// Model access rights apply to the whole records of the model. They are
+// checked before the access rights of each field, so that a field is only
+// readable or writable by groups which also have this right on the model.
+// By default, all permissions are granted to security.GroupEveryone.
+func (m *Model) GrantAccess(group *security.Group, perm security.Permission) *Model {
+	m.acl.AddPermission(group, perm)
+	return m
+}
+
+// RevokeAccess denies the given perm to the given group on this model.
+func (m *Model) RevokeAccess(group *security.Group, perm security.Permission) *Model {
+	m.acl.RemovePermission(group, perm)
+	return m
+}
+
+// checkModelPermission checks if the given uid has the given perm on the given model.
+//
+// If ModelAccess records have been defined for this model, they are used instead
+// of the access rights declared in code. The super user has all permissions.
+func checkModelPermission(m *Model, uid int64, perm security.Permission) bool {
+	if uid == security.SuperUserID {
+		return true
+	}
+	acl := getModelAccessRights(m)
+	if acl == nil {
+		acl = m.acl
+	}
+	userGroups := security.Registry.UserGroups(uid)
+	for group := range userGroups {
+		if acl.CheckPermission(group, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkModelAccess panics if the current user does not
+// have the given perm on the model of this RecordCollection.
+func (rc RecordCollection) checkModelAccess(perm security.Permission) {
+	if !checkModelPermission(rc.model, rc.env.uid, perm) {
+		log.Panic("You are not allowed to access this model", "model", rc.ModelName(), "uid", rc.env.uid, "permission", perm)
+	}
+}
 
 // GrantAccess grants the given perm to the given group on the given field of model.
 // Only security.Read and security.Write permissions are taken into account by
@@ -65,6 +115,25 @@ func filterOnAuthorizedFields(m *Model, uid int64, fields []string, perm securit
 	return res
 }
 
+// CanAccessFieldPath returns true if the user with the given uid has the given
+// permission on every field of the given dot separated path from this model,
+// including the relation fields of the intermediate models.
+//
+// It panics if path is not a valid field path from this model.
+func (m *Model) CanAccessFieldPath(uid int64, path string, perm security.Permission) bool {
+	current := m
+	for _, expr := range strings.Split(path, ExprSep) {
+		if current == nil {
+			log.Panic("Invalid field path", "model", m.name, "path", path)
+		}
+		if len(filterOnAuthorizedFields(current, uid, []string{expr}, perm)) == 0 {
+			return false
+		}
+		current = current.fields.MustGet(expr).relatedModel
+	}
+	return true
+}
+
 // filterMapOnAuthorizedFields returns a new FieldMap from fMap
 // with only the fields on which the given uid user has access.
 // All field names are JSONized.
@@ -15,6 +15,7 @@
 package models
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/npiganeau/yep/yep/models/security"
@@ -25,14 +26,41 @@ import (
 // - If Global is true, then the RecordRule applies to all groups
 // - Condition is the filter to apply on the model to retrieve
 // the records on which to allow the Perms permission.
+// - ConditionFunc, if set, is called with the Environment of the
+// request to build the condition instead of Condition. This allows
+// conditions that depend on the user, the context or the company.
+//
+// A nil or empty condition matches all the records.
 type RecordRule struct {
-	Name      string
-	Global    bool
-	Group     *security.Group
-	Condition *Condition
-	Perms     security.Permission
+	Name          string
+	Global        bool
+	Group         *security.Group
+	Condition     *Condition
+	ConditionFunc func(Environment) *Condition
+	Perms         security.Permission
+}
+
+// condition returns the condition of this rule for the given Environment.
+func (rr *RecordRule) condition(env Environment) *Condition {
+	if rr.ConditionFunc != nil {
+		return rr.ConditionFunc(env)
+	}
+	return rr.Condition
+}
+
+// A RecordRuleCheck is the result of the evaluation of a RecordRule on a record.
+type RecordRuleCheck struct {
+	Rule    *RecordRule
+	Matches bool
 }
 
+// recordRulesByName sorts a slice of RecordRule by their name
+type recordRulesByName []*RecordRule
+
+func (r recordRulesByName) Len() int           { return len(r) }
+func (r recordRulesByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r recordRulesByName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
 // A RecordRuleRegistry keeps a list of RecordRule. It is meant
 // to be attached to a model.
 type recordRuleRegistry struct {
@@ -81,6 +109,29 @@ func (rrr *recordRuleRegistry) removeRule(name string) {
 	}
 }
 
+// applicableRules returns the global rules and the rules of the groups of the
+// user with the given uid that apply to the given perm, sorted by name.
+func (rrr *recordRuleRegistry) applicableRules(uid int64, perm security.Permission) ([]*RecordRule, []*RecordRule) {
+	rrr.RLock()
+	defer rrr.RUnlock()
+	var globalRules, groupRules []*RecordRule
+	for _, rule := range rrr.globalRules {
+		if perm&rule.Perms > 0 {
+			globalRules = append(globalRules, rule)
+		}
+	}
+	for group := range security.Registry.UserGroups(uid) {
+		for _, rule := range rrr.rulesByGroup[group.Name] {
+			if perm&rule.Perms > 0 {
+				groupRules = append(groupRules, rule)
+			}
+		}
+	}
+	sort.Sort(recordRulesByName(globalRules))
+	sort.Sort(recordRulesByName(groupRules))
+	return globalRules, groupRules
+}
+
 // newRecordRuleRegistry returns a pointer to a new RecordRuleRegistry instance
 func newRecordRuleRegistry() *recordRuleRegistry {
 	return &recordRuleRegistry{
@@ -101,3 +152,45 @@ func (m *Model) AddRecordRule(rule *RecordRule) {
 func (m *Model) RemoveRecordRule(name string) {
 	m.rulesRegistry.removeRule(name)
 }
+
+// CheckRecordRules evaluates the record rules of this model that apply to
+// the given perm for the user of env on the record with the given id.
+//
+// It returns true if the record rules grant access to the record, that is if
+// all global rules match and if at least one of the rules of the user's groups
+// match when there are any. The result of each evaluated rule is also returned,
+// global rules first.
+func (m *Model) CheckRecordRules(env Environment, id int64, perm security.Permission) (bool, []RecordRuleCheck) {
+	globalRules, groupRules := m.rulesRegistry.applicableRules(env.Uid(), perm)
+	var res []RecordRuleCheck
+	granted := true
+	for _, rule := range globalRules {
+		matches := m.recordMatchesCondition(env, id, rule.condition(env))
+		res = append(res, RecordRuleCheck{Rule: rule, Matches: matches})
+		granted = granted && matches
+	}
+	var groupGranted bool
+	for _, rule := range groupRules {
+		matches := m.recordMatchesCondition(env, id, rule.condition(env))
+		res = append(res, RecordRuleCheck{Rule: rule, Matches: matches})
+		groupGranted = groupGranted || matches
+	}
+	if len(groupRules) > 0 {
+		granted = granted && groupGranted
+	}
+	return granted, res
+}
+
+// recordMatchesCondition returns true if the record of this model
+// with the given id matches the given condition.
+func (m *Model) recordMatchesCondition(env Environment, id int64, cond *Condition) bool {
+	if cond == nil || cond.IsEmpty() {
+		return true
+	}
+	rSet := newRecordCollection(env, m.name).withIds([]int64{id}).Search(cond)
+	// Functions in conditions must be evaluated with our Environment
+	rSet.query.recordSet = rSet
+	// Only cond must be evaluated, not the other record rules
+	rSet.filtered = true
+	return rSet.searchCount() > 0
+}
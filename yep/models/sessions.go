@@ -0,0 +1,163 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+// declareSessionModel creates the Session model which holds the HTTP
+// sessions of the users when sessions are stored in the database.
+func declareSessionModel() {
+	session := NewModel("Session")
+	session.AddCharField("Key", StringFieldParams{Required: true, Unique: true, NoCopy: true,
+		Help: "The hash of the ID of the session"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+	session.AddMany2OneField("User", ForeignKeyFieldParams{RelationModel: "Users", Index: true,
+		OnDelete: Cascade, Help: "The user logged in this session"})
+	session.AddTextField("Data", StringFieldParams{NoCopy: true,
+		Help: "The encoded values of the session"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write)
+	session.AddDateTimeField("ExpirationDate", SimpleFieldParams{Required: true, Index: true})
+	session.AddDateTimeField("LastActivity", SimpleFieldParams{})
+	session.AddCharField("RemoteAddr", StringFieldParams{String: "Remote Address"})
+	session.AddCharField("UserAgent", StringFieldParams{})
+
+	session.AddMethod("Revoke",
+		`Revoke deletes the sessions of this RecordSet, so that their users
+		are logged out. Only the user of a session or an administrator can
+		revoke it.`,
+		func(rc RecordCollection) {
+			for _, sess := range rc.Sudo().Records() {
+				user := sess.Get("User").(RecordCollection)
+				if (user.IsEmpty() || user.Ids()[0] != rc.Env().Uid()) &&
+					!security.Registry.HasMembership(rc.Env().Uid(), security.GroupAdmin) {
+					log.Panic("Only the user of a session can revoke it", "uid", rc.Env().Uid(), "session", sess.Ids()[0])
+				}
+			}
+			rc.Sudo().Call("Unlink")
+		}).AllowGroup(security.GroupEveryone).Expose()
+
+	users := Registry.MustGet("Users")
+	users.AddOne2ManyField("Sessions", ReverseFieldParams{RelationModel: "Session", ReverseFK: "User",
+		Help: "The sessions of this user stored in the database"})
+
+	users.AddMethod("RevokeSessions",
+		`RevokeSessions deletes all the sessions of this user stored in the database,
+		so that the user is logged out everywhere.`,
+		func(rc RecordCollection) {
+			rc.checkSelfOrAdmin()
+			rc.Sudo().Get("Sessions").(RecordCollection).Call("Unlink")
+		}).AllowGroup(security.GroupEveryone).Expose()
+}
+
+// A DBSession is the data of an HTTP session stored in the database
+type DBSession struct {
+	ID             string
+	UID            int64
+	Data           string
+	ExpirationDate time.Time
+	RemoteAddr     string
+	UserAgent      string
+}
+
+// hashSessionID returns the hash of the given session ID that is stored in
+// the database, so that sessions cannot be hijacked from a database dump.
+func hashSessionID(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:])
+}
+
+// LoadDBSession returns the session with the given ID from the database.
+// The second returned value is false if there is no such session or if it
+// has expired.
+func LoadDBSession(id string) (DBSession, bool) {
+	var (
+		res   DBSession
+		found bool
+	)
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		sessions := env.Pool("Session")
+		sess := sessions.Search(sessions.Model().Field("Key").Equals(hashSessionID(id)))
+		if sess.IsEmpty() {
+			return
+		}
+		expiration := time.Time(sess.Get("ExpirationDate").(types.DateTime))
+		if time.Now().After(expiration) {
+			return
+		}
+		res = DBSession{
+			ID:             id,
+			Data:           sess.Get("Data").(string),
+			ExpirationDate: expiration,
+			RemoteAddr:     sess.Get("RemoteAddr").(string),
+			UserAgent:      sess.Get("UserAgent").(string),
+		}
+		if user := sess.Get("User").(RecordCollection); !user.IsEmpty() {
+			res.UID = user.Ids()[0]
+		}
+		found = true
+	})
+	if err != nil {
+		log.Warn("Unable to load session", "error", err)
+		return DBSession{}, false
+	}
+	return res, found
+}
+
+// SaveDBSession writes the given session to the database. If create is
+// false, the session is only updated and false is returned if it does not
+// exist anymore, typically because it has been revoked. Expired sessions
+// are deleted when a new session is created.
+func SaveDBSession(session DBSession, create bool) bool {
+	ok := true
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		sessions := env.Pool("Session")
+		data := FieldMap{
+			"Data":           session.Data,
+			"ExpirationDate": types.DateTime(session.ExpirationDate),
+			"LastActivity":   types.DateTime(time.Now()),
+			"RemoteAddr":     session.RemoteAddr,
+			"UserAgent":      session.UserAgent,
+		}
+		if session.UID != 0 {
+			data["User"] = session.UID
+		}
+		sess := sessions.Search(sessions.Model().Field("Key").Equals(hashSessionID(session.ID)))
+		switch {
+		case !sess.IsEmpty():
+			if session.UID == 0 {
+				data["User"] = nil
+			}
+			sess.Call("Write", data)
+		case !create:
+			ok = false
+		default:
+			sessions.Search(sessions.Model().Field("ExpirationDate").Lower(types.DateTime(time.Now()))).Call("Unlink")
+			data["Key"] = hashSessionID(session.ID)
+			sessions.Call("Create", data)
+		}
+	})
+	if err != nil {
+		log.Warn("Unable to save session", "error", err)
+		return false
+	}
+	return ok
+}
+
+// DeleteDBSession deletes the session with the given ID from the database
+func DeleteDBSession(id string) {
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		sessions := env.Pool("Session")
+		sessions.Search(sessions.Model().Field("Key").Equals(hashSessionID(id))).Call("Unlink")
+	})
+	if err != nil {
+		log.Warn("Unable to delete session", "error", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/npiganeau/yep/yep/models/types"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -48,18 +49,22 @@ func TestCreateDB(t *testing.T) {
 		profile.AddOne2OneField("BestPost", ForeignKeyFieldParams{RelationModel: "Post"})
 		profile.AddCharField("City", StringFieldParams{})
 		profile.AddCharField("Country", StringFieldParams{})
+		profile.AddImageField("Picture", SimpleFieldParams{})
 
 		post := NewModel("Post")
 		post.AddMany2OneField("User", ForeignKeyFieldParams{RelationModel: "User"})
 		post.AddCharField("Title", StringFieldParams{})
 		post.AddTextField("Content", StringFieldParams{})
 		post.AddMany2ManyField("Tags", Many2ManyFieldParams{RelationModel: "Tag"})
+		post.AddSelectionField("Status", SelectionFieldParams{Selection: types.Selection{"draft": "Draft"}, SelectionMethod: "GetStatuses"})
 
 		tag := NewModel("Tag")
 		tag.AddCharField("Name", StringFieldParams{})
 		tag.AddMany2OneField("BestPost", ForeignKeyFieldParams{RelationModel: "Post"})
 		tag.AddMany2ManyField("Posts", Many2ManyFieldParams{RelationModel: "Post"})
 		tag.AddCharField("Description", StringFieldParams{})
+		tag.InheritModel(Registry.MustGet("CompanyMixin"))
+		post.InheritModel(Registry.MustGet("CompanyMixin"))
 
 		addressMI := NewMixinModel("AddressMixIn")
 		addressMI.AddCharField("Street", StringFieldParams{})
@@ -163,6 +168,13 @@ func TestCreateDB(t *testing.T) {
 				return res
 			})
 
+		post.AddMethod("GetStatuses", "",
+			func(rc RecordCollection) types.Selection {
+				return types.Selection{"published": "Published"}
+			})
+
+		post.Fields().MustGet("Status").UpdateSelection(types.Selection{"archived": "Archived"})
+
 		// Creating a dummy table to check that it is correctly removed by Bootstrap
 		dbExecuteNoTx("CREATE TABLE IF NOT EXISTS shouldbedeleted (id serial NOT NULL PRIMARY KEY)")
 	})
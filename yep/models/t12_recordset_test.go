@@ -18,9 +18,14 @@ import (
 	"testing"
 
 	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	"github.com/npiganeau/yep/yep/tools/imageutils"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// testPicture is a base64 encoded 128x64 PNG image
+const testPicture = "iVBORw0KGgoAAAANSUhEUgAAAIAAAABACAIAAABdtOgoAAAAjUlEQVR4nOzRoREAMAgEwZ9M+m8ZFDUg2FPn9ycV7fVmAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAADAZYAeAHTaAYI4lAw9AAAAAElFTkSuQmCC"
+
 func TestCreateRecordSet(t *testing.T) {
 	Convey("Test record creation", t, func() {
 		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
@@ -43,9 +48,17 @@ func TestCreateRecordSet(t *testing.T) {
 					"City":    "New York",
 					"Zip":     "0305",
 					"Country": "USA",
+					"Picture": testPicture,
 				}
 				profile := env.Pool("Profile").Call("Create", userJaneProfileData).(RecordCollection)
 				So(profile.Len(), ShouldEqual, 1)
+				So(profile.Get("Picture"), ShouldEqual, testPicture)
+				So(profile.Get("PictureLarge"), ShouldEqual, testPicture)
+				So(profile.Get("PictureMedium"), ShouldEqual, testPicture)
+				small, _, err := imageutils.DecodeBase64(profile.Get("PictureSmall").(string))
+				So(err, ShouldBeNil)
+				So(small.Bounds().Dx(), ShouldEqual, 64)
+				So(small.Bounds().Dy(), ShouldEqual, 32)
 				userJaneData := FieldMap{
 					"Name":    "Jane Smith",
 					"Email":   "jane.smith@example.com",
@@ -103,6 +116,11 @@ func TestCreateRecordSet(t *testing.T) {
 				So(userWill.Len(), ShouldEqual, 1)
 				So(userWill.Get("ID"), ShouldBeGreaterThan, 0)
 			})
+			Convey("Creating a profile with an invalid picture should fail", func() {
+				So(func() {
+					env.Pool("Profile").Call("Create", FieldMap{"Picture": "bm90IGFuIGltYWdl"})
+				}, ShouldPanic)
+			})
 		})
 	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
@@ -294,6 +312,50 @@ func TestSearchRecordSet(t *testing.T) {
 				userModel.RemoveRecordRule("jOnly")
 				userModel.RemoveRecordRule("writeRule")
 			})
+			Convey("Checking record rules built from the environment", func() {
+				rule := RecordRule{
+					Name:  "ownUser",
+					Group: group1,
+					ConditionFunc: func(env Environment) *Condition {
+						if env.Uid() == 2 {
+							return userModel.Field("Name").Equals("Jane Smith")
+						}
+						return userModel.Field("Name").Equals("John Smith")
+					},
+					Perms: security.Read,
+				}
+				userModel.AddRecordRule(&rule)
+				users := env.Pool("User").FetchAll()
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Get("Name"), ShouldEqual, "Jane Smith")
+
+				userJane := users.Ids()[0]
+				granted, checks := userModel.CheckRecordRules(env, userJane, security.Read)
+				So(granted, ShouldBeTrue)
+				So(checks, ShouldHaveLength, 1)
+				So(checks[0].Rule, ShouldEqual, &rule)
+				So(checks[0].Matches, ShouldBeTrue)
+				userJohn := env.Pool("User").Sudo().Search(userModel.Field("Name").Equals("John Smith")).Ids()[0]
+				granted, checks = userModel.CheckRecordRules(env, userJohn, security.Read)
+				So(granted, ShouldBeFalse)
+				So(checks[0].Matches, ShouldBeFalse)
+				granted, checks = userModel.CheckRecordRules(env, userJohn, security.Write)
+				So(granted, ShouldBeTrue)
+				So(checks, ShouldBeEmpty)
+
+				allRule := RecordRule{
+					Name:  "allUsers",
+					Group: group1,
+					Perms: security.Read,
+				}
+				userModel.AddRecordRule(&allRule)
+				users = env.Pool("User").FetchAll()
+				So(users.Len(), ShouldEqual, 3)
+				granted, _ = userModel.CheckRecordRules(env, userJohn, security.Read)
+				So(granted, ShouldBeTrue)
+				userModel.RemoveRecordRule("ownUser")
+				userModel.RemoveRecordRule("allUsers")
+			})
 		})
 	})
 	security.Registry.UnregisterGroup(group1)
@@ -456,6 +518,21 @@ func TestUpdateRecordSet(t *testing.T) {
 				So(post2Tags.Records()[0].Get("Name"), ShouldBeIn, "Books", "Jane's")
 				So(post2Tags.Records()[1].Get("Name"), ShouldBeIn, "Books", "Jane's")
 			})
+			Convey("Updating selection fields", func() {
+				posts := env.Pool("Post")
+				post1 := posts.Search(posts.Model().Field("title").Equals("1st Post"))
+				statusInfo := post1.Call("FieldGet", FieldName("Status")).(*FieldInfo)
+				So(statusInfo.Selection, ShouldResemble, types.Selection{
+					"draft":     "Draft",
+					"published": "Published",
+					"archived":  "Archived",
+				})
+				post1.Set("Status", "published")
+				So(post1.Get("Status"), ShouldEqual, "published")
+				post1.Set("Status", "archived")
+				So(post1.Get("Status"), ShouldEqual, "archived")
+				So(func() { post1.Set("Status", "unknown") }, ShouldPanic)
+			})
 		})
 	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
@@ -15,7 +15,9 @@
 package models
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/npiganeau/yep/yep/models/security"
 	"github.com/npiganeau/yep/yep/models/types"
@@ -81,3 +83,26 @@ func TestEnvironment(t *testing.T) {
 		})
 	})
 }
+
+func TestWaitForEnvironments(t *testing.T) {
+	Convey("Testing waiting for running environments", t, func() {
+		So(WaitForEnvironments(context.Background()), ShouldBeNil)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				close(started)
+				<-release
+			})
+			close(done)
+		}()
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(WaitForEnvironments(ctx), ShouldEqual, context.DeadlineExceeded)
+		close(release)
+		<-done
+		So(WaitForEnvironments(context.Background()), ShouldBeNil)
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompanies(t *testing.T) {
+	Convey("Creating companies and company records", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			Convey("Creating companies, a user and tags", func() {
+				companyA := env.Pool("Company").Call("Create", FieldMap{"Name": "Company A"}).(RecordCollection)
+				companyB := env.Pool("Company").Call("Create", FieldMap{"Name": "Company B"}).(RecordCollection)
+				userA := env.Pool("Users").Call("Create", FieldMap{
+					"Name":      "User A",
+					"Login":     "usera",
+					"Company":   companyA,
+					"Companies": companyA,
+				}).(RecordCollection)
+				So(userA.Get("Company").(RecordCollection).Ids(), ShouldResemble, companyA.Ids())
+				env.Pool("Tag").Call("Create", FieldMap{"Name": "Tag A", "Company": companyA})
+				env.Pool("Tag").Call("Create", FieldMap{"Name": "Tag B", "Company": companyB})
+				So(env.CompanyIDs(), ShouldContain, companyA.Ids()[0])
+				So(env.CompanyIDs(), ShouldContain, companyB.Ids()[0])
+			})
+		})
+	})
+	Convey("Testing company record rules", t, func() {
+		var userAID int64
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("Users")
+			userAID = users.Search(users.Model().Field("Login").Equals("usera")).Ids()[0]
+		})
+		security.Registry.AddMembership(userAID, security.GroupAdmin)
+		SimulateInNewEnvironment(userAID, func(env Environment) {
+			tags := env.Pool("Tag")
+			companies := env.Pool("Company")
+			companyA := companies.Search(companies.Model().Field("Name").Equals("Company A"))
+			companyB := companies.Search(companies.Model().Field("Name").Equals("Company B"))
+			Convey("Environment companies should be derived from the user", func() {
+				So(env.CompanyID(), ShouldEqual, companyA.Ids()[0])
+				So(env.CompanyIDs(), ShouldResemble, companyA.Ids())
+			})
+			Convey("User should only see records of its companies", func() {
+				cond := tags.Model().Field("Name").In([]string{"Tag A", "Tag B"})
+				userTags := tags.Search(cond).Load()
+				So(userTags.Len(), ShouldEqual, 1)
+				So(userTags.Get("Name"), ShouldEqual, "Tag A")
+				So(tags.Sudo().Search(cond).SearchCount(), ShouldEqual, 2)
+			})
+			Convey("Records without company should be visible by all", func() {
+				posts := env.Pool("Post")
+				So(posts.Search(posts.Model().Field("Title").Equals("1st Post")).SearchCount(), ShouldEqual, 1)
+			})
+			Convey("Company of new records should default to the user's company", func() {
+				newTag := tags.Call("Create", FieldMap{"Name": "Tag User A"}).(RecordCollection)
+				So(newTag.Get("Company").(RecordCollection).Ids(), ShouldResemble, companyA.Ids())
+			})
+			Convey("Context should restrict allowed companies", func() {
+				restricted := tags.WithContext("allowed_company_ids", []int64{companyB.Ids()[0]})
+				So(restricted.Env().CompanyIDs(), ShouldBeEmpty)
+				So(restricted.Env().CompanyID(), ShouldEqual, 0)
+				So(restricted.Search(restricted.Model().Field("Name").Equals("Tag A")).SearchCount(), ShouldEqual, 0)
+			})
+		})
+		security.Registry.RemoveMembership(userAID, security.GroupAdmin)
+	})
+	Convey("Testing cross-company consistency", t, func() {
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tags := env.Pool("Tag")
+			companies := env.Pool("Company")
+			tagA := tags.Search(tags.Model().Field("Name").Equals("Tag A"))
+			companyA := companies.Search(companies.Model().Field("Name").Equals("Company A"))
+			companyB := companies.Search(companies.Model().Field("Name").Equals("Company B"))
+			Convey("Linking records of the same company should work", func() {
+				post := env.Pool("Post").Call("Create", FieldMap{
+					"Title":   "Company A Post",
+					"Company": companyA,
+					"Tags":    tagA,
+				}).(RecordCollection)
+				So(post.Get("Tags").(RecordCollection).Ids(), ShouldResemble, tagA.Ids())
+			})
+			Convey("Linking records of different companies should fail", func() {
+				So(func() {
+					env.Pool("Post").Call("Create", FieldMap{
+						"Title":   "Company B Post",
+						"Company": companyB,
+						"Tags":    tagA,
+					})
+				}, ShouldPanic)
+			})
+			Convey("Changing the company of a linked record should fail", func() {
+				post := env.Pool("Post").Call("Create", FieldMap{
+					"Title": "No Company Post",
+					"Tags":  tagA,
+				}).(RecordCollection)
+				So(func() { post.Set("Company", companyB) }, ShouldPanic)
+			})
+		})
+	})
+}
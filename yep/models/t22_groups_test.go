@@ -0,0 +1,119 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroups(t *testing.T) {
+	Convey("Code groups should have been synchronized with the database", t, func() {
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			groups := env.Pool("Group")
+			admin := groups.Search(groups.Model().Field("GroupID").Equals(security.GroupAdminID))
+			So(admin.Len(), ShouldEqual, 1)
+			So(admin.Get("Name"), ShouldEqual, security.GroupAdmin.Name)
+		})
+	})
+	Convey("Creating groups and users with groups", t, func() {
+		Convey("Creating groups should register them once committed", func() {
+			var userID int64
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				sales := env.Pool("Group").Call("Create", FieldMap{
+					"GroupID": "sales_test",
+					"Name":    "Sales",
+				}).(RecordCollection)
+				manager := env.Pool("Group").Call("Create", FieldMap{
+					"GroupID":  "sales_manager_test",
+					"Name":     "Sales Manager",
+					"Inherits": sales,
+				}).(RecordCollection)
+				So(security.Registry.GetGroup("sales_test"), ShouldBeNil)
+
+				user := env.Pool("Users").Call("Create", FieldMap{
+					"Name":   "Sales Manager User",
+					"Login":  "salesmanager",
+					"Groups": manager,
+				}).(RecordCollection)
+				userID = user.Ids()[0]
+			})
+			salesGroup := security.Registry.GetGroup("sales_test")
+			managerGroup := security.Registry.GetGroup("sales_manager_test")
+			So(salesGroup, ShouldNotBeNil)
+			So(managerGroup, ShouldNotBeNil)
+			So(managerGroup.Inherits, ShouldContain, salesGroup)
+			So(security.Registry.HasMembership(userID, managerGroup), ShouldBeTrue)
+			So(security.Registry.HasMembership(userID, salesGroup), ShouldBeTrue)
+		})
+	})
+	Convey("Synchronizing groups and memberships", t, func() {
+		var userID int64
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("Users")
+			userID = users.Search(users.Model().Field("Login").Equals("salesmanager")).Ids()[0]
+		})
+		salesGroup := security.Registry.GetGroup("sales_test")
+		managerGroup := security.Registry.GetGroup("sales_manager_test")
+		Convey("Memberships should be updated when records change", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").withIds([]int64{userID})
+				user.Set("Groups", env.Pool("Group").Search(env.Pool("Group").Model().Field("GroupID").Equals("sales_test")))
+				So(security.Registry.HasMembership(userID, managerGroup), ShouldBeTrue)
+			})
+			So(security.Registry.HasMembership(userID, managerGroup), ShouldBeFalse)
+			So(security.Registry.HasMembership(userID, salesGroup), ShouldBeTrue)
+		})
+		Convey("Rolled back changes should not be kept in memory", func() {
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Group").Call("Create", FieldMap{"GroupID": "simulated_test", "Name": "Simulated"})
+				user := env.Pool("Users").withIds([]int64{userID})
+				user.Set("Groups", []int64{})
+			})
+			So(security.Registry.GetGroup("simulated_test"), ShouldBeNil)
+			So(security.Registry.HasMembership(userID, salesGroup), ShouldBeTrue)
+		})
+		Convey("Groups and memberships should be loaded from the database", func() {
+			security.Registry.RemoveAllMembershipsForUser(userID)
+			loadSecurityGroups(dbSelectNoTx)
+			loadSecurityMemberships(dbSelectNoTx)
+			So(security.Registry.HasMembership(userID, salesGroup), ShouldBeTrue)
+		})
+		Convey("Memberships declared in code should be kept", func() {
+			security.Registry.AddMembership(userID, security.GroupAdmin)
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").withIds([]int64{userID})
+				user.Set("Groups", []int64{})
+			})
+			So(security.Registry.HasMembership(userID, salesGroup), ShouldBeFalse)
+			So(security.Registry.HasMembership(userID, security.GroupAdmin), ShouldBeTrue)
+			security.Registry.RemoveMembership(userID, security.GroupAdmin)
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").withIds([]int64{userID})
+				user.Set("Groups", env.Pool("Group").Search(env.Pool("Group").Model().Field("GroupID").Equals("sales_test")))
+			})
+		})
+		Convey("Deleting groups should unregister them", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				groups := env.Pool("Group")
+				groups.Search(groups.Model().Field("GroupID").Equals("sales_manager_test")).Call("Unlink")
+				So(security.Registry.GetGroup("sales_manager_test"), ShouldNotBeNil)
+			})
+			So(security.Registry.GetGroup("sales_manager_test"), ShouldBeNil)
+		})
+	})
+}
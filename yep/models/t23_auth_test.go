@@ -0,0 +1,139 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDBAuthBackend(t *testing.T) {
+	Convey("Creating a user with a password", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			user := env.Pool("Users").Call("Create", FieldMap{
+				"Name":  "Auth User",
+				"Login": "authuser",
+			}).(RecordCollection)
+			user.Call("ResetPassword", "secret")
+			So(user.Get("Password"), ShouldNotEqual, "secret")
+			So(user.Get("Password"), ShouldNotBeBlank)
+		})
+	})
+	Convey("Writing a password directly should store its hash", t, func() {
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			user := env.Pool("Users").Call("Create", FieldMap{
+				"Name":     "Plain User",
+				"Login":    "plainuser",
+				"Password": "plain",
+			}).(RecordCollection)
+			hash := user.Get("Password").(string)
+			So(hash, ShouldNotEqual, "plain")
+			ok, _ := security.CheckPassword(hash, "plain")
+			So(ok, ShouldBeTrue)
+			user.Call("Write", FieldMap{"password": "other"})
+			hash = user.Get("Password").(string)
+			So(hash, ShouldNotEqual, "other")
+			ok, _ = security.CheckPassword(hash, "other")
+			So(ok, ShouldBeTrue)
+		})
+	})
+	Convey("Authenticating users against the database", t, func() {
+		var userID int64
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("Users")
+			userID = users.Search(users.Model().Field("Login").Equals("authuser")).Ids()[0]
+		})
+		Reset(func() {
+			security.PasswordHashing = security.Bcrypt
+			MaxLoginFailures = 5
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Users").withIds([]int64{userID}).Call("ResetPassword", "secret")
+			})
+		})
+		Convey("Right password should authenticate the user", func() {
+			uid, err := security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldBeNil)
+			So(uid, ShouldEqual, userID)
+		})
+		Convey("Wrong password or login should fail", func() {
+			_, err := security.AuthenticationRegistry.Authenticate("authuser", "wrong", nil)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = security.AuthenticationRegistry.Authenticate("nouser", "secret", nil)
+			So(err, ShouldHaveSameTypeAs, security.UserNotFoundError(""))
+		})
+		Convey("Users should be locked out after too many failures", func() {
+			MaxLoginFailures = 2
+			security.AuthenticationRegistry.Authenticate("authuser", "wrong", nil)
+			_, err := security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldBeNil)
+			security.AuthenticationRegistry.Authenticate("authuser", "wrong", nil)
+			security.AuthenticationRegistry.Authenticate("authuser", "wrong", nil)
+			_, err = security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Users").withIds([]int64{userID}).Call("ResetPassword", "secret")
+			})
+			_, err = security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldBeNil)
+		})
+		Convey("Password hashes should be upgraded on login", func() {
+			security.PasswordHashing = security.Argon2ID
+			_, err := security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldBeNil)
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				hash := env.Pool("Users").withIds([]int64{userID}).Get("Password").(string)
+				So(hash, ShouldStartWith, "$argon2id$")
+			})
+			_, err = security.AuthenticationRegistry.Authenticate("authuser", "secret", nil)
+			So(err, ShouldBeNil)
+		})
+		Convey("Users should be able to change their password", func() {
+			ExecuteInNewEnvironment(userID, func(env Environment) {
+				env.Pool("Users").withIds([]int64{userID}).Call("ChangePassword", "secret", "newsecret")
+			})
+			_, err := security.AuthenticationRegistry.Authenticate("authuser", "newsecret", nil)
+			So(err, ShouldBeNil)
+			err = SimulateInNewEnvironment(userID, func(env Environment) {
+				env.Pool("Users").withIds([]int64{userID}).Call("ChangePassword", "wrong", "other")
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("Syncing users authenticated by OpenID Connect", t, func() {
+		const issuer = "https://idp.example.com"
+		Convey("Identities should not be bound to existing local users", func() {
+			_, err := SyncOIDCUser(issuer, "sub-1", "authuser", "Auth User", nil, nil, true)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = SyncOIDCUser(issuer, "", "oidcuser", "OIDC User", nil, nil, true)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("New identities should create users matched on issuer and subject", func() {
+			_, err := SyncOIDCUser(issuer, "sub-2", "oidcuser", "OIDC User", nil, nil, false)
+			So(err, ShouldHaveSameTypeAs, security.UserNotFoundError(""))
+			uid, err := SyncOIDCUser(issuer, "sub-2", "oidcuser", "OIDC User", nil, nil, true)
+			So(err, ShouldBeNil)
+			So(uid, ShouldNotEqual, 0)
+			uid2, err := SyncOIDCUser(issuer, "sub-2", "renamed", "OIDC User 2", nil, nil, false)
+			So(err, ShouldBeNil)
+			So(uid2, ShouldEqual, uid)
+			_, err = SyncOIDCUser("https://other.example.com", "sub-2", "oidcuser", "OIDC User", nil, nil, true)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = SyncOIDCUser(issuer, "sub-3", "oidcuser", "OIDC User", nil, nil, true)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+	})
+}
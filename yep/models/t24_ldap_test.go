@@ -0,0 +1,150 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+	"gopkg.in/ldap.v2"
+)
+
+// testLDAPEntry is an entry of the testLDAPDirectory
+type testLDAPEntry struct {
+	uid      string
+	password string
+	entry    *ldap.Entry
+}
+
+// testLDAPDirectory is an in-process LDAP server stand-in
+type testLDAPDirectory struct {
+	entries []testLDAPEntry
+}
+
+func (d *testLDAPDirectory) Bind(username, password string) error {
+	for _, e := range d.entries {
+		if e.entry.DN == username && e.password == password {
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *testLDAPDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	res := new(ldap.SearchResult)
+	for _, e := range d.entries {
+		if req.Filter == "(uid="+e.uid+")" && strings.HasSuffix(e.entry.DN, req.BaseDN) {
+			res.Entries = append(res.Entries, e.entry)
+		}
+	}
+	return res, nil
+}
+
+func (d *testLDAPDirectory) Close() {}
+
+func TestLDAPAuthBackend(t *testing.T) {
+	directory := &testLDAPDirectory{
+		entries: []testLDAPEntry{
+			{
+				uid:      "jdoe",
+				password: "ldapsecret",
+				entry: ldap.NewEntry("uid=jdoe,ou=people,dc=example,dc=com", map[string][]string{
+					"cn":       {"John Doe"},
+					"memberOf": {"cn=Managers,ou=groups,dc=example,dc=com"},
+				}),
+			},
+			{
+				uid:      "ldaplocal",
+				password: "ldapsecret",
+				entry: ldap.NewEntry("uid=ldaplocal,ou=people,dc=example,dc=com", map[string][]string{
+					"cn":       {"Local Takeover"},
+					"memberOf": {"cn=Managers,ou=groups,dc=example,dc=com"},
+				}),
+			},
+		},
+	}
+	backend := LDAPAuthBackend{
+		Dial: func() (LDAPConn, error) {
+			return directory, nil
+		},
+	}
+	viper.Set("LDAP.BaseDN", "dc=example,dc=com")
+	viper.Set("LDAP.GroupMapping", map[string]string{
+		"cn=managers,ou=groups,dc=example,dc=com": "ldap_managers_test",
+	})
+	ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		env.Pool("Group").Call("Create", FieldMap{"GroupID": "ldap_managers_test", "Name": "LDAP Managers"})
+		env.Pool("Users").Call("Create", FieldMap{"Login": "ldaplocal", "Name": "Local User", "Password": "localsecret"})
+	})
+	Convey("Testing LDAP authentication", t, func() {
+		Convey("Unknown logins should fall through", func() {
+			_, err := backend.Authenticate("nobody", "secret", nil)
+			So(err, ShouldHaveSameTypeAs, security.UserNotFoundError(""))
+		})
+		Convey("Unreachable servers should fall through", func() {
+			unreachable := LDAPAuthBackend{
+				Dial: func() (LDAPConn, error) {
+					return nil, errors.New("connection refused")
+				},
+			}
+			_, err := unreachable.Authenticate("jdoe", "ldapsecret", nil)
+			So(err, ShouldHaveSameTypeAs, security.UserNotFoundError(""))
+		})
+		Convey("Wrong or empty passwords should fail", func() {
+			_, err := backend.Authenticate("jdoe", "wrong", nil)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = backend.Authenticate("jdoe", "", nil)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+		Convey("Right password should create the local user with its groups", func() {
+			uid, err := backend.Authenticate("jdoe", "ldapsecret", nil)
+			So(err, ShouldBeNil)
+			So(uid, ShouldNotEqual, 0)
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").withIds([]int64{uid})
+				So(user.Get("Login"), ShouldEqual, "jdoe")
+				So(user.Get("Name"), ShouldEqual, "John Doe")
+				So(user.Get("LDAPDN"), ShouldEqual, "uid=jdoe,ou=people,dc=example,dc=com")
+			})
+			So(security.Registry.HasMembership(uid, security.Registry.GetGroup("ldap_managers_test")), ShouldBeTrue)
+			Convey("Next logins should update the same user", func() {
+				directory.entries[0].entry = ldap.NewEntry("uid=jdoe,ou=people,dc=example,dc=com", map[string][]string{
+					"cn": {"John Doe Jr"},
+				})
+				uid2, err := backend.Authenticate("jdoe", "ldapsecret", nil)
+				So(err, ShouldBeNil)
+				So(uid2, ShouldEqual, uid)
+				So(security.Registry.HasMembership(uid, security.Registry.GetGroup("ldap_managers_test")), ShouldBeFalse)
+			})
+		})
+		Convey("Local users should not be bound to LDAP entries", func() {
+			_, err := backend.Authenticate("ldaplocal", "ldapsecret", nil)
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				users := env.Pool("Users")
+				user := users.Search(users.Model().Field("Login").Equals("ldaplocal"))
+				So(user.Get("Name"), ShouldEqual, "Local User")
+				So(user.Get("LDAPDN"), ShouldEqual, "")
+				So(security.Registry.HasMembership(user.Ids()[0], security.Registry.GetGroup("ldap_managers_test")), ShouldBeFalse)
+			})
+		})
+	})
+	viper.Set("LDAP.BaseDN", "")
+	viper.Set("LDAP.GroupMapping", map[string]string{})
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelAccessRights(t *testing.T) {
+	Convey("Creating a group for model access rights", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			env.Pool("Group").Call("Create", FieldMap{
+				"GroupID":       "access_test",
+				"Name":          "Access Test",
+				"YEPExternalID": "access_test",
+			})
+		})
+	})
+	accessGroup := security.Registry.GetGroup("access_test")
+	security.Registry.AddMembership(2, accessGroup)
+	tagModel := Registry.MustGet("Tag")
+	tagModel.methods.MustGet("Create").AllowGroup(accessGroup)
+	tagModel.methods.MustGet("Load").AllowGroup(accessGroup)
+	Convey("Testing model access rights declared in code", t, func() {
+		Convey("Everyone should have all rights by default", func() {
+			So(checkModelPermission(tagModel, 2, security.All), ShouldBeTrue)
+		})
+		Convey("Revoking a right should prevent its use", func() {
+			tagModel.RevokeAccess(security.GroupEveryone, security.Create)
+			Reset(func() {
+				tagModel.GrantAccess(security.GroupEveryone, security.Create)
+			})
+			So(checkModelPermission(tagModel, 2, security.Create), ShouldBeFalse)
+			So(checkModelPermission(tagModel, 2, security.Read|security.Write|security.Unlink), ShouldBeTrue)
+			So(checkModelPermission(tagModel, security.SuperUserID, security.Create), ShouldBeTrue)
+			SimulateInNewEnvironment(2, func(env Environment) {
+				So(func() { env.Pool("Tag").Call("Create", FieldMap{"Name": "Forbidden Tag"}) }, ShouldPanic)
+			})
+			Convey("Granting it to a group of the user should allow it again", func() {
+				tagModel.GrantAccess(accessGroup, security.Create)
+				Reset(func() {
+					tagModel.RevokeAccess(accessGroup, security.Create)
+				})
+				So(checkModelPermission(tagModel, 2, security.Create), ShouldBeTrue)
+				So(checkModelPermission(tagModel, 3, security.Create), ShouldBeFalse)
+			})
+		})
+	})
+	Convey("Testing read access on searches", t, func() {
+		tagModel.RevokeAccess(security.GroupEveryone, security.Read)
+		Reset(func() {
+			tagModel.GrantAccess(security.GroupEveryone, security.Read)
+		})
+		SimulateInNewEnvironment(2, func(env Environment) {
+			tags := env.Pool("Tag")
+			So(func() { tags.FetchAll().SearchCount() }, ShouldPanic)
+			So(func() { tags.Search(tagModel.Field("Name").ILike("a")).SearchCount() }, ShouldPanic)
+			So(func() { tags.Search(tagModel.Field("Name").ILike("a")).Ids() }, ShouldPanic)
+		})
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			So(func() { env.Pool("Tag").FetchAll().SearchCount() }, ShouldNotPanic)
+		})
+	})
+	Convey("Testing model access rights loaded from data files", t, func() {
+		LoadCSVDataFile("testdata/ModelAccess.csv")
+		So(getModelAccessRights(tagModel), ShouldNotBeNil)
+		Convey("Only rights of the records should be granted", func() {
+			So(checkModelPermission(tagModel, 2, security.Read), ShouldBeTrue)
+			So(checkModelPermission(tagModel, 2, security.Write), ShouldBeFalse)
+			So(checkModelPermission(tagModel, 2, security.Create), ShouldBeFalse)
+			So(checkModelPermission(tagModel, 2, security.Unlink), ShouldBeFalse)
+			So(checkModelPermission(tagModel, 3, security.Read), ShouldBeFalse)
+			So(checkModelPermission(Registry.MustGet("Post"), 3, security.All), ShouldBeTrue)
+		})
+		Convey("Rights should be enforced on records", func() {
+			SimulateInNewEnvironment(2, func(env Environment) {
+				So(func() { env.Pool("Tag").FetchAll() }, ShouldNotPanic)
+				So(func() { env.Pool("Tag").Call("Create", FieldMap{"Name": "Forbidden Tag"}) }, ShouldPanic)
+			})
+		})
+		Convey("Rolled back changes should not be kept in memory", func() {
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				access := env.Pool("ModelAccess")
+				access.Search(access.Model().Field("TargetModel").Equals("Tag")).Call("Unlink")
+				So(getModelAccessRights(tagModel), ShouldNotBeNil)
+			})
+			So(getModelAccessRights(tagModel), ShouldNotBeNil)
+		})
+		Convey("Deleting the records should restore the rights declared in code", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				access := env.Pool("ModelAccess")
+				access.Search(access.Model().Field("TargetModel").Equals("Tag")).Call("Unlink")
+			})
+			So(getModelAccessRights(tagModel), ShouldBeNil)
+			So(checkModelPermission(tagModel, 3, security.All), ShouldBeTrue)
+		})
+	})
+	security.Registry.RemoveMembership(2, accessGroup)
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPIKeys(t *testing.T) {
+	var (
+		userID                 int64
+		rpcKey, allKey, oldKey string
+	)
+	Convey("Generating API keys", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			user := env.Pool("Users").Call("Create", FieldMap{
+				"Name":  "API User",
+				"Login": "apiuser",
+			}).(RecordCollection)
+			userID = user.Ids()[0]
+			rpcKey = user.Call("GenerateAPIKey", "Script", "rpc", types.DateTime{}).(string)
+			allKey = user.Call("GenerateAPIKey", "All", "", types.DateTime(time.Now().Add(time.Hour))).(string)
+			oldKey = user.Call("GenerateAPIKey", "Old", "", types.DateTime(time.Now().Add(-time.Hour))).(string)
+			So(strings.Count(rpcKey, "."), ShouldEqual, 1)
+			keys := env.Pool("APIKey")
+			rpcRec := keys.Search(keys.Model().Field("Prefix").Equals(strings.Split(rpcKey, ".")[0]))
+			So(rpcRec.Len(), ShouldEqual, 1)
+			So(rpcRec.Get("Hash"), ShouldNotBeBlank)
+			So(rpcKey, ShouldNotContainSubstring, rpcRec.Get("Hash").(string))
+		})
+	})
+	Convey("Authenticating with API keys", t, func() {
+		Convey("Valid keys should authenticate their user", func() {
+			uid, err := AuthenticateAPIKey(rpcKey, "rpc")
+			So(err, ShouldBeNil)
+			So(uid, ShouldEqual, userID)
+			uid, err = AuthenticateAPIKey(rpcKey, "")
+			So(err, ShouldBeNil)
+			So(uid, ShouldEqual, userID)
+			uid, err = AuthenticateAPIKey(allKey, "rpc")
+			So(err, ShouldBeNil)
+			So(uid, ShouldEqual, userID)
+		})
+		Convey("Keys should only be valid for their scopes", func() {
+			_, err := AuthenticateAPIKey(rpcKey, "admin")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+		Convey("Wrong or malformed keys should fail", func() {
+			_, err := AuthenticateAPIKey(strings.Split(rpcKey, ".")[0]+".wrong", "rpc")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = AuthenticateAPIKey("nokey", "rpc")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+			_, err = AuthenticateAPIKey("", "")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+		Convey("Expired keys should fail", func() {
+			_, err := AuthenticateAPIKey(oldKey, "")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+		Convey("Revoked keys should fail", func() {
+			var revKey string
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				revKey = env.Pool("Users").withIds([]int64{userID}).Call("GenerateAPIKey", "Revoked", "", types.DateTime{}).(string)
+			})
+			_, err := AuthenticateAPIKey(revKey, "")
+			So(err, ShouldBeNil)
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				keys := env.Pool("APIKey")
+				keys.Search(keys.Model().Field("Prefix").Equals(strings.Split(revKey, ".")[0])).Call("Revoke")
+			})
+			_, err = AuthenticateAPIKey(revKey, "")
+			So(err, ShouldHaveSameTypeAs, security.InvalidCredentialsError(""))
+		})
+		Convey("Only the user itself or an admin can generate keys", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").Call("Create", FieldMap{
+					"Name":  "Other API User",
+					"Login": "otherapiuser",
+				}).(RecordCollection)
+				So(func() {
+					user.Sudo(userID).Call("GenerateAPIKey", "Stolen", "", types.DateTime{})
+				}, ShouldPanic)
+			})
+		})
+	})
+}
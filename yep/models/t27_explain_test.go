@@ -0,0 +1,66 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExplainAccess(t *testing.T) {
+	var userID int64
+	Convey("Getting a record to explain access to", t, func() {
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("Users")
+			userID = users.Search(users.Model().Field("Login").Equals("salesmanager")).Ids()[0]
+		})
+	})
+	Convey("Testing access explanations", t, func() {
+		Convey("Super user access should be granted", func() {
+			exp := security.Explain(security.SuperUserID, "Users", []int64{userID}, security.Read)
+			So(exp.Granted, ShouldBeTrue)
+			So(exp.DeniedBy, ShouldBeNil)
+			So(exp.Checks[0].Kind, ShouldEqual, security.MethodCheck)
+			So(exp.Checks[0].Name, ShouldEqual, "Users.Load")
+			So(exp.Checks[1].Kind, ShouldEqual, security.ModelCheck)
+			So(exp.Checks[len(exp.Checks)-1].Kind, ShouldEqual, security.RecordRuleCheck)
+			So(exp.Checks[len(exp.Checks)-1].Granted, ShouldBeTrue)
+		})
+		Convey("Access should be denied by method permissions", func() {
+			exp := security.Explain(12, "Users", []int64{userID}, security.Write)
+			So(exp.Granted, ShouldBeFalse)
+			So(exp.DeniedBy.Kind, ShouldEqual, security.MethodCheck)
+			So(exp.DeniedBy.Name, ShouldEqual, "Users.Write")
+		})
+		Convey("Denied field permissions should be reported", func() {
+			exp := security.Explain(12, "Users", nil, security.Read)
+			var passwordCheck *security.Check
+			for i, check := range exp.Checks {
+				if check.Kind == security.FieldCheck && check.Name == "Users.Password" {
+					passwordCheck = &exp.Checks[i]
+				}
+			}
+			So(passwordCheck, ShouldNotBeNil)
+			So(passwordCheck.Granted, ShouldBeFalse)
+		})
+		Convey("Record rules should be reported", func() {
+			userModel := Registry.MustGet("Users")
+			userModel.AddRecordRule(&RecordRule{
+				Name:      "explainRule",
+				Global:    true,
+				Condition: userModel.Field("Login").Equals("nobody"),
+				Perms:     security.Read,
+			})
+			Reset(func() {
+				userModel.RemoveRecordRule("explainRule")
+			})
+			exp := security.Explain(security.SuperUserID, "Users", []int64{userID}, security.Read)
+			So(exp.Granted, ShouldBeFalse)
+			So(exp.DeniedBy.Kind, ShouldEqual, security.RecordRuleCheck)
+			So(exp.DeniedBy.Details, ShouldContain, "rule explainRule (global): does not match")
+		})
+	})
+}
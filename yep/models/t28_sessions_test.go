@@ -0,0 +1,74 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDBSessions(t *testing.T) {
+	var userID int64
+	Convey("Storing sessions in the database", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			userID = env.Pool("Users").Call("Create", FieldMap{
+				"Name":  "Session User",
+				"Login": "sessionuser",
+			}).(RecordCollection).Ids()[0]
+		})
+		So(SaveDBSession(DBSession{ID: "session1", Data: "anonymous",
+			ExpirationDate: time.Now().Add(time.Hour)}, true), ShouldBeTrue)
+		So(SaveDBSession(DBSession{ID: "session1", UID: userID, Data: "logged",
+			ExpirationDate: time.Now().Add(time.Hour), RemoteAddr: "127.0.0.1"}, false), ShouldBeTrue)
+		So(SaveDBSession(DBSession{ID: "session2", UID: userID,
+			ExpirationDate: time.Now().Add(time.Hour)}, true), ShouldBeTrue)
+		So(SaveDBSession(DBSession{ID: "expired", UID: userID,
+			ExpirationDate: time.Now().Add(-time.Hour)}, true), ShouldBeTrue)
+		So(SaveDBSession(DBSession{ID: "unknown"}, false), ShouldBeFalse)
+	})
+	Convey("Loading and revoking sessions", t, func() {
+		Convey("Sessions should be loaded with their data", func() {
+			sess, ok := LoadDBSession("session1")
+			So(ok, ShouldBeTrue)
+			So(sess.UID, ShouldEqual, userID)
+			So(sess.Data, ShouldEqual, "logged")
+			So(sess.RemoteAddr, ShouldEqual, "127.0.0.1")
+			_, ok = LoadDBSession("expired")
+			So(ok, ShouldBeFalse)
+			_, ok = LoadDBSession("unknown")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Session IDs should not be stored in clear", func() {
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				sessions := env.Pool("Session")
+				So(sessions.Search(sessions.Model().Field("Key").Equals("session1")).IsEmpty(), ShouldBeTrue)
+			})
+		})
+		Convey("Sessions of a user should be listed and revoked", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				user := env.Pool("Users").withIds([]int64{userID})
+				So(user.Get("Sessions").(RecordCollection).Len(), ShouldEqual, 3)
+				user.Sudo(userID).Call("RevokeSessions")
+			})
+			_, ok := LoadDBSession("session1")
+			So(ok, ShouldBeFalse)
+			_, ok = LoadDBSession("session2")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTOTP(t *testing.T) {
+	var (
+		userID        int64
+		secret        string
+		recoveryCodes []string
+	)
+	Convey("Enabling two-factor authentication", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			user := env.Pool("Users").Call("Create", FieldMap{
+				"Name":  "TOTP User",
+				"Login": "totpuser",
+			}).(RecordCollection)
+			userID = user.Ids()[0]
+			uri := user.Call("EnableTOTP").(string)
+			secret = user.Get("TOTPSecret").(string)
+			So(uri, ShouldStartWith, "otpauth://totp/")
+			So(uri, ShouldContainSubstring, "secret="+secret)
+			So(user.Get("TOTPEnabled"), ShouldBeFalse)
+			So(func() { user.Call("ConfirmTOTP", "000000") }, ShouldPanic)
+			code, _ := security.TOTPCode(secret, time.Now())
+			recoveryCodes = user.Call("ConfirmTOTP", code).([]string)
+			So(recoveryCodes, ShouldHaveLength, RecoveryCodesCount)
+			So(user.Get("TOTPEnabled"), ShouldBeTrue)
+		})
+		So(SecondFactorRequired(userID), ShouldBeTrue)
+	})
+	Convey("Verifying the second factor", t, func() {
+		Convey("Valid TOTP codes should be accepted only once", func() {
+			code, _ := security.TOTPCode(secret, time.Now().Add(security.TOTPPeriod))
+			So(VerifySecondFactor(userID, code), ShouldBeTrue)
+			So(VerifySecondFactor(userID, code), ShouldBeFalse)
+			code, _ = security.TOTPCode(secret, time.Now())
+			So(VerifySecondFactor(userID, code), ShouldBeFalse)
+		})
+		Convey("Wrong codes should be refused", func() {
+			So(VerifySecondFactor(userID, "abcdef"), ShouldBeFalse)
+		})
+		Convey("Recovery codes should be accepted only once", func() {
+			So(VerifySecondFactor(userID, recoveryCodes[0]), ShouldBeTrue)
+			So(VerifySecondFactor(userID, recoveryCodes[0]), ShouldBeFalse)
+			So(VerifySecondFactor(userID, recoveryCodes[1]), ShouldBeTrue)
+		})
+		Convey("Only the user itself or an admin can enable two-factor authentication", func() {
+			ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				other := env.Pool("Users").Call("Create", FieldMap{
+					"Name":  "Other TOTP User",
+					"Login": "othertotpuser",
+				}).(RecordCollection)
+				So(func() { other.Sudo(userID).Call("EnableTOTP") }, ShouldPanic)
+			})
+		})
+	})
+	Convey("Disabling two-factor authentication", t, func() {
+		ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			env.Pool("Users").withIds([]int64{userID}).Call("DisableTOTP")
+		})
+		So(SecondFactorRequired(userID), ShouldBeFalse)
+		So(VerifySecondFactor(userID, recoveryCodes[2]), ShouldBeFalse)
+	})
+}
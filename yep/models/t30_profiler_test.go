@@ -0,0 +1,59 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestProfiler(t *testing.T) {
+	Convey("Testing method calls profiler", t, func() {
+		var profiles []*Profile
+		SetProfileHandler(func(p *Profile) {
+			profiles = append(profiles, p)
+		})
+		Reset(func() {
+			viper.Set("Profiler.Enabled", false)
+			SetProfileHandler(nil)
+		})
+		Convey("Environments should not be profiled by default", func() {
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("User").Call("Create", FieldMap{"Name": "Not Profiled"})
+			})
+			So(profiles, ShouldBeEmpty)
+		})
+		Convey("Method calls and queries should be recorded when enabled", func() {
+			viper.Set("Profiler.Enabled", true)
+			SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("User").Call("Create", FieldMap{"Name": "Profiled"})
+			})
+			So(profiles, ShouldHaveLength, 1)
+			profile := profiles[0]
+			So(profile.UID, ShouldEqual, security.SuperUserID)
+			So(profile.Calls, ShouldHaveLength, 1)
+			create := profile.Calls[0]
+			So(create.Name(), ShouldEqual, "User.Create")
+			So(create.Depth, ShouldEqual, 0)
+			So(create.Duration, ShouldBeGreaterThan, 0)
+			var countQueries func(calls []*ProfiledCall) int
+			countQueries = func(calls []*ProfiledCall) int {
+				var res int
+				for _, call := range calls {
+					res += len(call.Queries) + countQueries(call.Calls)
+				}
+				return res
+			}
+			So(countQueries(profile.Calls), ShouldBeGreaterThan, 0)
+			So(profile.Tree(), ShouldContainSubstring, "User.Create [layer 0]")
+			var buf bytes.Buffer
+			So(profile.WriteFolded(&buf), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "User.Create")
+		})
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryStats(t *testing.T) {
+	Convey("Testing query shapes", t, func() {
+		So(queryShape("SELECT name FROM partner WHERE id IN (?, ?, ?)"), ShouldEqual, "SELECT name FROM partner WHERE id IN (?)")
+		So(queryShape("SELECT name FROM partner\n\tWHERE id = 12 AND name = 'it''s'"), ShouldEqual, "SELECT name FROM partner WHERE id = ? AND name = ?")
+		So(queryShape("SELECT t1.name FROM partner t1"), ShouldEqual, "SELECT t1.name FROM partner t1")
+	})
+	Convey("Testing query counters", t, func() {
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			So(env.QueryStats().Count, ShouldEqual, 0)
+			env.Pool("User").Call("Create", FieldMap{"Name": "Query Stats"})
+			stats := env.QueryStats()
+			So(stats.Count, ShouldBeGreaterThan, 0)
+			So(stats.Duration, ShouldBeGreaterThan, 0)
+			Convey("Repeated queries should be detected", func() {
+				var count int64
+				for i := 1; i <= 5; i++ {
+					env.Cr().Get(&count, "SELECT COUNT(*) FROM company WHERE id = ?", i)
+				}
+				repeated := env.QueryStats().Repeated(5)
+				So(repeated, ShouldHaveLength, 1)
+				So(repeated[0].Query, ShouldEqual, "SELECT COUNT(*) FROM company WHERE id = ?")
+				So(repeated[0].Count, ShouldEqual, 5)
+				So(repeated[0].Method, ShouldBeEmpty)
+			})
+			Convey("Queries should be attributed to the method that issued them", func() {
+				var found bool
+				for _, shape := range stats.Shapes {
+					if shape.Method == "User.Create" {
+						found = true
+					}
+				}
+				So(found, ShouldBeTrue)
+			})
+		})
+	})
+}
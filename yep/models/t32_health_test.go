@@ -0,0 +1,46 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealthChecks(t *testing.T) {
+	Convey("Testing health checks", t, func() {
+		Convey("Database should be reachable", func() {
+			So(CheckDBConnection(), ShouldBeNil)
+		})
+		Convey("Models should be bootstrapped", func() {
+			So(Registry.IsBootstrapped(), ShouldBeTrue)
+		})
+		Convey("Database schema should be compatible with the models", func() {
+			userCols := testAdapter.columns("user")
+			So(userCols["name"].DataType, ShouldEqual, "character varying")
+			So(userCols["is_staff"].DataType, ShouldEqual, "boolean")
+			So(userCols["size"].DataType, ShouldEqual, "double precision")
+			So(CheckDatabaseSchema(), ShouldBeNil)
+		})
+		Convey("Columns with a wrong type should be reported", func() {
+			dbExecuteNoTx(`ALTER TABLE "tag" ALTER COLUMN description TYPE text`)
+			Reset(func() {
+				dbExecuteNoTx(`ALTER TABLE "tag" ALTER COLUMN description TYPE varchar`)
+			})
+			err := CheckDatabaseSchema()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "column description of table tag has type text instead of character varying")
+		})
+		Convey("Missing columns should be reported", func() {
+			dbExecuteNoTx(`ALTER TABLE "tag" RENAME COLUMN description TO old_description`)
+			Reset(func() {
+				dbExecuteNoTx(`ALTER TABLE "tag" RENAME COLUMN old_description TO description`)
+			})
+			err := CheckDatabaseSchema()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "column description of table tag is missing")
+		})
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONSchemas(t *testing.T) {
+	Convey("Testing JSON schemas of models", t, func() {
+		schema := Registry.MustGet("User").JSONSchema()
+		So(schema.Type, ShouldEqual, "object")
+		So(schema.Properties, ShouldContainKey, "id")
+		So(schema.Properties["id"].ReadOnly, ShouldBeTrue)
+		So(schema.Properties["email"].Type, ShouldEqual, "string")
+		So(schema.Properties["email"].MaxLength, ShouldEqual, 100)
+		So(schema.Properties["email"].Description, ShouldEqual, "The user's email address")
+		So(schema.Properties["status_json"].Type, ShouldEqual, "integer")
+		So(schema.Properties["size"].Type, ShouldEqual, "number")
+		So(schema.Properties["is_staff"].Type, ShouldEqual, "boolean")
+		So(schema.Properties["profile_id"].Type, ShouldEqual, "integer")
+		So(schema.Properties["profile_id"].Relation, ShouldEqual, "Profile")
+		So(schema.Properties["posts_ids"].Type, ShouldEqual, "array")
+		So(schema.Properties["posts_ids"].Relation, ShouldEqual, "Post")
+		So(schema.Properties["decorated_name"].ReadOnly, ShouldBeTrue)
+		So(schema.Properties["age"].ReadOnly, ShouldBeTrue)
+		So(schema.Properties["email"].ReadOnly, ShouldBeFalse)
+		So(schema.Properties["p_money"].ReadOnly, ShouldBeTrue)
+		Convey("Selections should be enumerated unless they are computed", func() {
+			So(Registry.MustGet("Post").JSONSchema().Properties["status"].Enum, ShouldBeEmpty)
+		})
+	})
+	Convey("Testing JSON schemas of Go types", t, func() {
+		schema, ok := goTypeSchema(reflect.TypeOf([]string{}), false, make(map[reflect.Type]bool))
+		So(ok, ShouldBeTrue)
+		So(schema.Type, ShouldEqual, "array")
+		So(schema.Items.Type, ShouldEqual, "string")
+		schema, ok = goTypeSchema(reflect.TypeOf(FieldsGetArgs{}), false, make(map[reflect.Type]bool))
+		So(ok, ShouldBeTrue)
+		So(schema.Properties, ShouldContainKey, "allfields")
+		_, ok = goTypeSchema(reflect.TypeOf(RecordCollection{}), false, make(map[reflect.Type]bool))
+		So(ok, ShouldBeFalse)
+		schema, ok = goTypeSchema(reflect.TypeOf(RecordCollection{}), true, make(map[reflect.Type]bool))
+		So(ok, ShouldBeTrue)
+		So(schema.Items.Type, ShouldEqual, "integer")
+		_, ok = goTypeSchema(reflect.TypeOf(new(Condition)), false, make(map[reflect.Type]bool))
+		So(ok, ShouldBeFalse)
+	})
+	Convey("Testing exposed methods", t, func() {
+		userModel := Registry.MustGet("User")
+		So(func() { userModel.Methods().MustGet("computeAge").Expose() }, ShouldPanic)
+		decorateEmail := userModel.Methods().MustGet("DecorateEmail").Expose()
+		So(userModel.Methods().Exposed(), ShouldContain, decorateEmail)
+		So(decorateEmail.ArgsSchema().Items.Type, ShouldEqual, "string")
+		So(*decorateEmail.ArgsSchema().MinItems, ShouldEqual, 1)
+		So(decorateEmail.ResultSchema().Type, ShouldEqual, "string")
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").Call("Create", FieldMap{"Name": "Exposed Methods"}).(RecordSet).Collection()
+			res, err := decorateEmail.CallJSON(users, []byte(`["jsmith@example.com"]`))
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, "[<jsmith@example.com>]")
+			_, err = decorateEmail.CallJSON(users, []byte(`[]`))
+			So(err, ShouldNotBeNil)
+			_, err = decorateEmail.CallJSON(users, []byte(`[12]`))
+			So(err, ShouldNotBeNil)
+			_, err = userModel.Methods().MustGet("UpdateCity").CallJSON(users, []byte(`["Paris"]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDomains(t *testing.T) {
+	Convey("Testing Odoo domains conversion", t, func() {
+		userModel := Registry.MustGet("User")
+		Convey("Malformed domains should be rejected", func() {
+			_, err := DomainToCondition(userModel, security.SuperUserID, []interface{}{"|", []interface{}{"name", "=", "John"}})
+			So(err, ShouldNotBeNil)
+			_, err = DomainToCondition(userModel, security.SuperUserID, []interface{}{[]interface{}{"name", "="}})
+			So(err, ShouldNotBeNil)
+			_, err = DomainToCondition(userModel, security.SuperUserID, []interface{}{[]interface{}{"name", "~", "John"}})
+			So(err, ShouldNotBeNil)
+			_, err = DomainToCondition(userModel, security.SuperUserID, []interface{}{[]interface{}{"unknown_field", "=", "John"}})
+			So(err, ShouldNotBeNil)
+			_, err = DomainToCondition(userModel, security.SuperUserID, []interface{}{"^", []interface{}{"name", "=", "John"}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Empty domains should give a nil condition", func() {
+			cond, err := DomainToCondition(userModel, security.SuperUserID, []interface{}{})
+			So(err, ShouldBeNil)
+			So(cond, ShouldBeNil)
+		})
+		Convey("Domain strings should be parsed", func() {
+			cond, err := ParseDomain(userModel, security.SuperUserID, `['|', ('name', '=', 'John'), ("profile_id.age", ">", 20), ('is_staff', '=', True)]`)
+			So(err, ShouldBeNil)
+			So(cond, ShouldNotBeNil)
+			cond, err = ParseDomain(userModel, security.SuperUserID, `["&", ["email", "ilike", "example"], ["profile_id", "!=", false]]`)
+			So(err, ShouldBeNil)
+			So(cond, ShouldNotBeNil)
+			cond, err = ParseDomain(userModel, security.SuperUserID, "  ")
+			So(err, ShouldBeNil)
+			So(cond, ShouldBeNil)
+			_, err = ParseDomain(userModel, security.SuperUserID, `[('name', '=', uid)]`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseDomain(userModel, security.SuperUserID, `[('name', '=', 'John')`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseDomain(userModel, security.SuperUserID, `[('name', '=', 'John')] x`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseDomain(userModel, security.SuperUserID, `('name', '=', 'John')`)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Domains should not filter on fields the user cannot read", func() {
+			var uid int64
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				users := env.Pool("Users")
+				uid = users.Search(users.Model().Field("Login").Equals("authuser")).Ids()[0]
+			}), ShouldBeNil)
+			usersModel := Registry.MustGet("Users")
+			So(Registry.MustGet("APIKey").CanAccessFieldPath(uid, "User.Login", security.Read), ShouldBeTrue)
+			So(Registry.MustGet("APIKey").CanAccessFieldPath(uid, "User.TOTPSecret", security.Read), ShouldBeFalse)
+			So(Registry.MustGet("APIKey").CanAccessFieldPath(security.SuperUserID, "User.TOTPSecret", security.Read), ShouldBeTrue)
+			_, err := DomainToCondition(usersModel, uid, []interface{}{[]interface{}{"password", "like", "$2a$%"}})
+			So(err, ShouldNotBeNil)
+			_, err = ParseDomain(Registry.MustGet("APIKey"), uid, `[('user_id.password', 'like', '$2a$%')]`)
+			So(err, ShouldNotBeNil)
+			_, err = DomainToCondition(usersModel, uid, []interface{}{[]interface{}{"login", "=", "authuser"}})
+			So(err, ShouldBeNil)
+			_, err = DomainToCondition(usersModel, security.SuperUserID, []interface{}{[]interface{}{"password", "like", "$2a$%"}})
+			So(err, ShouldBeNil)
+		})
+		SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			search := func(domain ...interface{}) int {
+				cond, err := DomainToCondition(userModel, security.SuperUserID, domain)
+				So(err, ShouldBeNil)
+				return users.Search(cond).SearchCount()
+			}
+			Convey("Domains should match the same records as conditions", func() {
+				expected := users.Search(userModel.Field("Name").Equals("John Smith").
+					Or().Field("Email").ILike("example")).SearchCount()
+				So(search("|", []interface{}{"name", "=", "John Smith"}, []interface{}{"email", "ilike", "example"}), ShouldEqual, expected)
+				expected = users.Search(userModel.Field("Name").NotEquals("John Smith").
+					And().Field("Profile.Age").Greater(0)).SearchCount()
+				So(search("!", []interface{}{"name", "=", "John Smith"}, []interface{}{"profile_id.age", ">", 0}), ShouldEqual, expected)
+			})
+			Convey("Parsed domains should match the same records as decoded domains", func() {
+				cond, err := ParseDomain(userModel, security.SuperUserID, `[('name', '=', 'John Smith'), ('email', 'not ilike', 'example')]`)
+				So(err, ShouldBeNil)
+				So(users.Search(cond).SearchCount(), ShouldEqual, search(
+					[]interface{}{"name", "=", "John Smith"}, []interface{}{"email", "not ilike", "example"}))
+			})
+			Convey("False values should match NULL values", func() {
+				expected := users.Search(userModel.Field("Profile").Equals(nil)).SearchCount()
+				So(search([]interface{}{"profile_id", "=", false}), ShouldEqual, expected)
+			})
+			Convey("Empty lists should match no or all records", func() {
+				So(search([]interface{}{"id", "in", []interface{}{}}), ShouldEqual, 0)
+				So(search([]interface{}{"id", "not in", []interface{}{}}), ShouldEqual, users.FetchAll().SearchCount())
+			})
+		})
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBus(t *testing.T) {
+	Convey("Testing the notification bus", t, func() {
+		last := LastBusNotificationID()
+		Convey("Published messages should be delivered after commit", func() {
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Publish("test:bus", map[string]interface{}{"text": "Hello"})
+				So(BusNotifications([]string{"test:bus"}, last), ShouldBeEmpty)
+			}), ShouldBeNil)
+			notifs := BusNotifications([]string{"test:bus", "test:other"}, last)
+			So(notifs, ShouldHaveLength, 1)
+			So(notifs[0].Channel, ShouldEqual, "test:bus")
+			So(string(notifs[0].Message), ShouldEqual, `{"text":"Hello"}`)
+			So(LastBusNotificationID(), ShouldEqual, notifs[0].ID)
+			So(BusNotifications([]string{"test:other"}, last), ShouldBeEmpty)
+			So(BusNotifications([]string{"test:bus"}, notifs[0].ID), ShouldBeEmpty)
+		})
+		Convey("Messages should be discarded on rollback", func() {
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Publish("test:bus", "Rolled back")
+				log.Panic("Rolling back")
+			}), ShouldNotBeNil)
+			So(BusNotifications([]string{"test:bus"}, last), ShouldBeEmpty)
+		})
+		Convey("Messages of interleaved transactions should not be missed", func() {
+			published := make(chan struct{})
+			release := make(chan struct{})
+			firstDone := make(chan error, 1)
+			secondDone := make(chan error, 1)
+			go func() {
+				firstDone <- ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+					env.Publish("test:bus", "First")
+					close(published)
+					<-release
+				})
+			}()
+			<-published
+			go func() {
+				secondDone <- ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+					env.Publish("test:bus", "Second")
+				})
+			}()
+			var secondCommitted bool
+			select {
+			case <-secondDone:
+				secondCommitted = true
+			case <-time.After(100 * time.Millisecond):
+			}
+			So(secondCommitted, ShouldBeFalse)
+			close(release)
+			So(<-firstDone, ShouldBeNil)
+			notifs := BusNotifications([]string{"test:bus"}, last)
+			So(notifs, ShouldNotBeEmpty)
+			So(string(notifs[0].Message), ShouldEqual, `"First"`)
+			So(<-secondDone, ShouldBeNil)
+			notifs = BusNotifications([]string{"test:bus"}, notifs[0].ID)
+			So(notifs, ShouldHaveLength, 1)
+			So(string(notifs[0].Message), ShouldEqual, `"Second"`)
+		})
+		Convey("Waiting should return published messages or time out", func() {
+			So(WaitBusNotifications(context.Background(), []string{"test:bus"}, last, 10*time.Millisecond), ShouldBeNil)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(WaitBusNotifications(ctx, []string{"test:bus"}, last, time.Minute), ShouldBeNil)
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Publish("test:bus", "Hello")
+			}), ShouldBeNil)
+			notifs := WaitBusNotifications(context.Background(), []string{"test:bus"}, last, time.Minute)
+			So(notifs, ShouldHaveLength, 1)
+			So(string(notifs[0].Message), ShouldEqual, `"Hello"`)
+		})
+		Convey("Subscriptions should be authorized per channel", func() {
+			So(CanSubscribe(2, UserChannel(2)), ShouldBeTrue)
+			So(CanSubscribe(2, UserChannel(3)), ShouldBeFalse)
+			So(CanSubscribe(2, "unknown:2"), ShouldBeFalse)
+			So(CanSubscribe(2, "user"), ShouldBeFalse)
+			var userID int64
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				userID = env.Pool("User").Search(Registry.MustGet("User").Field("ID").Greater(0)).Ids()[0]
+			}), ShouldBeNil)
+			So(CanSubscribe(security.SuperUserID, RecordChannel("User", userID)), ShouldBeTrue)
+			So(CanSubscribe(security.SuperUserID, RecordChannel("User", -1)), ShouldBeFalse)
+			So(CanSubscribe(security.SuperUserID, RecordChannel("Unknown", userID)), ShouldBeFalse)
+			So(CanSubscribe(security.SuperUserID, "record:User:abc"), ShouldBeFalse)
+		})
+		Reset(func() {
+			dbExecuteNoTx(`DELETE FROM bus_message WHERE channel = ?`, "test:bus")
+		})
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDBLimiter(t *testing.T) {
+	Convey("Testing database rate limiter", t, func() {
+		limiter := NewDBLimiter("test", 0.01, 3)
+		Reset(func() {
+			dbExecuteNoTx(`DELETE FROM rate_limit_bucket WHERE key LIKE ?`, "test:%")
+		})
+		Convey("Bursts should be allowed up to the burst size", func() {
+			for i := 0; i < 3; i++ {
+				ok, _ := limiter.Take("a")
+				So(ok, ShouldBeTrue)
+			}
+			ok, wait := limiter.Take("a")
+			So(ok, ShouldBeFalse)
+			So(wait, ShouldBeGreaterThan, 0)
+			ok, _ = limiter.Available("a")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Keys should have their own bucket", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Take("a")
+			}
+			ok, _ := limiter.Available("b")
+			So(ok, ShouldBeTrue)
+			ok, _ = limiter.Take("b")
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Buckets should be shared by limiters with the same name", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Take("a")
+			}
+			ok, _ := NewDBLimiter("test", 0.01, 3).Take("a")
+			So(ok, ShouldBeFalse)
+			ok, _ = NewDBLimiter("test2", 0.01, 3).Available("a")
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Concurrent takes should create the bucket once", func() {
+			results := make(chan bool, 3)
+			for i := 0; i < 3; i++ {
+				go func() {
+					defer func() {
+						if r := recover(); r != nil {
+							results <- false
+						}
+					}()
+					ok, _ := limiter.Take("concurrent")
+					results <- ok
+				}()
+			}
+			for i := 0; i < 3; i++ {
+				So(<-results, ShouldBeTrue)
+			}
+			ok, _ := limiter.Take("concurrent")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Available should not take tokens", func() {
+			for i := 0; i < 5; i++ {
+				ok, _ := limiter.Available("a")
+				So(ok, ShouldBeTrue)
+			}
+			ok, _ := limiter.Take("a")
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
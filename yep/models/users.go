@@ -0,0 +1,383 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/models/security"
+	"github.com/npiganeau/yep/yep/models/types"
+)
+
+// declareUsersModel creates the Users model which holds
+// the users of the application.
+func declareUsersModel() {
+	users := NewModel("Users")
+	users.AddCharField("Name", StringFieldParams{Required: true})
+	users.AddCharField("Login", StringFieldParams{Required: true, Unique: true})
+	users.AddMany2OneField("Company", ForeignKeyFieldParams{RelationModel: "Company",
+		Help: "The company this user is currently working for"})
+	users.AddMany2ManyField("Companies", Many2ManyFieldParams{RelationModel: "Company",
+		String: "Allowed Companies", Help: "The companies this user is allowed to access"})
+	users.AddMany2ManyField("Groups", Many2ManyFieldParams{RelationModel: "Group",
+		Help: "The security groups this user is a member of"})
+	users.AddCharField("Password", StringFieldParams{NoCopy: true,
+		Help: "The salted hash of the password of this user"}).
+		RevokeAccess(security.GroupEveryone, security.Read|security.Write).
+		GrantAccess(security.GroupAdmin, security.Read|security.Write)
+	users.AddIntegerField("LoginFailures", SimpleFieldParams{NoCopy: true,
+		Help: "The number of consecutive failed login attempts of this user"})
+	users.AddDateTimeField("LockedUntil", SimpleFieldParams{NoCopy: true,
+		Help: "The user cannot log in until this date after too many failed login attempts"})
+	users.AddCharField("LDAPDN", StringFieldParams{NoCopy: true, Index: true, String: "LDAP DN",
+		Help: "The DN of the LDAP entry of this user if it authenticates with LDAP"}).
+		RevokeAccess(security.GroupEveryone, security.Write).
+		GrantAccess(security.GroupAdmin, security.Write)
+	users.AddCharField("OIDCIssuer", StringFieldParams{NoCopy: true, String: "OIDC Issuer",
+		Help: "The OpenID Connect provider of this user if it has been created by OIDC login"}).
+		RevokeAccess(security.GroupEveryone, security.Write).
+		GrantAccess(security.GroupAdmin, security.Write)
+	users.AddCharField("OIDCSubject", StringFieldParams{NoCopy: true, Index: true, String: "OIDC Subject",
+		Help: "The identifier of this user at its OpenID Connect provider"}).
+		RevokeAccess(security.GroupEveryone, security.Write).
+		GrantAccess(security.GroupAdmin, security.Write)
+
+	users.AddMethod("ChangePassword",
+		`ChangePassword sets the password of this user to newPassword if oldPassword
+		is its current password. Only the user itself or an administrator can change
+		the password of a user. It panics if the password could not be changed.`,
+		func(rc RecordCollection, oldPassword, newPassword string) {
+			rc.EnsureOne()
+			if rc.Env().Uid() != rc.Ids()[0] && !security.Registry.HasMembership(rc.Env().Uid(), security.GroupAdmin) {
+				log.Panic("Only the user itself can change its password", "uid", rc.Env().Uid(), "user", rc.Ids()[0])
+			}
+			if ok, _ := security.CheckPassword(rc.Sudo().Get("Password").(string), oldPassword); !ok {
+				log.Panic("Wrong password", "user", rc.Ids()[0])
+			}
+			rc.Sudo().setPassword(newPassword)
+		}).AllowGroup(security.GroupEveryone).Expose()
+
+	users.AddMethod("ResetPassword",
+		`ResetPassword sets the password of the users of this RecordSet to newPassword
+		and unlocks them if they were locked out.`,
+		func(rc RecordCollection, newPassword string) {
+			rc.setPassword(newPassword)
+		})
+}
+
+// setPassword stores a hash of the given password for the users of this
+// RecordCollection and resets their failed login attempts.
+func (rc RecordCollection) setPassword(password string) {
+	rc.Call("Write", FieldMap{
+		"Password":      password,
+		"LoginFailures": 0,
+		"LockedUntil":   types.DateTime{},
+	})
+}
+
+// hashPassword replaces the password of the given fMap to be written to
+// Users records by its salted hash, so that passwords given to Create or
+// Write are never stored in clear text. Empty passwords are kept empty.
+func (rc RecordCollection) hashPassword(fMap *FieldMap) {
+	if rc.model.name != "Users" {
+		return
+	}
+	for _, key := range []string{"Password", rc.model.fields.MustGet("Password").json} {
+		password, ok := (*fMap)[key].(string)
+		if !ok || password == "" {
+			continue
+		}
+		hash, err := security.HashPassword(password)
+		if err != nil {
+			log.Panic("Unable to hash password", "error", err)
+		}
+		(*fMap)[key] = hash
+	}
+}
+
+// checkSelfOrAdmin panics if the current user is not the user of
+// this RecordCollection or an administrator.
+func (rc RecordCollection) checkSelfOrAdmin() {
+	rc.EnsureOne()
+	if rc.Env().Uid() != rc.Ids()[0] && !security.Registry.HasMembership(rc.Env().Uid(), security.GroupAdmin) {
+		log.Panic("Only the user itself or an administrator can do this", "uid", rc.Env().Uid(), "user", rc.Ids()[0])
+	}
+}
+
+// declareGroupModel creates the Group model which holds the
+// security groups of the application in the database.
+func declareGroupModel() {
+	group := NewModel("Group")
+	group.AddCharField("GroupID", StringFieldParams{Required: true, Unique: true, String: "Group ID",
+		Help: "The ID of the group in the security registry"})
+	group.AddCharField("Name", StringFieldParams{Required: true})
+	group.AddMany2ManyField("Inherits", Many2ManyFieldParams{RelationModel: "Group",
+		M2MLinkModelName: "GroupInheritRel", M2MOurField: "Group", M2MTheirField: "InheritedGroup",
+		Help: "Members of this group are also members of the inherited groups"})
+}
+
+// dbSelectFunc is the signature of functions that query
+// multiple rows, such as dbSelectNoTx or Cursor.Select.
+type dbSelectFunc func(dest interface{}, query string, args ...interface{})
+
+var (
+	// securitySyncMutex serializes the loading of the
+	// security registry from the database.
+	securitySyncMutex sync.Mutex
+	// dbGroups are the IDs of the groups that have been registered
+	// in security.Registry from a Group record and not from code.
+	dbGroups = make(map[string]bool)
+	// codeInherits are the inherited groups declared in code for
+	// each group that has not been registered from a Group record.
+	codeInherits = make(map[string][]*security.Group)
+	// dbMemberships are the groups of each user that have been added
+	// to security.Registry from a Users record and not from code.
+	dbMemberships = make(map[int64][]*security.Group)
+)
+
+// loadSecurityRegistry loads the groups, their inheritance and the
+// memberships of users stored in the database into security.Registry,
+// as well as the access rights of the ModelAccess records.
+// It does nothing if the database tables do not exist yet.
+func loadSecurityRegistry() {
+	if db == nil {
+		return
+	}
+	dbTables := adapters[db.DriverName()].tables()
+	groupModel := Registry.registryByName["Group"]
+	usersModel := Registry.registryByName["Users"]
+	for _, table := range []string{
+		groupModel.tableName,
+		groupModel.fields.registryByName["Inherits"].m2mRelModel.tableName,
+		usersModel.fields.registryByName["Groups"].m2mRelModel.tableName,
+	} {
+		if !dbTables[table] {
+			return
+		}
+	}
+	loadSecurityGroups(dbSelectNoTx)
+	loadSecurityMemberships(dbSelectNoTx)
+	if dbTables[Registry.registryByName["ModelAccess"].tableName] {
+		loadModelAccessRights(dbSelectNoTx)
+	}
+}
+
+// loadSecurityGroups synchronizes the groups of security.Registry and their
+// inheritance with the Group records read with the given selectFunc.
+//
+// Groups that have no record are registered, and groups that have been
+// registered from a record that no longer exists are unregistered. Groups
+// declared in code are never unregistered.
+func loadSecurityGroups(selectFunc dbSelectFunc) {
+	securitySyncMutex.Lock()
+	defer securitySyncMutex.Unlock()
+	groupModel := Registry.registryByName["Group"]
+	inheritsField := groupModel.fields.registryByName["Inherits"]
+	var groupsData []struct {
+		ID      int64  `db:"id"`
+		GroupID string `db:"group_id"`
+		Name    string `db:"name"`
+	}
+	selectFunc(&groupsData, fmt.Sprintf(`SELECT id, group_id, name FROM %s`,
+		adapters[db.DriverName()].quoteTableName(groupModel.tableName)))
+	var inheritsData []struct {
+		Group     int64 `db:"ours"`
+		Inherited int64 `db:"theirs"`
+	}
+	selectFunc(&inheritsData, fmt.Sprintf(`SELECT %s AS ours, %s AS theirs FROM %s`,
+		inheritsField.m2mOurField.json, inheritsField.m2mTheirField.json, inheritsField.m2mRelModel.tableName))
+
+	groups := make(map[int64]*security.Group, len(groupsData))
+	inDB := make(map[string]bool, len(groupsData))
+	for _, data := range groupsData {
+		grp := security.Registry.GetGroup(data.GroupID)
+		if grp == nil {
+			grp = security.Registry.NewGroup(data.GroupID, data.Name)
+			dbGroups[data.GroupID] = true
+		}
+		if _, ok := codeInherits[grp.ID]; !ok && !dbGroups[grp.ID] {
+			codeInherits[grp.ID] = grp.Inherits
+		}
+		grp.Name = data.Name
+		groups[data.ID] = grp
+		inDB[data.GroupID] = true
+	}
+	for grpID := range dbGroups {
+		if !inDB[grpID] {
+			security.Registry.UnregisterGroup(security.Registry.GetGroup(grpID))
+			delete(dbGroups, grpID)
+		}
+	}
+	inherits := make(map[*security.Group][]*security.Group)
+	for _, grp := range groups {
+		inherits[grp] = append(inherits[grp], codeInherits[grp.ID]...)
+	}
+	for _, data := range inheritsData {
+		if containsGroup(inherits[groups[data.Group]], groups[data.Inherited]) {
+			continue
+		}
+		inherits[groups[data.Group]] = append(inherits[groups[data.Group]], groups[data.Inherited])
+	}
+	for _, grp := range groups {
+		security.Registry.SetInherits(grp, inherits[grp]...)
+	}
+}
+
+// containsGroup returns true if the given group is in the given slice
+func containsGroup(groups []*security.Group, group *security.Group) bool {
+	for _, grp := range groups {
+		if grp == group {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSecurityMemberships sets the memberships of the users with the given uids
+// in security.Registry from the Groups field of their Users record read with the
+// given selectFunc. If no uid is given, the memberships stored for all users are
+// loaded.
+//
+// Memberships that have been added from a record that no longer exists are
+// removed. Memberships declared in code are never removed.
+func loadSecurityMemberships(selectFunc dbSelectFunc, uids ...int64) {
+	securitySyncMutex.Lock()
+	defer securitySyncMutex.Unlock()
+	groupModel := Registry.registryByName["Group"]
+	groupsField := Registry.registryByName["Users"].fields.registryByName["Groups"]
+	query := fmt.Sprintf(`SELECT rel.%s AS uid, grp.group_id AS group_id FROM %s rel JOIN %s grp ON grp.id = rel.%s`,
+		groupsField.m2mOurField.json, groupsField.m2mRelModel.tableName,
+		adapters[db.DriverName()].quoteTableName(groupModel.tableName), groupsField.m2mTheirField.json)
+	var args []interface{}
+	if len(uids) > 0 {
+		query += fmt.Sprintf(` WHERE rel.%s IN (?)`, groupsField.m2mOurField.json)
+		args = append(args, uids)
+	}
+	var membershipsData []struct {
+		UID     int64  `db:"uid"`
+		GroupID string `db:"group_id"`
+	}
+	selectFunc(&membershipsData, query, args...)
+	inDB := make(map[int64][]*security.Group)
+	for _, uid := range uids {
+		inDB[uid] = nil
+	}
+	if len(uids) == 0 {
+		for uid := range dbMemberships {
+			inDB[uid] = nil
+		}
+	}
+	for _, data := range membershipsData {
+		if grp := security.Registry.GetGroup(data.GroupID); grp != nil {
+			inDB[data.UID] = append(inDB[data.UID], grp)
+		}
+	}
+	for uid, groups := range inDB {
+		for _, grp := range dbMemberships[uid] {
+			if !containsGroup(groups, grp) {
+				security.Registry.RemoveMembership(uid, grp)
+			}
+		}
+		var added []*security.Group
+		for _, grp := range groups {
+			if ii, ok := security.Registry.UserGroups(uid)[grp]; ok && ii == security.NativeGroup && !containsGroup(dbMemberships[uid], grp) {
+				// This membership has been declared in code
+				continue
+			}
+			security.Registry.AddMembership(uid, grp)
+			added = append(added, grp)
+		}
+		if len(added) == 0 {
+			delete(dbMemberships, uid)
+			continue
+		}
+		dbMemberships[uid] = added
+	}
+}
+
+// syncSecurityGroups creates a Group record for each group of security.Registry
+// that does not have one yet and adds the inheritance declared in code to the
+// Group records. Group records without explicit external ID get their group ID
+// as external ID.
+func syncSecurityGroups() {
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		groupsPool := env.Pool("Group")
+		records := make(map[*security.Group]RecordCollection)
+		for _, grp := range security.Registry.AllGroups() {
+			rec := groupsPool.Search(groupsPool.Model().Field("GroupID").Equals(grp.ID))
+			switch {
+			case rec.IsEmpty():
+				rec = groupsPool.Call("Create", FieldMap{"GroupID": grp.ID, "Name": grp.Name, "YEPExternalID": grp.ID}).(RecordCollection)
+			case strings.HasPrefix(rec.Get("YEPExternalID").(string), "__yep_external_id__"):
+				// Use the group ID as external ID so that the group can be referenced in data files
+				rec.Set("YEPExternalID", grp.ID)
+			}
+			records[grp] = rec
+		}
+		for grp, rec := range records {
+			inheritIds := rec.Get("Inherits").(RecordCollection).Ids()
+			var modified bool
+			for _, iGrp := range grp.Inherits {
+				if iRec, ok := records[iGrp]; ok && !containsID(inheritIds, iRec.Ids()[0]) {
+					inheritIds = append(inheritIds, iRec.Ids()[0])
+					modified = true
+				}
+			}
+			if modified {
+				rec.Set("Inherits", inheritIds)
+			}
+		}
+	})
+	if err != nil {
+		log.Panic("Unable to synchronize security groups with the database", "error", err)
+	}
+}
+
+// syncSecurityRegistry records in the cursor that security.Registry must
+// be updated after the records of this RecordCollection have been written
+// with the given fMap. fMap must be nil if the records have been deleted.
+//
+// security.Registry is only updated once the transaction is committed, so
+// that other transactions never see uncommitted groups and access rights.
+func (rc RecordCollection) syncSecurityRegistry(fMap FieldMap) {
+	switch rc.model.name {
+	case "Group":
+		rc.env.cr.securityGroups = true
+	case "ModelAccess":
+		rc.env.cr.modelAccess = true
+	case "Users":
+		if fMap != nil {
+			_, inName := fMap["Groups"]
+			_, inJSON := fMap[rc.model.fields.MustGet("Groups").json]
+			if !inName && !inJSON {
+				return
+			}
+		}
+		rc.env.cr.securityUIDs = append(rc.env.cr.securityUIDs, rc.ids...)
+	}
+}
+
+// updateSecurityRegistry loads from the database the parts of
+// security.Registry that have been modified in the transaction of
+// the given cursor. It must be called after the transaction has
+// been committed.
+func updateSecurityRegistry(cr *Cursor) {
+	if cr.securityGroups {
+		loadSecurityGroups(dbSelectNoTx)
+	}
+	if cr.securityGroups || len(cr.securityUIDs) > 0 {
+		// Memberships of deleted groups are removed from the
+		// database without writing the Users records.
+		var uids []int64
+		if !cr.securityGroups {
+			uids = cr.securityUIDs
+		}
+		loadSecurityMemberships(dbSelectNoTx, uids...)
+	}
+	if cr.securityGroups || cr.modelAccess {
+		loadModelAccessRights(dbSelectNoTx)
+	}
+}
@@ -364,3 +364,37 @@ func appendPredicateToSerial(res []interface{}, predicate predicate) []interface
 	}
 	return res
 }
+
+// containsID returns true if the given id is in the ids slice
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// contextIDs converts the given context value into a slice of ids.
+// value can be a slice of int64 or a slice of numbers as decoded
+// from JSON. Non numeric values are ignored.
+func contextIDs(value interface{}) []int64 {
+	switch val := value.(type) {
+	case []int64:
+		return val
+	case []interface{}:
+		var res []int64
+		for _, v := range val {
+			switch id := v.(type) {
+			case int64:
+				res = append(res, id)
+			case int:
+				res = append(res, int64(id))
+			case float64:
+				res = append(res, int64(id))
+			}
+		}
+		return res
+	}
+	return nil
+}
@@ -72,6 +72,32 @@ func (c *Context) Session() sessions.Session {
 	return sessions.Default(c.Context)
 }
 
+// UID returns the id of the user authenticated for this request. This is the
+// uid set in the context by an authentication middleware if any, or the uid
+// stored in the session otherwise. It returns 0 if the request is not
+// authenticated or if the second factor of the session's user has not been
+// verified yet.
+func (c *Context) UID() int64 {
+	if uid, ok := c.Get("uid"); ok {
+		return uid.(int64)
+	}
+	if _, ok := c.Get(sessions.DefaultKey); !ok || c.SecondFactorPending() {
+		return 0
+	}
+	uid, _ := c.Session().Get("uid").(int64)
+	return uid
+}
+
+// SecondFactorPending returns true if the user of the session has logged
+// in with its password but has not given its second factor yet.
+func (c *Context) SecondFactorPending() bool {
+	if _, ok := c.Get(sessions.DefaultKey); !ok {
+		return false
+	}
+	pending, _ := c.Session().Get("second_factor_pending").(bool)
+	return pending
+}
+
 // Super calls the next middleware / handler layer
 // It is an alias for Next
 func (c *Context) Super() {
@@ -82,9 +108,9 @@ func (c *Context) Super() {
 func (c *Context) HTTPGet(uri string) (*http.Response, error) {
 	url := tools.AbsolutizeURL(c.Request, uri)
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
-	sessionCookie, _ := c.Cookie("yep-session")
+	sessionCookie, _ := c.Cookie(sessionCookieName)
 	req.AddCookie(&http.Cookie{
-		Name:  "yep-session",
+		Name:  sessionCookieName,
 		Value: sessionCookie,
 	})
 	client := http.Client{}
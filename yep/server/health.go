@@ -0,0 +1,140 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// A HealthCheck returns an error if the application
+// is not ready to serve requests.
+type HealthCheck func() error
+
+// A CheckResult is the result of a HealthCheck in the readiness report
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// A HealthReport is the JSON response of the health and readiness endpoints
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// schemaChecked is true once the database schema has been found compatible
+// with the models. The schema is not checked again afterwards since it is
+// only modified by SyncDatabase which is not run while the server is up.
+var schemaChecked struct {
+	sync.Mutex
+	ok bool
+}
+
+// checkModelsBootstrapped returns an error if the models have not been bootstrapped
+func checkModelsBootstrapped() error {
+	if !models.Registry.IsBootstrapped() {
+		return errors.New("models are not bootstrapped")
+	}
+	return nil
+}
+
+// checkDatabaseSchema returns an error if the database schema is not
+// compatible with the models.
+func checkDatabaseSchema() error {
+	if err := checkModelsBootstrapped(); err != nil {
+		return err
+	}
+	schemaChecked.Lock()
+	defer schemaChecked.Unlock()
+	if schemaChecked.ok {
+		return nil
+	}
+	if err := models.CheckDatabaseSchema(); err != nil {
+		return err
+	}
+	schemaChecked.ok = true
+	return nil
+}
+
+// readinessChecks returns the core readiness checks and those of
+// all registered modules. Checks of modules are prefixed by the
+// name of their module.
+func readinessChecks() map[string]HealthCheck {
+	res := map[string]HealthCheck{
+		"database": models.CheckDBConnection,
+		"models":   checkModelsBootstrapped,
+		"schema":   checkDatabaseSchema,
+	}
+	for _, mod := range Modules {
+		for name, check := range mod.ReadinessChecks {
+			res[fmt.Sprintf("%s.%s", mod.Name, name)] = check
+		}
+	}
+	return res
+}
+
+// runHealthCheck runs the given check and returns its result.
+// A panic in the check is reported as an error.
+func runHealthCheck(check HealthCheck) (res CheckResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = CheckResult{Status: statusError, Error: fmt.Sprintf("%v", r)}
+		}
+	}()
+	if err := check(); err != nil {
+		return CheckResult{Status: statusError, Error: err.Error()}
+	}
+	return CheckResult{Status: statusOK}
+}
+
+// Healthz responds with a 200 status as long as the server process is alive
+func Healthz(c *Context) {
+	c.JSON(http.StatusOK, HealthReport{Status: statusOK})
+}
+
+// Readyz runs all the readiness checks and responds with a 200 status if
+// they all succeed or with a 503 status otherwise, so that load balancers
+// only send requests to servers that are able to process them.
+func Readyz(c *Context) {
+	report := HealthReport{
+		Status: statusOK,
+		Checks: make(map[string]CheckResult),
+	}
+	checks := readinessChecks()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := runHealthCheck(checks[name])
+		if res.Status != statusOK {
+			report.Status = statusError
+		}
+		report.Checks[name] = res
+	}
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// registerHealthRoutes adds the health and readiness routes to the given server
+func registerHealthRoutes(srv *Server) {
+	grp := srv.Group("/")
+	grp.GET("/healthz", Healthz)
+	grp.GET("/readyz", Readyz)
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/spf13/viper"
+)
+
+// newHTTPServer returns an http.Server for this Server configured
+// with the Server.Address, Server.ReadTimeout and Server.WriteTimeout
+// configuration keys.
+func (s *Server) newHTTPServer() *http.Server {
+	viper.SetDefault("Server.Address", ":8080")
+	return &http.Server{
+		Addr:         viper.GetString("Server.Address"),
+		Handler:      s.Engine,
+		ReadTimeout:  viper.GetDuration("Server.ReadTimeout"),
+		WriteTimeout: viper.GetDuration("Server.WriteTimeout"),
+	}
+}
+
+// ListenAndServe starts the HTTP server and blocks until the process
+// receives a SIGINT or SIGTERM signal. The server listens on Server.Address
+// and serves HTTPS if Server.CertFile and Server.KeyFile are set.
+//
+// When a signal is received, the server stops accepting connections, waits
+// for the in-flight requests and for the running environments of the models
+// to terminate, then closes the database connection. It waits at most
+// Server.ShutdownTimeout (30s by default) for requests and environments.
+func (s *Server) ListenAndServe() {
+	viper.SetDefault("Server.ShutdownTimeout", 30*time.Second)
+	httpSrv := s.newHTTPServer()
+	certFile := viper.GetString("Server.CertFile")
+	keyFile := viper.GetString("Server.KeyFile")
+	errs := make(chan error, 1)
+	go func() {
+		if certFile != "" || keyFile != "" {
+			errs <- httpSrv.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		errs <- httpSrv.ListenAndServe()
+	}()
+	log.Info("Listening for HTTP requests", "address", httpSrv.Addr, "tls", certFile != "" || keyFile != "")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case err := <-errs:
+		log.Panic("HTTP server stopped unexpectedly", "error", err)
+	case sig := <-signals:
+		log.Info("Shutting down server", "signal", sig)
+	}
+	shutdown(httpSrv, viper.GetDuration("Server.ShutdownTimeout"))
+}
+
+// shutdown gracefully stops the given http server, waiting at most timeout
+// for the in-flight requests and the running environments of the models,
+// and then closes the database connection.
+func shutdown(httpSrv *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpSrv.Shutdown(ctx); err != nil {
+		log.Warn("Unable to wait for in-flight requests", "error", err)
+	}
+	if err := models.WaitForEnvironments(ctx); err != nil {
+		log.Warn("Unable to wait for running transactions", "error", err)
+	}
+	models.DBClose()
+	log.Info("Server stopped")
+}
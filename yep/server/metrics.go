@@ -0,0 +1,66 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package server
+
+import (
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// routeKey is the key of the gin context in which the
+// route that matched the current request is stored.
+const routeKey = "yep_route"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yep",
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "yep",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// setRoute returns a gin handler that stores the given
+// route in the context for metricsMiddleware.
+func setRoute(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(routeKey, route)
+	}
+}
+
+// routeHandlers returns the gin handlers to register at relativePath
+// in this RouterGroup for the given handlers, preceded by the handler
+// that sets the route of the request.
+func (rg *RouterGroup) routeHandlers(relativePath string, handlers ...HandlerFunc) []gin.HandlerFunc {
+	route := path.Join(rg.BasePath(), relativePath)
+	return append([]gin.HandlerFunc{setRoute(route)}, wrapContextFuncs(handlers...)...)
+}
+
+// metricsMiddleware counts the requests and measures their latency
+// by method and route. Requests that are not served by a route handler,
+// such as static files or not found pages, are counted under the "other"
+// route to bound the number of series.
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := "other"
+	if r, ok := c.Get(routeKey); ok {
+		route = r.(string)
+	}
+	requestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Now().Sub(start).Seconds())
+}
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration)
+}
@@ -33,9 +33,14 @@ var symlinkDirs = []string{"static", "templates", "data", "views"}
 
 // A Module is a go package that implements business features.
 // This struct is used to register modules.
+//
+// ReadinessChecks are run by the /readyz endpoint in addition to the core
+// checks, with their name prefixed by the module name. They must return an
+// error if the module is not able to serve requests.
 type Module struct {
-	Name     string
-	PostInit func()
+	Name            string
+	PostInit        func()
+	ReadinessChecks map[string]HealthCheck
 }
 
 // A ModulesList is a list of Module objects
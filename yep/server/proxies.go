@@ -0,0 +1,122 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// trustedProxies are the networks of the reverse proxies whose
+// X-Forwarded-For and X-Real-IP headers are trusted by ClientIP.
+// It is set by SetTrustedProxies.
+var trustedProxies struct {
+	sync.RWMutex
+	nets []*net.IPNet
+}
+
+// SetTrustedProxies sets the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers are trusted to find the IP address of the clients.
+// Each proxy is either an IP address or a network in CIDR notation.
+//
+// No proxy is trusted by default, so that clients cannot spoof their
+// address by setting these headers.
+func SetTrustedProxies(proxies []string) error {
+	nets, err := ParseIPNets(proxies)
+	if err != nil {
+		return err
+	}
+	trustedProxies.Lock()
+	defer trustedProxies.Unlock()
+	trustedProxies.nets = nets
+	return nil
+}
+
+// ParseIPNets parses the given IP addresses and networks in CIDR notation.
+// IP addresses are returned as networks containing only this address.
+func ParseIPNets(addrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, len(addrs))
+	for i, addr := range addrs {
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %s", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		nets[i] = ipNet
+	}
+	return nets, nil
+}
+
+// ConfigureTrustedProxies sets the trusted reverse proxies from the
+// Server.TrustedProxies key of the viper configuration.
+func ConfigureTrustedProxies() {
+	if err := SetTrustedProxies(viper.GetStringSlice("Server.TrustedProxies")); err != nil {
+		log.Panic("Invalid trusted proxies", "proxies", viper.GetStringSlice("Server.TrustedProxies"), "error", err)
+	}
+}
+
+// isTrustedProxy returns true if the given IP address is the
+// address of one of the trusted proxies.
+func isTrustedProxy(ip net.IP) bool {
+	trustedProxies.RLock()
+	defer trustedProxies.RUnlock()
+	for _, ipNet := range trustedProxies.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client of the request.
+//
+// This is the remote address of the connection, unless it is a trusted
+// proxy. In this case, the X-Forwarded-For header is read from right to left
+// and the first address that is not a trusted proxy is returned. The
+// X-Real-IP header is used if the request has no X-Forwarded-For header.
+func (c *Context) ClientIP() string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(c.Request.RemoteAddr)
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !isTrustedProxy(remote) {
+		return host
+	}
+	forwarded := c.Request.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		if ip := net.ParseIP(strings.TrimSpace(c.Request.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+		return host
+	}
+	addrs := strings.Split(forwarded, ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return host
+}
@@ -52,46 +52,46 @@ func (rg *RouterGroup) Use(middleware ...HandlerFunc) gin.IRoutes {
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
 func (rg *RouterGroup) Handle(httpMethod, relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.Handle(httpMethod, relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.Handle(httpMethod, relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // POST is a shortcut for router.Handle("POST", path, handle)
 func (rg *RouterGroup) POST(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.POST(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.POST(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // GET is a shortcut for router.Handle("GET", path, handle)
 func (rg *RouterGroup) GET(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.GET(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.GET(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // DELETE is a shortcut for router.Handle("DELETE", path, handle)
 func (rg *RouterGroup) DELETE(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.DELETE(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.DELETE(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // PATCH is a shortcut for router.Handle("PATCH", path, handle)
 func (rg *RouterGroup) PATCH(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.PATCH(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.PATCH(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // PUT is a shortcut for router.Handle("PUT", path, handle)
 func (rg *RouterGroup) PUT(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.PUT(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.PUT(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // OPTIONS is a shortcut for router.Handle("OPTIONS", path, handle)
 func (rg *RouterGroup) OPTIONS(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.OPTIONS(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.OPTIONS(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // HEAD is a shortcut for router.Handle("HEAD", path, handle)
 func (rg *RouterGroup) HEAD(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.HEAD(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.HEAD(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
 
 // Any registers a route that matches all the HTTP methods.
 // GET, POST, PUT, PATCH, HEAD, OPTIONS, DELETE, CONNECT, TRACE
 func (rg *RouterGroup) Any(relativePath string, handlers ...HandlerFunc) gin.IRoutes {
-	return rg.RouterGroup.Any(relativePath, wrapContextFuncs(handlers...)...)
+	return rg.RouterGroup.Any(relativePath, rg.routeHandlers(relativePath, handlers...)...)
 }
@@ -87,11 +87,15 @@ func init() {
 	// Set to ReleaseMode now for tests and is overridden later (yep/cmd/server.go)
 	gin.SetMode(gin.ReleaseMode)
 	yepServer = &Server{gin.New()}
-	store := sessions.NewCookieStore([]byte(">r&5#5T/sG-jnf=EW8$(WQX'-m2R6Gk*^qqr`CxEtG'wQ[/'G@`NYn^on?b!4G`9"),
-		[]byte("!WY9Q|}09!4Ke=@w0HS|]$u,p1f^k(5T"))
+	// Forwarded headers are only trusted from the proxies set by SetTrustedProxies
+	yepServer.ForwardedByClientIP = false
+	// Sessions use random keys until ConfigureSessions is called
+	SetSessionStore(sessions.NewCookieStore(sessionKeyPairs([]string{randomSessionKey()})...))
 	yepServer.Use(gin.Recovery())
-	yepServer.Use(sessions.Sessions("yep-session", store))
+	yepServer.Use(sessionsMiddleware)
 	yepServer.Use(logging.LogForGin(log))
+	yepServer.Use(metricsMiddleware)
+	registerHealthRoutes(yepServer)
 	cleanModuleSymlinks()
 }
 
@@ -0,0 +1,246 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	gorillasessions "github.com/gorilla/sessions"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/spf13/viper"
+)
+
+// sessionCookieName is the name of the session cookie
+const sessionCookieName = "yep-session"
+
+// sessionsHandler is the gin middleware that handles sessions.
+// It is set by ConfigureSessions.
+var sessionsHandler gin.HandlerFunc
+
+// sessionsMiddleware calls the current sessionsHandler.
+// It is registered once at init so that the session store can be
+// configured after the server has been created.
+func sessionsMiddleware(c *gin.Context) {
+	sessionsHandler(c)
+}
+
+// ConfigureSessions sets the session store of the server from the following
+// keys of the viper configuration:
+//
+// - Sessions.Store: "cookie" to store sessions in signed and encrypted
+// cookies (default) or "db" to store them in the Session model.
+// - Sessions.Keys: the secret keys used to sign and encrypt cookies. The first
+// key is used for new cookies and the others are only used to read existing
+// cookies, which allows key rotation. If not set, keys are read from the
+// comma separated YEP_SESSION_KEYS environment variable. If neither is set,
+// random keys are generated and sessions do not survive a restart.
+// - Sessions.MaxAge: the lifetime of sessions in seconds (default 7 days).
+// - Sessions.Secure: only send the session cookie over HTTPS.
+func ConfigureSessions() {
+	viper.SetDefault("Sessions.Store", "cookie")
+	viper.SetDefault("Sessions.MaxAge", 7*24*3600)
+	keys := viper.GetStringSlice("Sessions.Keys")
+	if len(keys) == 0 && os.Getenv("YEP_SESSION_KEYS") != "" {
+		keys = strings.Split(os.Getenv("YEP_SESSION_KEYS"), ",")
+	}
+	if len(keys) == 0 {
+		log.Warn("No session keys configured, using random keys. Sessions will be lost on restart.")
+		keys = []string{randomSessionKey()}
+	}
+	var store sessions.Store
+	switch viper.GetString("Sessions.Store") {
+	case "cookie":
+		store = sessions.NewCookieStore(sessionKeyPairs(keys)...)
+	case "db":
+		store = newDBSessionStore(sessionKeyPairs(keys)...)
+	default:
+		log.Panic("Unknown session store", "store", viper.GetString("Sessions.Store"))
+	}
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   viper.GetInt("Sessions.MaxAge"),
+		Secure:   viper.GetBool("Sessions.Secure"),
+		HttpOnly: true,
+	})
+	SetSessionStore(store)
+}
+
+// sessionStore is the current session store of the server
+var sessionStore sessions.Store
+
+// SetSessionStore sets the given store as the session store of the server.
+func SetSessionStore(store sessions.Store) {
+	sessionStore = store
+	sessionsHandler = sessions.Sessions(sessionCookieName, store)
+}
+
+// RenewSession gives a new ID to the session of this request when it is
+// next saved, and deletes the session stored with the current ID. It must be
+// called when the user of the session changes, so that a session ID planted
+// before login cannot be used to hijack the authenticated session.
+//
+// Cookie sessions hold their values in the cookie and are not affected.
+func (c *Context) RenewSession() {
+	store, ok := sessionStore.(*dbSessionStore)
+	if !ok {
+		return
+	}
+	session, err := store.Get(c.Request, sessionCookieName)
+	if err != nil || session.ID == "" {
+		return
+	}
+	models.DeleteDBSession(session.ID)
+	session.ID = ""
+	session.IsNew = true
+}
+
+// sessionKeyPairs returns the authentication and encryption key pairs
+// derived from the given secret keys.
+func sessionKeyPairs(keys []string) [][]byte {
+	var res [][]byte
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		authKey := sha512.Sum512([]byte(key))
+		encKey := sha256.Sum256([]byte(key))
+		res = append(res, authKey[:], encKey[:])
+	}
+	return res
+}
+
+// randomSessionKey returns a new random secret key
+func randomSessionKey() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Panic("Unable to generate session key", "error", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// dbSessionStore is a session store that keeps the values of the
+// sessions in the database. The cookie only holds the signed session ID.
+type dbSessionStore struct {
+	codecs  []securecookie.Codec
+	options *gorillasessions.Options
+}
+
+// newDBSessionStore returns a new dbSessionStore that signs
+// and encrypts session IDs with the given key pairs.
+func newDBSessionStore(keyPairs ...[]byte) *dbSessionStore {
+	return &dbSessionStore{
+		codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		options: &gorillasessions.Options{Path: "/"},
+	}
+}
+
+// Options sets the options of the cookies of the sessions
+func (s *dbSessionStore) Options(options sessions.Options) {
+	s.options = &gorillasessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+// Get returns the session with the given name for this request
+func (s *dbSessionStore) Get(r *http.Request, name string) (*gorillasessions.Session, error) {
+	return gorillasessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the session with the given name for this request. It is loaded
+// from the database if the request has a valid session cookie or a new
+// session is returned otherwise.
+func (s *dbSessionStore) New(r *http.Request, name string) (*gorillasessions.Session, error) {
+	session := gorillasessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.codecs...); err != nil {
+		return session, nil
+	}
+	dbSession, ok := models.LoadDBSession(session.ID)
+	if !ok {
+		session.ID = ""
+		return session, nil
+	}
+	var values map[interface{}]interface{}
+	data, err := base64.StdEncoding.DecodeString(dbSession.Data)
+	if err == nil {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&values)
+	}
+	if err != nil {
+		log.Warn("Unable to decode session data", "error", err)
+		session.ID = ""
+		return session, nil
+	}
+	session.Values = values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the given session to the database and sets the session cookie.
+// Sessions with a negative MaxAge are deleted.
+func (s *dbSessionStore) Save(r *http.Request, w http.ResponseWriter, session *gorillasessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			models.DeleteDBSession(session.ID)
+		}
+		http.SetCookie(w, gorillasessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	create := session.ID == ""
+	if create {
+		session.ID = randomSessionKey()
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return err
+	}
+	uid, _ := session.Values["uid"].(int64)
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = viper.GetInt("Sessions.MaxAge")
+	}
+	ok := models.SaveDBSession(models.DBSession{
+		ID:             session.ID,
+		UID:            uid,
+		Data:           base64.StdEncoding.EncodeToString(data.Bytes()),
+		ExpirationDate: time.Now().Add(time.Duration(maxAge) * time.Second),
+		RemoteAddr:     r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+	}, create)
+	if !ok {
+		// The session has been revoked during the request
+		http.SetCookie(w, gorillasessions.NewCookie(session.Name(), "", &gorillasessions.Options{Path: "/", MaxAge: -1}))
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gorillasessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+var _ sessions.Store = new(dbSessionStore)
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/npiganeau/yep/yep/models/fieldtype"
+	"github.com/npiganeau/yep/yep/tools/imageutils"
 	"golang.org/x/tools/go/loader"
 )
 
@@ -320,6 +321,18 @@ func parseAddField(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[stri
 		}
 	}
 	(*modelsData)[modelName].Fields[fieldName] = fData
+	if typeStr == "Image" {
+		// Image fields also add a read-only field for each resized variant
+		for _, variant := range imageutils.DefaultVariants {
+			variantName := fieldName + variant.Suffix
+			(*modelsData)[modelName].Fields[variantName] = FieldASTData{
+				Name: variantName,
+				Type: TypeData{
+					Type: fieldtype.Image.DefaultGoType().String(),
+				},
+			}
+		}
+	}
 }
 
 // parseAddMethod parses the given node which is an AddMethod function
@@ -0,0 +1,176 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// A Variant is a resized version of an image that is
+// stored along with the original image.
+type Variant struct {
+	// Suffix is appended to the name of the original image field
+	// to get the name of the variant field.
+	Suffix string
+	// Size is the maximum width and height in pixels of the variant.
+	Size int
+}
+
+var (
+	// DefaultVariants are the variants stored for each image field.
+	DefaultVariants = []Variant{
+		{Suffix: "Large", Size: 1024},
+		{Suffix: "Medium", Size: 256},
+		{Suffix: "Small", Size: 64},
+	}
+	// MaxPixels is the maximum number of pixels of the images decoded by
+	// DecodeBase64, so that small compressed files cannot exhaust the memory
+	// of the server once decoded.
+	MaxPixels = 50 * 1000 * 1000
+)
+
+// DecodeBase64 decodes the given base64 encoded image data.
+// It returns the decoded image and the name of its format
+// or an error if data is not a valid PNG, JPEG or GIF image.
+//
+// The dimensions of the image are checked before it is decoded, and
+// an error is returned if it has more than MaxPixels pixels.
+func DecodeBase64(data string) (image.Image, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, "", err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > int64(MaxPixels) {
+		return nil, "", fmt.Errorf("image of %dx%d pixels is larger than %d pixels", config.Width, config.Height, MaxPixels)
+	}
+	return image.Decode(bytes.NewReader(raw))
+}
+
+// EncodeBase64 encodes the given image in the given format
+// and returns it as a base64 string. JPEG and GIF formats are
+// kept, all other formats are encoded as PNG.
+func EncodeBase64(img image.Image, format string) (string, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// ResizeBase64 returns the given base64 encoded image resized so that
+// it fits in a size x size square, for each of the given sizes. The image
+// is decoded only once, and it is returned unchanged for the sizes in
+// which it already fits.
+func ResizeBase64(data string, sizes ...int) ([]string, error) {
+	img, format, err := DecodeBase64(data)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, len(sizes))
+	for i, size := range sizes {
+		bounds := img.Bounds()
+		if bounds.Dx() <= size && bounds.Dy() <= size {
+			res[i] = data
+			continue
+		}
+		if res[i], err = EncodeBase64(Thumbnail(img, size), format); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Thumbnail returns a copy of img scaled down with its aspect ratio
+// preserved so that neither its width nor its height exceed size.
+// The image is returned unchanged if it already fits.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	newWidth, newHeight := size, size
+	if width > height {
+		newHeight = max(1, height*size/width)
+	} else {
+		newWidth = max(1, width*size/height)
+	}
+	return Resize(img, newWidth, newHeight)
+}
+
+// Resize returns a new image of the given width and height scaled
+// from img. Each pixel of the new image is the average of the pixels
+// of img it covers, which gives good results when scaling down.
+func Resize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			res.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return res
+}
+
+// max returns the greatest of a and b
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageutils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImageUtils(t *testing.T) {
+	Convey("Testing image utilities", t, func() {
+		img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+		for x := 0; x < 400; x++ {
+			for y := 0; y < 200; y++ {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			}
+		}
+		Convey("Thumbnails should keep the aspect ratio", func() {
+			thumb := Thumbnail(img, 100)
+			So(thumb.Bounds().Dx(), ShouldEqual, 100)
+			So(thumb.Bounds().Dy(), ShouldEqual, 50)
+			r, g, b, a := thumb.At(10, 10).RGBA()
+			So(r, ShouldEqual, 0xffff)
+			So(g, ShouldEqual, 0)
+			So(b, ShouldEqual, 0)
+			So(a, ShouldEqual, 0xffff)
+		})
+		Convey("Small images should not be resized", func() {
+			So(Thumbnail(img, 1024), ShouldEqual, img)
+		})
+		Convey("Encoding and decoding base64 images", func() {
+			data, err := EncodeBase64(img, "png")
+			So(err, ShouldBeNil)
+			decoded, format, err := DecodeBase64(data)
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, "png")
+			So(decoded.Bounds(), ShouldResemble, img.Bounds())
+			resized, err := ResizeBase64(data, 64, 1024)
+			So(err, ShouldBeNil)
+			So(resized, ShouldHaveLength, 2)
+			decoded, _, _ = DecodeBase64(resized[0])
+			So(decoded.Bounds().Dx(), ShouldEqual, 64)
+			So(decoded.Bounds().Dy(), ShouldEqual, 32)
+			So(resized[1], ShouldEqual, data)
+		})
+		Convey("Images with too many pixels should not be decoded", func() {
+			data, _ := EncodeBase64(img, "png")
+			maxPixels := MaxPixels
+			MaxPixels = 400*200 - 1
+			Reset(func() {
+				MaxPixels = maxPixels
+			})
+			_, _, err := DecodeBase64(data)
+			So(err, ShouldNotBeNil)
+			_, err = ResizeBase64(data, 64)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Invalid data should return an error", func() {
+			_, _, err := DecodeBase64("bm90IGFuIGltYWdl")
+			So(err, ShouldNotBeNil)
+			_, err = ResizeBase64("not base64 data!", 64)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A MockProvider is a local OpenID Connect provider meant for testing.
+//
+// Its authorization endpoint does not ask for credentials and immediately
+// redirects to the client with an authorization code for a user with
+// the current Claims.
+type MockProvider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Claims are the claims of the ID tokens issued by the provider.
+	// iss, aud, iat, exp and nonce claims are set automatically.
+	Claims Claims
+	// Key is the key used to sign ID tokens
+	Key *rsa.PrivateKey
+
+	sync.Mutex
+	codes map[string]Claims
+}
+
+// NewMockProvider starts and returns a new MockProvider for the given client.
+// Call Close on the returned provider to stop it.
+func NewMockProvider(clientID, clientSecret string) *MockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	mp := &MockProvider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Claims:       make(Claims),
+		Key:          key,
+		codes:        make(map[string]Claims),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", mp.discovery)
+	mux.HandleFunc("/authorize", mp.authorize)
+	mux.HandleFunc("/token", mp.token)
+	mux.HandleFunc("/jwks", mp.jwks)
+	mp.Server = httptest.NewServer(mux)
+	return mp
+}
+
+// discovery serves the discovery document of the provider
+func (mp *MockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 mp.URL,
+		"authorization_endpoint": mp.URL + "/authorize",
+		"token_endpoint":         mp.URL + "/token",
+		"jwks_uri":               mp.URL + "/jwks",
+	})
+}
+
+// authorize redirects to the client with a new authorization code
+func (mp *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != mp.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	claims := make(Claims)
+	for k, v := range mp.Claims {
+		claims[k] = v
+	}
+	claims["nonce"] = query.Get("nonce")
+	code := RandomString()
+	mp.Lock()
+	mp.codes[code] = claims
+	mp.Unlock()
+	params := url.Values{"code": {code}, "state": {query.Get("state")}}
+	http.Redirect(w, r, query.Get("redirect_uri")+"?"+params.Encode(), http.StatusFound)
+}
+
+// token exchanges an authorization code for an ID token
+func (mp *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != mp.ClientID || clientSecret != mp.ClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	mp.Lock()
+	claims, ok := mp.codes[r.FormValue("code")]
+	delete(mp.codes, r.FormValue("code"))
+	mp.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": RandomString(),
+		"token_type":   "Bearer",
+		"id_token":     mp.IDToken(claims),
+	})
+}
+
+// jwks serves the public key of the provider
+func (mp *MockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": "mock",
+			"n":   base64.RawURLEncoding.EncodeToString(mp.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(mp.Key.E)).Bytes()),
+		}},
+	})
+}
+
+// IDToken returns an ID token with the given claims signed by this provider.
+// iss, aud, iat and exp claims are added if they are not set.
+func (mp *MockProvider) IDToken(claims Claims) string {
+	now := time.Now()
+	payload := map[string]interface{}{
+		"iss": mp.URL,
+		"aud": mp.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "mock"})
+	body, _ := json.Marshal(payload)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, mp.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
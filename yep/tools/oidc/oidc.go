@@ -0,0 +1,328 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc implements the client side of the OpenID Connect
+// authorization code flow: provider discovery, token exchange and
+// ID token validation against the provider's JSON Web Key Set.
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClockSkew is the tolerance used when checking the validity dates of tokens
+var ClockSkew = time.Minute
+
+// A Config holds the parameters of the client application
+type Config struct {
+	// Issuer is the URL of the provider, as it appears in the tokens
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of the callback of the application
+	RedirectURL string
+	// Scopes are requested in addition to the "openid" scope
+	Scopes []string
+}
+
+// A Provider is an OpenID Connect identity provider
+type Provider struct {
+	config                Config
+	client                *http.Client
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	Issuer                string `json:"issuer"`
+
+	sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+// NewProvider returns a new Provider for the given config. The endpoints
+// of the provider are read from its discovery document.
+func NewProvider(config Config) (*Provider, error) {
+	p := Provider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+	discoveryURL := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(discoveryURL, &p); err != nil {
+		return nil, fmt.Errorf("unable to read provider discovery document: %s", err)
+	}
+	if p.Issuer != config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", config.Issuer, p.Issuer)
+	}
+	return &p, nil
+}
+
+// getJSON gets the given URL and unmarshals the JSON response into dest
+func (p *Provider) getJSON(url string, dest interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// AuthCodeURL returns the URL of the provider to which the user must be
+// redirected to log in. state and nonce must be random strings that are
+// checked when the user is redirected back to the application.
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.config.ClientID},
+		"redirect_uri":  {p.config.RedirectURL},
+		"scope":         {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange exchanges the given authorization code for tokens at the
+// token endpoint of the provider and returns the raw ID token.
+func (p *Provider) Exchange(code string) (string, error) {
+	params := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURL},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %s: %s", resp.Status, tokens.Error)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("no ID token in token response")
+	}
+	return tokens.IDToken, nil
+}
+
+// Claims are the claims of an ID token
+type Claims map[string]interface{}
+
+// String returns the value of the given claim if it is a string
+// or an empty string otherwise.
+func (c Claims) String(name string) string {
+	val, _ := c[name].(string)
+	return val
+}
+
+// Strings returns the value of the given claim as a slice of strings.
+// A single string claim is returned as a slice of one element.
+func (c Claims) Strings(name string) []string {
+	switch val := c[name].(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		var res []string
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// time returns the value of the given numeric date claim
+func (c Claims) time(name string) (time.Time, bool) {
+	val, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(val), 0), true
+}
+
+// VerifyIDToken checks the signature of the given raw ID token against the keys
+// of the provider, as well as its issuer, audience, validity dates and nonce.
+// It returns the claims of the token.
+func (p *Provider) VerifyIDToken(rawToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %s", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %s", header.Alg)
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %s", err)
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %s", err)
+	}
+	if claims.String("iss") != p.Issuer {
+		return nil, fmt.Errorf("wrong token issuer %s", claims.String("iss"))
+	}
+	var audOK bool
+	for _, aud := range claims.Strings("aud") {
+		if aud == p.config.ClientID {
+			audOK = true
+		}
+	}
+	if !audOK {
+		return nil, errors.New("token is not intended for this client")
+	}
+	now := time.Now()
+	exp, ok := claims.time("exp")
+	if !ok || now.After(exp.Add(ClockSkew)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(ClockSkew).Before(nbf) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if claims.String("nonce") != nonce {
+		return nil, errors.New("wrong token nonce")
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes the given base64url encoded JSON segment into dest
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// key returns the public key of the provider with the given key ID.
+// The key set of the provider is fetched again if the key is unknown
+// to handle key rotation.
+func (p *Provider) key(kid string) (*rsa.PublicKey, error) {
+	p.RLock()
+	key, ok := p.keys[kid]
+	p.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if err := p.fetchKeys(); err != nil {
+		return nil, fmt.Errorf("unable to fetch provider keys: %s", err)
+	}
+	p.RLock()
+	defer p.RUnlock()
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, nil
+		}
+	}
+	if key, ok = p.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+	return key, nil
+}
+
+// fetchKeys fetches the RSA signing keys of the provider from its JWKS URI
+func (p *Provider) fetchKeys() error {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(p.JWKSURI, &jwks); err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.keys = keys
+	return nil
+}
+
+// RandomString returns a random URL safe string
+// suitable for state and nonce parameters.
+func RandomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOIDC(t *testing.T) {
+	mp := NewMockProvider("yep", "secret")
+	defer mp.Close()
+	mp.Claims = Claims{"sub": "42", "email": "jdoe@example.com", "groups": []string{"sales"}}
+	Convey("Testing OpenID Connect client", t, func() {
+		provider, err := NewProvider(Config{
+			Issuer:       mp.URL,
+			ClientID:     "yep",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost/callback",
+			Scopes:       []string{"email"},
+		})
+		So(err, ShouldBeNil)
+		So(provider.TokenEndpoint, ShouldEqual, mp.URL+"/token")
+		Convey("Authorization code flow should return the user claims", func() {
+			authURL := provider.AuthCodeURL("mystate", "mynonce")
+			client := http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+			resp, err := client.Get(authURL)
+			So(err, ShouldBeNil)
+			redirect, _ := url.Parse(resp.Header.Get("Location"))
+			So(redirect.Host, ShouldEqual, "localhost")
+			So(redirect.Query().Get("state"), ShouldEqual, "mystate")
+			rawToken, err := provider.Exchange(redirect.Query().Get("code"))
+			So(err, ShouldBeNil)
+			claims, err := provider.VerifyIDToken(rawToken, "mynonce")
+			So(err, ShouldBeNil)
+			So(claims.String("email"), ShouldEqual, "jdoe@example.com")
+			So(claims.Strings("groups"), ShouldResemble, []string{"sales"})
+			Convey("Codes should be used only once", func() {
+				_, err := provider.Exchange(redirect.Query().Get("code"))
+				So(err, ShouldNotBeNil)
+			})
+			Convey("Wrong nonce should be rejected", func() {
+				_, err := provider.VerifyIDToken(rawToken, "othernonce")
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("Invalid tokens should be rejected", func() {
+			_, err := provider.VerifyIDToken("not.a.token", "")
+			So(err, ShouldNotBeNil)
+			_, err = provider.VerifyIDToken(mp.IDToken(Claims{"aud": "other"}), "")
+			So(err, ShouldNotBeNil)
+			_, err = provider.VerifyIDToken(mp.IDToken(Claims{"exp": time.Now().Add(-time.Hour).Unix()}), "")
+			So(err, ShouldNotBeNil)
+			_, err = provider.VerifyIDToken(mp.IDToken(Claims{"iss": "http://evil.example.com"}), "")
+			So(err, ShouldNotBeNil)
+			other := NewMockProvider("yep", "secret")
+			defer other.Close()
+			_, err = provider.VerifyIDToken(other.IDToken(Claims{"iss": mp.URL}), "")
+			So(err, ShouldNotBeNil)
+			_, err = provider.VerifyIDToken(mp.IDToken(Claims{}), "")
+			So(err, ShouldBeNil)
+		})
+	})
+}
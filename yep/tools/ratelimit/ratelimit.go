@@ -0,0 +1,140 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit implements token bucket rate limiters.
+//
+// Each key (e.g. an IP address or a user id) has a bucket that holds at most
+// Burst tokens and that is refilled at Rate tokens per second. An action is
+// allowed for a key if a token can be taken from its bucket.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A Limiter limits the rate of actions per key with token buckets.
+type Limiter interface {
+	// Take takes a token from the bucket of the given key and returns true.
+	// If the bucket is empty, it returns false and the time after which a
+	// token will be available.
+	Take(key string) (bool, time.Duration)
+	// Available returns true if a token is available in the bucket of the
+	// given key, without taking it. Otherwise, it returns false and the time
+	// after which a token will be available.
+	Available(key string) (bool, time.Duration)
+}
+
+// Refill returns the number of tokens of a bucket that had the given tokens
+// elapsed ago, given the rate and burst of the bucket.
+func Refill(tokens float64, elapsed time.Duration, rate float64, burst int) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(burst), tokens+rate*elapsed.Seconds())
+}
+
+// Wait returns the time after which a bucket with the given tokens
+// and rate will have a token available.
+func Wait(tokens float64, rate float64) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / rate * float64(time.Second))
+}
+
+// A bucket of a MemoryLimiter
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// A MemoryLimiter is a Limiter that holds its buckets in memory.
+// It is safe for concurrent use by multiple goroutines.
+type MemoryLimiter struct {
+	sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter returns a new MemoryLimiter with buckets of
+// the given burst size refilled at rate tokens per second.
+func NewMemoryLimiter(rate float64, burst int) *MemoryLimiter {
+	return &MemoryLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from the bucket of the given key and returns true.
+// If the bucket is empty, it returns false and the time after which a
+// token will be available.
+func (ml *MemoryLimiter) Take(key string) (bool, time.Duration) {
+	ml.Lock()
+	defer ml.Unlock()
+	b := ml.bucket(key)
+	if b.tokens < 1 {
+		return false, Wait(b.tokens, ml.rate)
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Available returns true if a token is available in the bucket of the
+// given key, without taking it. Otherwise, it returns false and the time
+// after which a token will be available.
+func (ml *MemoryLimiter) Available(key string) (bool, time.Duration) {
+	ml.Lock()
+	defer ml.Unlock()
+	b := ml.bucket(key)
+	return b.tokens >= 1, Wait(b.tokens, ml.rate)
+}
+
+// bucket returns the refilled bucket of the given key. It must be
+// called with the lock held.
+func (ml *MemoryLimiter) bucket(key string) *bucket {
+	now := ml.now()
+	ml.sweep(now)
+	b, ok := ml.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(ml.burst), updated: now}
+		ml.buckets[key] = b
+		return b
+	}
+	b.tokens = Refill(b.tokens, now.Sub(b.updated), ml.rate, ml.burst)
+	b.updated = now
+	return b
+}
+
+// sweep removes the buckets that are full at the given time,
+// at most once per minute, so that memory does not grow forever.
+func (ml *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(ml.lastSweep) < time.Minute {
+		return
+	}
+	ml.lastSweep = now
+	for key, b := range ml.buckets {
+		if Refill(b.tokens, now.Sub(b.updated), ml.rate, ml.burst) >= float64(ml.burst) {
+			delete(ml.buckets, key)
+		}
+	}
+}
+
+var _ Limiter = new(MemoryLimiter)
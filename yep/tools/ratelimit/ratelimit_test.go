@@ -0,0 +1,81 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	Convey("Testing memory rate limiter", t, func() {
+		now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		limiter := NewMemoryLimiter(2, 3)
+		limiter.now = func() time.Time { return now }
+		Convey("Bursts should be allowed up to the burst size", func() {
+			for i := 0; i < 3; i++ {
+				ok, _ := limiter.Take("a")
+				So(ok, ShouldBeTrue)
+			}
+			ok, wait := limiter.Take("a")
+			So(ok, ShouldBeFalse)
+			So(wait, ShouldEqual, 500*time.Millisecond)
+			ok, wait = limiter.Available("a")
+			So(ok, ShouldBeFalse)
+			So(wait, ShouldEqual, 500*time.Millisecond)
+		})
+		Convey("Keys should have their own bucket", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Take("a")
+			}
+			ok, _ := limiter.Take("b")
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Buckets should be refilled at the given rate", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Take("a")
+			}
+			now = now.Add(time.Second)
+			for i := 0; i < 2; i++ {
+				ok, _ := limiter.Take("a")
+				So(ok, ShouldBeTrue)
+			}
+			ok, _ := limiter.Take("a")
+			So(ok, ShouldBeFalse)
+			now = now.Add(time.Hour)
+			ok, _ = limiter.Available("a")
+			So(ok, ShouldBeTrue)
+			So(limiter.buckets["a"].tokens, ShouldEqual, 3)
+		})
+		Convey("Available should not take tokens", func() {
+			for i := 0; i < 5; i++ {
+				ok, _ := limiter.Available("a")
+				So(ok, ShouldBeTrue)
+			}
+			So(limiter.buckets["a"].tokens, ShouldEqual, 3)
+		})
+		Convey("Full buckets should be removed", func() {
+			limiter.Take("a")
+			limiter.Take("b")
+			now = now.Add(2 * time.Minute)
+			limiter.Take("c")
+			So(limiter.buckets, ShouldContainKey, "c")
+			So(limiter.buckets, ShouldNotContainKey, "a")
+			So(limiter.buckets, ShouldNotContainKey, "b")
+		})
+	})
+}
@@ -0,0 +1,519 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xmlrpc implements the encoding of XML-RPC method calls and
+// responses, as described in http://xmlrpc.scripting.com/spec.html.
+//
+// Values are decoded as follows:
+//   - int, i4 and i8 as int64
+//   - boolean as bool
+//   - string and untyped values as string
+//   - double as float64
+//   - dateTime.iso8601 as time.Time
+//   - base64 as []byte
+//   - array as []interface{}
+//   - struct as map[string]interface{}
+//   - nil as nil
+//
+// Encoding is the reverse. In addition, any slice or array is encoded
+// as an array, and any map with string keys or struct as a struct.
+// Struct fields are named after their json tag, if any.
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateTimeFormat is the format of dateTime.iso8601 values
+const dateTimeFormat = "20060102T15:04:05"
+
+// dateTimeFormats are the formats accepted when decoding dateTime.iso8601
+// values, since many implementations do not follow the specification.
+var dateTimeFormats = []string{
+	dateTimeFormat,
+	"2006-01-02T15:04:05",
+	"20060102T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// A Fault is an XML-RPC fault response. It is returned by
+// DecodeResponse when the response is a fault.
+type Fault struct {
+	Code   int
+	String string
+}
+
+// Error returns the string of this fault
+func (f Fault) Error() string {
+	return fmt.Sprintf("fault %d: %s", f.Code, f.String)
+}
+
+// A decoder reads XML-RPC values from an XML stream
+type decoder struct {
+	*xml.Decoder
+}
+
+// next returns the next start or end element of the stream,
+// skipping white spaces, comments and processing instructions.
+func (d *decoder) next() (xml.Token, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement, xml.EndElement:
+			return t, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("unexpected text %q", string(t))
+			}
+		}
+	}
+}
+
+// expectStart reads the start element with the given name
+func (d *decoder) expectStart(name string) error {
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	if start, ok := tok.(xml.StartElement); !ok || start.Name.Local != name {
+		return fmt.Errorf("expected <%s>, got %v", name, tok)
+	}
+	return nil
+}
+
+// expectEnd reads the end element with the given name
+func (d *decoder) expectEnd(name string) error {
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	if end, ok := tok.(xml.EndElement); !ok || end.Name.Local != name {
+		return fmt.Errorf("expected </%s>, got %v", name, tok)
+	}
+	return nil
+}
+
+// text reads the text of the current element up to its end element
+func (d *decoder) text() (string, error) {
+	var res []byte
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			res = append(res, t...)
+		case xml.StartElement:
+			return "", fmt.Errorf("unexpected element <%s>", t.Name.Local)
+		case xml.EndElement:
+			return string(res), nil
+		}
+	}
+}
+
+// value reads the value of the current value element up to its end element
+func (d *decoder) value() (interface{}, error) {
+	var text []byte
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.EndElement:
+			// Values without type are strings
+			return string(text), nil
+		case xml.StartElement:
+			res, err := d.typedValue(t.Name.Local)
+			if err != nil {
+				return nil, err
+			}
+			return res, d.expectEnd("value")
+		}
+	}
+}
+
+// typedValue reads the value of the current element of the given type
+func (d *decoder) typedValue(typ string) (interface{}, error) {
+	switch typ {
+	case "array":
+		return d.array()
+	case "struct":
+		return d.structValue()
+	case "nil":
+		return nil, d.expectEnd("nil")
+	}
+	text, err := d.text()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case "int", "i4", "i8":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "boolean":
+		switch strings.TrimSpace(text) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", text)
+	case "string":
+		return text, nil
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "dateTime.iso8601":
+		for _, format := range dateTimeFormats {
+			if res, err := time.Parse(format, strings.TrimSpace(text)); err == nil {
+				return res, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid dateTime.iso8601 %q", text)
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// array reads the values of the current array element
+func (d *decoder) array() ([]interface{}, error) {
+	if err := d.expectStart("data"); err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for {
+		tok, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			break
+		}
+		if start := tok.(xml.StartElement); start.Name.Local != "value" {
+			return nil, fmt.Errorf("expected <value>, got <%s>", start.Name.Local)
+		}
+		val, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, d.expectEnd("array")
+}
+
+// structValue reads the members of the current struct element
+func (d *decoder) structValue() (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	for {
+		tok, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			return res, nil
+		}
+		if start := tok.(xml.StartElement); start.Name.Local != "member" {
+			return nil, fmt.Errorf("expected <member>, got <%s>", start.Name.Local)
+		}
+		if err := d.expectStart("name"); err != nil {
+			return nil, err
+		}
+		name, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.expectStart("value"); err != nil {
+			return nil, err
+		}
+		if res[name], err = d.value(); err != nil {
+			return nil, err
+		}
+		if err := d.expectEnd("member"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// params reads the values of the params element of a call or a response
+func (d *decoder) params() ([]interface{}, error) {
+	var res []interface{}
+	for {
+		tok, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			return res, nil
+		}
+		if start := tok.(xml.StartElement); start.Name.Local != "param" {
+			return nil, fmt.Errorf("expected <param>, got <%s>", start.Name.Local)
+		}
+		if err := d.expectStart("value"); err != nil {
+			return nil, err
+		}
+		val, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+		if err := d.expectEnd("param"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DecodeCall reads an XML-RPC method call from r and returns
+// the name of the method and its parameters.
+func DecodeCall(r io.Reader) (string, []interface{}, error) {
+	d := &decoder{xml.NewDecoder(r)}
+	if err := d.expectStart("methodCall"); err != nil {
+		return "", nil, err
+	}
+	if err := d.expectStart("methodName"); err != nil {
+		return "", nil, err
+	}
+	method, err := d.text()
+	if err != nil {
+		return "", nil, err
+	}
+	tok, err := d.next()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := tok.(xml.EndElement); ok {
+		return strings.TrimSpace(method), nil, nil
+	}
+	if start := tok.(xml.StartElement); start.Name.Local != "params" {
+		return "", nil, fmt.Errorf("expected <params>, got <%s>", start.Name.Local)
+	}
+	params, err := d.params()
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(method), params, d.expectEnd("methodCall")
+}
+
+// DecodeResponse reads an XML-RPC method response from r and returns its
+// value. If the response is a fault, it returns a Fault as error.
+func DecodeResponse(r io.Reader) (interface{}, error) {
+	d := &decoder{xml.NewDecoder(r)}
+	if err := d.expectStart("methodResponse"); err != nil {
+		return nil, err
+	}
+	tok, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	switch start, _ := tok.(xml.StartElement); start.Name.Local {
+	case "params":
+		params, err := d.params()
+		if err != nil {
+			return nil, err
+		}
+		if len(params) != 1 {
+			return nil, fmt.Errorf("response has %d values instead of 1", len(params))
+		}
+		return params[0], nil
+	case "fault":
+		if err := d.expectStart("value"); err != nil {
+			return nil, err
+		}
+		val, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		fault, _ := val.(map[string]interface{})
+		code, _ := fault["faultCode"].(int64)
+		str, _ := fault["faultString"].(string)
+		return nil, Fault{Code: int(code), String: str}
+	}
+	return nil, fmt.Errorf("expected <params> or <fault>, got %v", tok)
+}
+
+// encodeValue writes the value element of the given value to buf
+func encodeValue(buf *bytes.Buffer, val reflect.Value) error {
+	for val.IsValid() && (val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr) {
+		if val.IsNil() {
+			val = reflect.Value{}
+			break
+		}
+		val = val.Elem()
+	}
+	buf.WriteString("<value>")
+	defer buf.WriteString("</value>")
+	if !val.IsValid() {
+		buf.WriteString("<nil/>")
+		return nil
+	}
+	if val.Kind() == reflect.Struct && val.Type().ConvertibleTo(timeType) {
+		tm := val.Convert(timeType).Interface().(time.Time)
+		fmt.Fprintf(buf, "<dateTime.iso8601>%s</dateTime.iso8601>", tm.Format(dateTimeFormat))
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(buf, "<int>%d</int>", val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(buf, "<int>%d</int>", val.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(buf, "<double>%s</double>", strconv.FormatFloat(val.Float(), 'f', -1, 64))
+	case reflect.String:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(val.String()))
+		buf.WriteString("</string>")
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 && val.Kind() == reflect.Slice {
+			fmt.Fprintf(buf, "<base64>%s</base64>", base64.StdEncoding.EncodeToString(val.Bytes()))
+			return nil
+		}
+		buf.WriteString("<array><data>")
+		for i := 0; i < val.Len(); i++ {
+			if err := encodeValue(buf, val.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</data></array>")
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", val.Type().Key())
+		}
+		keys := make([]string, val.Len())
+		for i, key := range val.MapKeys() {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		buf.WriteString("<struct>")
+		for _, key := range keys {
+			if err := encodeMember(buf, key, val.MapIndex(reflect.ValueOf(key).Convert(val.Type().Key()))); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</struct>")
+	case reflect.Struct:
+		buf.WriteString("<struct>")
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			if err := encodeMember(buf, name, val.Field(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</struct>")
+	default:
+		return fmt.Errorf("unsupported type %s", val.Type())
+	}
+	return nil
+}
+
+// encodeMember writes the member element of a struct to buf
+func encodeMember(buf *bytes.Buffer, name string, val reflect.Value) error {
+	buf.WriteString("<member><name>")
+	xml.EscapeText(buf, []byte(name))
+	buf.WriteString("</name>")
+	if err := encodeValue(buf, val); err != nil {
+		return err
+	}
+	buf.WriteString("</member>")
+	return nil
+}
+
+// encodeParams writes the params element with the given values to buf
+func encodeParams(buf *bytes.Buffer, params []interface{}) error {
+	buf.WriteString("<params>")
+	for _, param := range params {
+		buf.WriteString("<param>")
+		if err := encodeValue(buf, reflect.ValueOf(param)); err != nil {
+			return err
+		}
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("</params>")
+	return nil
+}
+
+// EncodeCall writes an XML-RPC call of the given method with the given params to w.
+func EncodeCall(w io.Writer, method string, params ...interface{}) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodCall><methodName>")
+	xml.EscapeText(buf, []byte(method))
+	buf.WriteString("</methodName>")
+	if err := encodeParams(buf, params); err != nil {
+		return err
+	}
+	buf.WriteString("</methodCall>")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// EncodeResponse writes an XML-RPC response with the given value to w.
+func EncodeResponse(w io.Writer, value interface{}) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse>")
+	if err := encodeParams(buf, []interface{}{value}); err != nil {
+		return err
+	}
+	buf.WriteString("</methodResponse>")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// EncodeFault writes an XML-RPC fault response to w.
+func EncodeFault(w io.Writer, fault Fault) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse><fault>")
+	err := encodeValue(buf, reflect.ValueOf(map[string]interface{}{
+		"faultCode":   fault.Code,
+		"faultString": fault.String,
+	}))
+	if err != nil {
+		return err
+	}
+	buf.WriteString("</fault></methodResponse>")
+	_, err = buf.WriteTo(w)
+	return err
+}
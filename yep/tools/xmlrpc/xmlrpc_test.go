@@ -0,0 +1,98 @@
+// Copyright 2017 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xmlrpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestXMLRPC(t *testing.T) {
+	Convey("Testing XML-RPC calls decoding", t, func() {
+		Convey("Calls from other implementations should be decoded", func() {
+			call := `<?xml version='1.0'?>
+<methodCall>
+<methodName>execute_kw</methodName>
+<params>
+<param><value><string>db</string></value></param>
+<param><value><int>2</int></value></param>
+<param><value>secret &amp; co</value></param>
+<param><value><array><data>
+<value><array><data>
+<value><string>name</string></value>
+<value><string>=</string></value>
+<value><boolean>0</boolean></value>
+</data></array></value>
+</data></array></value></param>
+<param><value><struct>
+<member><name>limit</name><value><i4>5</i4></value></member>
+<member><name>ratio</name><value><double>1.5</double></value></member>
+<member><name>empty</name><value><nil/></value></member>
+</struct></value></param>
+</params>
+</methodCall>`
+			method, params, err := DecodeCall(strings.NewReader(call))
+			So(err, ShouldBeNil)
+			So(method, ShouldEqual, "execute_kw")
+			So(params, ShouldHaveLength, 5)
+			So(params[0], ShouldEqual, "db")
+			So(params[1], ShouldEqual, int64(2))
+			So(params[2], ShouldEqual, "secret & co")
+			So(params[3], ShouldResemble, []interface{}{[]interface{}{"name", "=", false}})
+			So(params[4], ShouldResemble, map[string]interface{}{"limit": int64(5), "ratio": 1.5, "empty": nil})
+		})
+		Convey("Malformed calls should fail", func() {
+			_, _, err := DecodeCall(strings.NewReader(`<methodCall><params></params></methodCall>`))
+			So(err, ShouldNotBeNil)
+			_, _, err = DecodeCall(strings.NewReader(`<methodCall><methodName>m</methodName><params><param><value><int>x</int></value></param></params></methodCall>`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+	Convey("Testing XML-RPC encoding", t, func() {
+		date := time.Date(2017, 3, 4, 10, 20, 30, 0, time.UTC)
+		Convey("Encoded calls should be decoded back", func() {
+			var buf bytes.Buffer
+			So(EncodeCall(&buf, "write", []int64{1, 2}, map[string]interface{}{"name": "<John>", "date": date, "data": []byte("abc")}), ShouldBeNil)
+			method, params, err := DecodeCall(&buf)
+			So(err, ShouldBeNil)
+			So(method, ShouldEqual, "write")
+			So(params, ShouldResemble, []interface{}{
+				[]interface{}{int64(1), int64(2)},
+				map[string]interface{}{"name": "<John>", "date": date, "data": []byte("abc")},
+			})
+		})
+		Convey("Structs should be encoded with their json names", func() {
+			var buf bytes.Buffer
+			So(EncodeResponse(&buf, struct {
+				Name    string `json:"name"`
+				Skipped bool   `json:"-"`
+				Count   int
+			}{Name: "John", Count: 3}), ShouldBeNil)
+			res, err := DecodeResponse(&buf)
+			So(err, ShouldBeNil)
+			So(res, ShouldResemble, map[string]interface{}{"name": "John", "Count": int64(3)})
+		})
+		Convey("Faults should be decoded as errors", func() {
+			var buf bytes.Buffer
+			So(EncodeFault(&buf, Fault{Code: 3, String: "Access Denied"}), ShouldBeNil)
+			_, err := DecodeResponse(&buf)
+			So(err, ShouldResemble, Fault{Code: 3, String: "Access Denied"})
+		})
+	})
+}